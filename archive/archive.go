@@ -0,0 +1,335 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/MDGSF/iutils"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for unknown archive formats and for
+	// formats whose compressor has not been registered.
+	ErrUnsupportedFormat = errors.New("archive: unsupported format")
+	// ErrUnsafePath is returned when an archive entry would be extracted
+	// outside the destination directory.
+	ErrUnsafePath = errors.New("archive: unsafe path")
+	// ErrLimitExceeded is returned when extraction exceeds one of the
+	// configured size or count limits.
+	ErrLimitExceeded = errors.New("archive: limit exceeded")
+)
+
+// Format is an archive container and compression combination.
+type Format int
+
+const (
+	Tar Format = iota + 1
+	TarGz
+	TarZst
+	Zip
+)
+
+func (f Format) String() string {
+	switch f {
+	case Tar:
+		return "tar"
+	case TarGz:
+		return "tar.gz"
+	case TarZst:
+		return "tar.zst"
+	case Zip:
+		return "zip"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// DetectFormat returns the format matching the extension of name.
+func DetectFormat(name string) (Format, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar"):
+		return Tar, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return TarGz, nil
+	case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+		return TarZst, nil
+	case strings.HasSuffix(lower, ".zip"):
+		return Zip, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnsupportedFormat, name)
+}
+
+// Compressor wraps the stream of a compressed tar format.
+type Compressor struct {
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[Format]Compressor{
+		TarGz: {
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return gzip.NewWriter(w), nil
+			},
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				return gzip.NewReader(r)
+			},
+		},
+	}
+)
+
+// RegisterCompressor installs the compressor for a compressed tar format.
+// The standard library has no zstd, so TarZst works once a compressor
+// backed by a zstd package has been registered.
+func RegisterCompressor(format Format, c Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[format] = c
+}
+
+func lookupCompressor(format Format) (Compressor, error) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	c, ok := compressors[format]
+	if !ok {
+		return Compressor{}, fmt.Errorf("%w: no compressor registered for %v", ErrUnsupportedFormat, format)
+	}
+	return c, nil
+}
+
+// Options configures archive creation and extraction. A nil *Options
+// detects the format from the archive name and applies no limits.
+type Options struct {
+	// Format overrides the format detected from the archive name.
+	Format Format
+	// Filter, if set, selects the entries added by Create. path is slash
+	// separated and relative to the source directory.
+	Filter func(path string, d fs.DirEntry) bool
+
+	// MaxFileSize limits the extracted size of a single entry.
+	MaxFileSize int64
+	// MaxTotalSize limits the extracted size of all entries together.
+	MaxTotalSize int64
+	// MaxFiles limits the number of extracted entries.
+	MaxFiles int
+}
+
+func (o *Options) format(archivePath string) (Format, error) {
+	if o != nil && o.Format != 0 {
+		return o.Format, nil
+	}
+	return DetectFormat(archivePath)
+}
+
+// Create writes an archive of the directory dir to archivePath. The
+// archive file is written atomically.
+func Create(archivePath, dir string, opts *Options) error {
+	var filter func(string, fs.DirEntry) bool
+	if opts != nil {
+		filter = opts.Filter
+	}
+
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if filter != nil {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			if !filter(filepath.ToSlash(rel), d) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return CreateFromFiles(archivePath, dir, files, opts)
+}
+
+// CreateFromFiles writes an archive of files to archivePath, for example
+// the result of iutils.FindFilesWithExt. Entry names are the paths of the
+// files relative to baseDir.
+func CreateFromFiles(archivePath, baseDir string, files []string, opts *Options) error {
+	format, err := opts.format(archivePath)
+	if err != nil {
+		return err
+	}
+
+	af, err := iutils.NewAtomicFile(archivePath, &iutils.AtomicOptions{MkdirAll: true})
+	if err != nil {
+		return err
+	}
+	defer af.Close()
+
+	if err := Write(af, format, baseDir, files); err != nil {
+		return err
+	}
+	return af.Commit()
+}
+
+// Write streams an archive of files in the given format to w. Entry names
+// are the paths of the files relative to baseDir; directories, regular
+// files and symlinks are supported.
+func Write(w io.Writer, format Format, baseDir string, files []string) error {
+	switch format {
+	case Zip:
+		return writeZip(w, baseDir, files)
+	case Tar:
+		return writeTar(w, baseDir, files)
+	case TarGz, TarZst:
+		c, err := lookupCompressor(format)
+		if err != nil {
+			return err
+		}
+		cw, err := c.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		if err := writeTar(cw, baseDir, files); err != nil {
+			cw.Close()
+			return err
+		}
+		return cw.Close()
+	}
+	return fmt.Errorf("%w: %v", ErrUnsupportedFormat, format)
+}
+
+// archiveEntry is a file to be added to an archive.
+type archiveEntry struct {
+	path   string
+	name   string
+	info   fs.FileInfo
+	target string
+}
+
+func statEntry(baseDir, path string) (*archiveEntry, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(baseDir, path)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.ToSlash(rel)
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return nil, fmt.Errorf("%w: %s is not below %s", ErrUnsafePath, path, baseDir)
+	}
+
+	entry := &archiveEntry{path: path, name: name, info: info}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if entry.target, err = os.Readlink(path); err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+func writeTar(w io.Writer, baseDir string, files []string) error {
+	tw := tar.NewWriter(w)
+	for _, path := range files {
+		entry, err := statEntry(baseDir, path)
+		if err != nil {
+			return err
+		}
+		mode := entry.info.Mode()
+		if !mode.IsRegular() && !mode.IsDir() && mode&fs.ModeSymlink == 0 {
+			continue
+		}
+
+		hdr, err := tar.FileInfoHeader(entry.info, entry.target)
+		if err != nil {
+			return err
+		}
+		hdr.Name = entry.name
+		if mode.IsDir() {
+			hdr.Name += "/"
+		}
+		// Owner names depend on the machine that built the archive.
+		hdr.Uname, hdr.Gname = "", ""
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if mode.IsRegular() {
+			if err := copyFileTo(tw, path); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, baseDir string, files []string) error {
+	zw := zip.NewWriter(w)
+	for _, path := range files {
+		entry, err := statEntry(baseDir, path)
+		if err != nil {
+			return err
+		}
+		mode := entry.info.Mode()
+		if !mode.IsRegular() && !mode.IsDir() && mode&fs.ModeSymlink == 0 {
+			continue
+		}
+
+		hdr, err := zip.FileInfoHeader(entry.info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = entry.name
+		if mode.IsDir() {
+			hdr.Name += "/"
+			hdr.Method = zip.Store
+		} else if mode.IsRegular() {
+			hdr.Method = zip.Deflate
+		}
+
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		switch {
+		case mode.IsRegular():
+			err = copyFileTo(fw, path)
+		case mode&fs.ModeSymlink != 0:
+			// Zip stores the symlink target as the entry content.
+			_, err = io.WriteString(fw, entry.target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func copyFileTo(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
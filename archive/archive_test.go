@@ -0,0 +1,351 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MDGSF/iutils"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := iutils.WriteFile2(filepath.Join(root, filepath.FromSlash(name)), []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Format
+		wantErr bool
+	}{
+		{"a.tar", Tar, false},
+		{"a.TAR.GZ", TarGz, false},
+		{"a.tgz", TarGz, false},
+		{"a.tar.zst", TarZst, false},
+		{"a.zip", Zip, false},
+		{"a.rar", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := DetectFormat(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("DetectFormat(%q) = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestCreateExtractRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{
+		"a.txt":        "alpha",
+		"sub/b.txt":    "beta",
+		"sub/deep/c.s": "gamma",
+	})
+	if err := os.Chmod(filepath.Join(src, "sub", "deep", "c.s"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	hasSymlinks := os.Symlink("sub/b.txt", filepath.Join(src, "link")) == nil
+
+	for _, name := range []string{"out.tar", "out.tar.gz", "out.zip"} {
+		t.Run(name, func(t *testing.T) {
+			archivePath := filepath.Join(t.TempDir(), name)
+			if err := Create(archivePath, src, nil); err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+
+			dst := t.TempDir()
+			if err := Extract(archivePath, dst, nil); err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+
+			for rel, want := range map[string]string{"a.txt": "alpha", "sub/b.txt": "beta", "sub/deep/c.s": "gamma"} {
+				got, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(rel)))
+				if err != nil || string(got) != want {
+					t.Errorf("%s = %q, %v; want %q", rel, got, err, want)
+				}
+			}
+			info, err := os.Stat(filepath.Join(dst, "sub", "deep", "c.s"))
+			if err != nil || info.Mode().Perm() != 0755 {
+				t.Errorf("mode of c.s = %v, %v; want 0755", info.Mode().Perm(), err)
+			}
+			if hasSymlinks {
+				if target, err := os.Readlink(filepath.Join(dst, "link")); err != nil || target != "sub/b.txt" {
+					t.Errorf("link = %q, %v; want sub/b.txt", target, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateFromFiles(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"x/1.log": "1", "x/2.txt": "2", "y/3.log": "3"})
+
+	files, err := iutils.FindFilesWithExt(src, ".log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, Tar, src, files); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	var names []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if len(names) != 2 || names[0] != "x/1.log" || names[1] != "y/3.log" {
+		t.Errorf("archive entries = %v, want [x/1.log y/3.log]", names)
+	}
+
+	if err := Write(&buf, Tar, filepath.Join(src, "x"), files); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("Write() with file outside baseDir error = %v, want %v", err, ErrUnsafePath)
+	}
+}
+
+func TestRegisterCompressor(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"f": "data"})
+	archivePath := filepath.Join(t.TempDir(), "out.tar.zst")
+
+	if err := Create(archivePath, src, nil); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("Create() without zstd error = %v, want %v", err, ErrUnsupportedFormat)
+	}
+
+	// Stand in for a real zstd implementation.
+	RegisterCompressor(TarZst, Compressor{
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	})
+	defer func() {
+		compressorsMu.Lock()
+		delete(compressors, TarZst)
+		compressorsMu.Unlock()
+	}()
+
+	if err := Create(archivePath, src, nil); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	dst := t.TempDir()
+	if err := Extract(archivePath, dst, nil); err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if !iutils.FileExists(filepath.Join(dst, "f")) {
+		t.Errorf("Extract() did not restore f")
+	}
+}
+
+func buildTar(t *testing.T, headers []*tar.Header, contents []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i, hdr := range headers {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(contents[i]))
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(contents[i])); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractRejectsUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  []*tar.Header
+		contents []string
+	}{
+		{
+			name:     "dotdot",
+			headers:  []*tar.Header{{Name: "../evil.txt", Typeflag: tar.TypeReg}},
+			contents: []string{"x"},
+		},
+		{
+			name:     "absolute",
+			headers:  []*tar.Header{{Name: "/tmp/evil.txt", Typeflag: tar.TypeReg}},
+			contents: []string{"x"},
+		},
+		{
+			name:     "symlink outside",
+			headers:  []*tar.Header{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../../etc"}},
+			contents: []string{""},
+		},
+		{
+			name: "write through symlink",
+			headers: []*tar.Header{
+				{Name: "dir", Typeflag: tar.TypeSymlink, Linkname: "."},
+				{Name: "dir/escape", Typeflag: tar.TypeSymlink, Linkname: "../outside"},
+			},
+			contents: []string{"", ""},
+		},
+		{
+			name: "chained symlinks",
+			headers: []*tar.Header{
+				{Name: "y", Typeflag: tar.TypeSymlink, Linkname: "."},
+				{Name: "x", Typeflag: tar.TypeSymlink, Linkname: "y/.."},
+			},
+			contents: []string{"", ""},
+		},
+		{
+			name: "symlink replacing a directory",
+			headers: []*tar.Header{
+				{Name: "a/", Typeflag: tar.TypeDir},
+				{Name: "x", Typeflag: tar.TypeSymlink, Linkname: "a/.."},
+				{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "."},
+			},
+			contents: []string{"", "", ""},
+		},
+		{
+			name: "dotdot below a later symlink",
+			headers: []*tar.Header{
+				{Name: "x", Typeflag: tar.TypeSymlink, Linkname: "m/.."},
+				{Name: "m", Typeflag: tar.TypeSymlink, Linkname: "."},
+			},
+			contents: []string{"", ""},
+		},
+		{
+			name: "hard link to symlink",
+			headers: []*tar.Header{
+				{Name: "a/b/l", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+				{Name: "l2", Typeflag: tar.TypeLink, Linkname: "a/b/l"},
+			},
+			contents: []string{"", ""},
+		},
+		{
+			name:     "hard link outside",
+			headers:  []*tar.Header{{Name: "hl", Typeflag: tar.TypeLink, Linkname: "../secret"}},
+			contents: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildTar(t, tt.headers, tt.contents)
+			parent := t.TempDir()
+			dst := filepath.Join(parent, "dst")
+			err := ExtractReader(bytes.NewReader(data), Tar, dst, nil)
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Errorf("ExtractReader() error = %v, want %v", err, ErrUnsafePath)
+			}
+			if iutils.FileExists(filepath.Join(parent, "evil.txt")) {
+				t.Errorf("entry escaped the destination")
+			}
+		})
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	data := buildTar(t, []*tar.Header{
+		{Name: "a", Typeflag: tar.TypeReg},
+		{Name: "b", Typeflag: tar.TypeReg},
+	}, []string{"0123456789", "0123456789"})
+
+	tests := []struct {
+		name string
+		opts *Options
+	}{
+		{"max file size", &Options{MaxFileSize: 5}},
+		{"max total size", &Options{MaxTotalSize: 15}},
+		{"max files", &Options{MaxFiles: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ExtractReader(bytes.NewReader(data), Tar, t.TempDir(), tt.opts)
+			if !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("ExtractReader() error = %v, want %v", err, ErrLimitExceeded)
+			}
+		})
+	}
+
+	if err := ExtractReader(bytes.NewReader(data), Tar, t.TempDir(), &Options{MaxTotalSize: 20}); err != nil {
+		t.Errorf("ExtractReader() within limits error = %v", err)
+	}
+}
+
+func TestExtractDotEntry(t *testing.T) {
+	// tar -C dir -cf x.tar . starts with a "./" entry.
+	data := buildTar(t, []*tar.Header{
+		{Name: "./", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./a.txt", Typeflag: tar.TypeReg},
+		{Name: "./sub/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./sub/b.txt", Typeflag: tar.TypeReg},
+	}, []string{"", "a", "", "b"})
+
+	dst := t.TempDir()
+	if err := ExtractReader(bytes.NewReader(data), Tar, dst, nil); err != nil {
+		t.Fatalf("ExtractReader() error = %v", err)
+	}
+	for name, want := range map[string]string{"a.txt": "a", "sub/b.txt": "b"} {
+		if got, err := os.ReadFile(filepath.Join(dst, name)); err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestExtractSymlinks(t *testing.T) {
+	data := buildTar(t, []*tar.Header{
+		{Name: "lib/libfoo.so.1.2", Typeflag: tar.TypeReg},
+		{Name: "lib/libfoo.so.1", Typeflag: tar.TypeSymlink, Linkname: "libfoo.so.1.2"},
+		{Name: "lib/libfoo.so", Typeflag: tar.TypeSymlink, Linkname: "libfoo.so.1"},
+		{Name: "bin/foo", Typeflag: tar.TypeSymlink, Linkname: "../lib/libfoo.so"},
+	}, []string{"elf", "", "", ""})
+
+	dst := t.TempDir()
+	if err := ExtractReader(bytes.NewReader(data), Tar, dst, nil); err != nil {
+		t.Fatalf("ExtractReader() error = %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dst, "bin", "foo")); err != nil || string(got) != "elf" {
+		t.Errorf("bin/foo = %q, %v", got, err)
+	}
+}
+
+func TestExtractZipSlip(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "evil.zip")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(file)
+	w, err := zw.Create("../../evil.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("x"))
+	zw.Close()
+	file.Close()
+
+	if err := Extract(archivePath, t.TempDir(), nil); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("Extract() error = %v, want %v", err, ErrUnsafePath)
+	}
+}
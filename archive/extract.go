@@ -0,0 +1,420 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Extract unpacks archivePath into dstDir, creating dstDir if needed.
+// Entries that would land outside dstDir, through their name or through a
+// symlink or hard link, are rejected with ErrUnsafePath, and the limits in
+// opts guard against decompression bombs.
+func Extract(archivePath, dstDir string, opts *Options) error {
+	format, err := opts.format(archivePath)
+	if err != nil {
+		return err
+	}
+
+	if format == Zip {
+		zr, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		return extractZip(&zr.Reader, dstDir, opts)
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return ExtractReader(file, format, dstDir, opts)
+}
+
+// ExtractReader unpacks a tar based archive streamed from r into dstDir.
+// Zip archives need random access and must be opened with Extract.
+func ExtractReader(r io.Reader, format Format, dstDir string, opts *Options) error {
+	switch format {
+	case Tar:
+		return extractTar(r, dstDir, opts)
+	case TarGz, TarZst:
+		c, err := lookupCompressor(format)
+		if err != nil {
+			return err
+		}
+		cr, err := c.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer cr.Close()
+		return extractTar(cr, dstDir, opts)
+	}
+	return fmt.Errorf("%w: cannot stream %v", ErrUnsupportedFormat, format)
+}
+
+func extractTar(r io.Reader, dstDir string, opts *Options) error {
+	x, err := newExtractor(dstDir, opts)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name, target, err := x.target(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			continue
+		}
+		if err := x.countEntry(hdr.Size); err != nil {
+			return err
+		}
+
+		mode := fs.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.mkdir(target, mode)
+		case tar.TypeReg, tar.TypeRegA:
+			err = x.writeFile(target, tr, mode)
+		case tar.TypeSymlink:
+			err = x.symlink(name, target, hdr.Linkname)
+		case tar.TypeLink:
+			err = x.hardlink(target, hdr.Linkname)
+		default:
+			// Devices, fifos and other special files are skipped.
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(zr *zip.Reader, dstDir string, opts *Options) error {
+	x, err := newExtractor(dstDir, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		name, target, err := x.target(f.Name)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			continue
+		}
+		if err := x.countEntry(int64(f.UncompressedSize64)); err != nil {
+			return err
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.mkdir(target, mode.Perm())
+		case mode&fs.ModeSymlink != 0:
+			err = x.extractZipSymlink(f, name, target)
+		case mode.IsRegular():
+			err = x.extractZipFile(f, target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extractor) extractZipFile(f *zip.File, target string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return x.writeFile(target, rc, f.Mode().Perm())
+}
+
+func (x *extractor) extractZipSymlink(f *zip.File, name, target string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	link, err := io.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return err
+	}
+	return x.symlink(name, target, string(link))
+}
+
+// extractor enforces the destination and limits of one extraction.
+type extractor struct {
+	dstDir string
+	opts   Options
+	files  int
+	total  int64
+}
+
+func newExtractor(dstDir string, opts *Options) (*extractor, error) {
+	abs, err := filepath.Abs(dstDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, err
+	}
+
+	x := &extractor{dstDir: abs}
+	if opts != nil {
+		x.opts = *opts
+	}
+	return x, nil
+}
+
+// target validates an entry name and returns its clean slash separated
+// form and its path on disk. An empty target means the entry names the
+// destination directory itself and is skipped.
+func (x *extractor) target(name string) (string, string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if path.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	clean := path.Clean(name)
+	if clean == "." {
+		return clean, "", nil
+	}
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	return clean, filepath.Join(x.dstDir, filepath.FromSlash(clean)), nil
+}
+
+// countEntry checks the entry count and the declared size of an entry.
+// The actual size is checked again while the data is copied.
+func (x *extractor) countEntry(size int64) error {
+	x.files++
+	if x.opts.MaxFiles > 0 && x.files > x.opts.MaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrLimitExceeded, x.opts.MaxFiles)
+	}
+	if x.opts.MaxFileSize > 0 && size > x.opts.MaxFileSize {
+		return fmt.Errorf("%w: entry of %d bytes", ErrLimitExceeded, size)
+	}
+	return nil
+}
+
+func (x *extractor) mkdir(target string, mode fs.FileMode) error {
+	if err := x.checkParents(target); err != nil {
+		return err
+	}
+	// Keep directories writable so their content can be extracted.
+	return os.MkdirAll(target, mode|0700)
+}
+
+// checkParents rejects targets whose parent directories contain a
+// symlink. Following one could place an entry, or the target of a relative
+// symlink, outside dstDir.
+func (x *extractor) checkParents(target string) error {
+	rel, err := filepath.Rel(x.dstDir, filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+
+	dir := x.dstDir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s is below a symlink", ErrUnsafePath, target)
+		}
+	}
+	return nil
+}
+
+func (x *extractor) writeFile(target string, r io.Reader, mode fs.FileMode) error {
+	if err := x.checkParents(target); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	// Never write through a symlink that is already at the target.
+	if err := x.removeExisting(target); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	limit := int64(-1)
+	if x.opts.MaxFileSize > 0 {
+		limit = x.opts.MaxFileSize
+	}
+	if x.opts.MaxTotalSize > 0 {
+		if remaining := x.opts.MaxTotalSize - x.total; limit < 0 || remaining < limit {
+			limit = remaining
+		}
+	}
+
+	var n int64
+	if limit < 0 {
+		n, err = io.Copy(file, r)
+	} else {
+		n, err = io.Copy(file, io.LimitReader(r, limit+1))
+		if err == nil && n > limit {
+			err = fmt.Errorf("%w: %s is too large", ErrLimitExceeded, target)
+		}
+	}
+	x.total += n
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// symlink creates a symlink whose target must resolve inside dstDir.
+func (x *extractor) symlink(name, target, link string) error {
+	link = strings.ReplaceAll(link, `\`, "/")
+	if err := x.checkParents(target); err != nil {
+		return err
+	}
+	if err := x.checkLink(name, link); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := x.removeExisting(target); err != nil {
+		return err
+	}
+	return os.Symlink(filepath.FromSlash(link), target)
+}
+
+// checkLink rejects the target link of the symlink name unless it stays
+// inside dstDir. Chained symlinks do not resolve the way the target reads
+// lexically, so the target is walked against what is already extracted:
+// it may not go through an existing symlink, nor use ".." below a
+// component that does not exist yet and could become a symlink later.
+func (x *extractor) checkLink(name, link string) error {
+	unsafe := fmt.Errorf("%w: symlink %s -> %s", ErrUnsafePath, name, link)
+	if path.IsAbs(link) || filepath.VolumeName(link) != "" {
+		return unsafe
+	}
+
+	var parts []string
+	if dir := path.Dir(name); dir != "." {
+		parts = strings.Split(dir, "/")
+	}
+	comps := strings.Split(link, "/")
+	last := len(comps) - 1
+	for last >= 0 && (comps[last] == "" || comps[last] == ".") {
+		last--
+	}
+	missing := false
+	for i, part := range comps[:last+1] {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(parts) == 0 || missing {
+				return unsafe
+			}
+			parts = parts[:len(parts)-1]
+			continue
+		}
+		parts = append(parts, part)
+		// The final component may be a symlink: it was checked where it
+		// was extracted.
+		if missing || i == last {
+			continue
+		}
+		info, err := os.Lstat(filepath.Join(x.dstDir, filepath.FromSlash(strings.Join(parts, "/"))))
+		if errors.Is(err, fs.ErrNotExist) {
+			missing = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return unsafe
+		}
+	}
+	return nil
+}
+
+// removeExisting removes what is at target before an entry replaces it.
+// Directories are never replaced, so that the symlink targets checked
+// against them stay valid.
+func (x *extractor) removeExisting(target string) error {
+	info, err := os.Lstat(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%w: %s would replace a directory", ErrUnsafePath, target)
+	}
+	return os.Remove(target)
+}
+
+// hardlink links target to another entry of the archive.
+func (x *extractor) hardlink(target, linkName string) error {
+	_, oldPath, err := x.target(linkName)
+	if err != nil {
+		return err
+	}
+	if oldPath == "" {
+		return fmt.Errorf("%w: hard link to %s", ErrUnsafePath, linkName)
+	}
+	if err := x.checkParents(oldPath); err != nil {
+		return err
+	}
+	if err := x.checkParents(target); err != nil {
+		return err
+	}
+
+	// A hard link to a symlink copies its relative target to another
+	// directory, where it was never checked.
+	if info, err := os.Lstat(oldPath); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		return fmt.Errorf("%w: hard link to symlink %s", ErrUnsafePath, linkName)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := x.removeExisting(target); err != nil {
+		return err
+	}
+	return os.Link(oldPath, target)
+}
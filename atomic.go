@@ -0,0 +1,224 @@
+package iutils
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrAtomicFileClosed is returned when writing to an AtomicFile that has
+// already been committed or aborted.
+var ErrAtomicFileClosed = errors.New("iutils: atomic file already closed")
+
+// AtomicFile is an io.WriteCloser that publishes its content to filename
+// only when Commit is called. Data is written to a temporary file in the
+// same directory as filename, so the final rename never crosses a
+// filesystem boundary. Close without Commit discards the temporary file
+// and leaves any existing file untouched.
+type AtomicFile struct {
+	file     *os.File
+	filename string
+	perm     fs.FileMode
+	sync     SyncPolicy
+	done     bool
+}
+
+// SyncPolicy controls how much an AtomicFile flushes to disk on Commit.
+type SyncPolicy int
+
+const (
+	// SyncFull syncs the file before the rename and the directory after it.
+	SyncFull SyncPolicy = iota
+	// SyncFileOnly syncs the file but not the directory.
+	SyncFileOnly
+	// SyncNone skips all syncs; the rename is still atomic but may be lost
+	// on power failure.
+	SyncNone
+)
+
+// AtomicOptions configures NewAtomicFile. A nil *AtomicOptions uses the
+// defaults: mode 0644, SyncFull and no directory creation.
+type AtomicOptions struct {
+	// Perm is the mode of a newly created file. An existing file keeps its
+	// own mode and owner.
+	Perm fs.FileMode
+	// Sync selects the fsync policy on Commit.
+	Sync SyncPolicy
+	// MkdirAll creates missing parent directories with DirPerm.
+	MkdirAll bool
+	// DirPerm is the mode of directories created by MkdirAll, 0755 if zero.
+	DirPerm fs.FileMode
+}
+
+// CreateAtomicFile starts an atomic write of filename with the default
+// options. If filename already exists, its mode and owner are carried over
+// to the new file.
+func CreateAtomicFile(filename string) (*AtomicFile, error) {
+	return NewAtomicFile(filename, nil)
+}
+
+// NewAtomicFile starts an atomic write of filename. The returned writer can
+// be fed with io.Copy; call Commit to publish the content or Close/Abort to
+// discard it.
+func NewAtomicFile(filename string, opts *AtomicOptions) (*AtomicFile, error) {
+	if opts == nil {
+		opts = &AtomicOptions{}
+	}
+	perm := opts.Perm
+	if perm == 0 {
+		perm = 0644
+	}
+
+	dirName, baseName := filepath.Split(filename)
+	if baseName == "" {
+		return nil, &fs.PathError{Op: "create", Path: filename, Err: fs.ErrInvalid}
+	}
+	if dirName == "" {
+		dirName = "."
+	}
+
+	if opts.MkdirAll {
+		if err := mkdirParent(filename, opts.DirPerm); err != nil {
+			return nil, err
+		}
+	}
+
+	tempFile, err := os.CreateTemp(dirName, ".tmp-"+baseName+"-*")
+	if err != nil {
+		return nil, err
+	}
+
+	af := &AtomicFile{file: tempFile, filename: filename, perm: perm, sync: opts.Sync}
+	if err := af.applyMetadata(); err != nil {
+		af.Abort()
+		return nil, err
+	}
+	return af, nil
+}
+
+// applyMetadata gives the temporary file the mode and owner of the file it
+// is going to replace, or the default permission for a new file.
+func (af *AtomicFile) applyMetadata() error {
+	info, err := os.Stat(af.filename)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return af.file.Chmod(af.perm)
+		}
+		return err
+	}
+
+	if err := af.file.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if uid, gid, ok := fileOwner(info); ok {
+		// Changing ownership usually needs privileges; keep going if we
+		// are not allowed to.
+		_ = af.file.Chown(uid, gid)
+	}
+	return nil
+}
+
+// Name returns the destination filename.
+func (af *AtomicFile) Name() string {
+	return af.filename
+}
+
+// Write writes p to the temporary file.
+func (af *AtomicFile) Write(p []byte) (int, error) {
+	if af.done {
+		return 0, ErrAtomicFileClosed
+	}
+	return af.file.Write(p)
+}
+
+// ReadFrom lets io.Copy use the kernel fast paths of *os.File.
+func (af *AtomicFile) ReadFrom(r io.Reader) (int64, error) {
+	if af.done {
+		return 0, ErrAtomicFileClosed
+	}
+	return af.file.ReadFrom(r)
+}
+
+// Commit flushes the temporary file to disk, renames it over the
+// destination and syncs the directory so the rename is durable.
+func (af *AtomicFile) Commit() error {
+	if af.done {
+		return ErrAtomicFileClosed
+	}
+	af.done = true
+
+	tempName := af.file.Name()
+	defer func() {
+		_ = os.Remove(tempName) // No-op once the rename has succeeded.
+	}()
+
+	if af.sync != SyncNone {
+		if err := af.file.Sync(); err != nil {
+			_ = af.file.Close()
+			return err
+		}
+	}
+	if err := af.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tempName, af.filename); err != nil {
+		return err
+	}
+	if af.sync == SyncFull {
+		return syncDir(filepath.Dir(af.filename))
+	}
+	return nil
+}
+
+// Abort discards the temporary file. It is safe to call after Commit.
+func (af *AtomicFile) Abort() error {
+	if af.done {
+		return nil
+	}
+	af.done = true
+
+	err := af.file.Close()
+	if rmErr := os.Remove(af.file.Name()); rmErr != nil && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// Close is the same as Abort, so a deferred Close cleans up after an
+// error path without publishing a partial file.
+func (af *AtomicFile) Close() error {
+	return af.Abort()
+}
+
+// writeFileAtomic writes data to filename through an AtomicFile.
+func writeFileAtomic(filename string, data []byte, opts *AtomicOptions) error {
+	af, err := NewAtomicFile(filename, opts)
+	if err != nil {
+		return err
+	}
+	defer af.Close()
+
+	if _, err := af.Write(data); err != nil {
+		return err
+	}
+	return af.Commit()
+}
+
+// mkdirParent creates the parent directory of filename if it is missing.
+func mkdirParent(filename string, perm fs.FileMode) error {
+	if perm == 0 {
+		perm = 0755
+	}
+
+	// 分离文件名和路径
+	dirName := filepath.Dir(filename)
+
+	// 检查目录是否存在，不存在则创建
+	if _, err := os.Stat(dirName); os.IsNotExist(err) {
+		// 使用 MkdirAll 创建缺失的多级目录
+		return os.MkdirAll(dirName, perm)
+	}
+	return nil
+}
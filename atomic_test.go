@@ -0,0 +1,170 @@
+package iutils
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAtomicFileCommit(t *testing.T) {
+	tempDir := t.TempDir()
+	filename := filepath.Join(tempDir, "data.bin")
+
+	af, err := CreateAtomicFile(filename)
+	if err != nil {
+		t.Fatalf("CreateAtomicFile() error = %v", err)
+	}
+	defer af.Close()
+
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+	if _, err := io.Copy(af, bytes.NewReader(payload)); err != nil {
+		t.Fatalf("io.Copy() error = %v", err)
+	}
+
+	if FileExists(filename) {
+		t.Errorf("destination exists before Commit")
+	}
+
+	if err := af.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, payload) {
+		t.Errorf("content mismatch after Commit")
+	}
+
+	if _, err := af.Write([]byte("x")); err != ErrAtomicFileClosed {
+		t.Errorf("Write() after Commit error = %v, want %v", err, ErrAtomicFileClosed)
+	}
+
+	assertNoTempFiles(t, tempDir)
+}
+
+func TestAtomicFileAbort(t *testing.T) {
+	tempDir := t.TempDir()
+	filename := filepath.Join(tempDir, "data.txt")
+	if err := os.WriteFile(filename, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	af, err := CreateAtomicFile(filename)
+	if err != nil {
+		t.Fatalf("CreateAtomicFile() error = %v", err)
+	}
+	if _, err := af.Write([]byte("partial")); err != nil {
+		t.Fatal(err)
+	}
+	if err := af.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "original" {
+		t.Errorf("content = %q, want %q", content, "original")
+	}
+
+	assertNoTempFiles(t, tempDir)
+}
+
+func TestWriteFile3PreservesMode(t *testing.T) {
+	tempDir := t.TempDir()
+	filename := filepath.Join(tempDir, "script.sh")
+	if err := os.WriteFile(filename, []byte("old"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filename, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile3(filename, []byte("new")); err != nil {
+		t.Fatalf("WriteFile3() error = %v", err)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("mode = %v, want %v", info.Mode().Perm(), os.FileMode(0700))
+	}
+}
+
+func TestWriteFile3MissingDir(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "missing", "file.txt")
+	if err := WriteFile3(filename, []byte("data")); err == nil {
+		t.Errorf("WriteFile3() expected error for missing directory")
+	}
+}
+
+func assertNoTempFiles(t *testing.T, dirName string) {
+	t.Helper()
+	entries, err := os.ReadDir(dirName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".tmp-") {
+			t.Errorf("leftover temp file %s", entry.Name())
+		}
+	}
+}
+
+func TestNewAtomicFileOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		opts     *AtomicOptions
+		wantPerm os.FileMode
+		wantErr  bool
+	}{
+		{"default", "a.txt", nil, 0644, false},
+		{"perm", "b.txt", &AtomicOptions{Perm: 0600, Sync: SyncFileOnly}, 0600, false},
+		{"mkdir", "sub/dir/c.txt", &AtomicOptions{MkdirAll: true, Sync: SyncNone}, 0644, false},
+		{"missing dir", "nodir/d.txt", nil, 0, true},
+		{"empty name", "", nil, 0, true},
+	}
+
+	tempDir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.filename)
+			if tt.filename == "" {
+				filename = tempDir + string(filepath.Separator)
+			}
+
+			af, err := NewAtomicFile(filename, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAtomicFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer af.Close()
+
+			if _, err := af.Write([]byte(tt.name)); err != nil {
+				t.Fatal(err)
+			}
+			if err := af.Commit(); err != nil {
+				t.Fatalf("Commit() error = %v", err)
+			}
+
+			info, err := os.Stat(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != tt.wantPerm {
+				t.Errorf("mode = %v, want %v", info.Mode().Perm(), tt.wantPerm)
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+// Package cas implements a content-addressable blob store on local disk.
+//
+// Blobs are named by the SHA-256 of their content and stored under sharded
+// paths, blobs/ab/cd/abcd..., so storing the same content twice keeps one
+// copy. Named refs point at blobs and are the roots of garbage collection.
+package cas
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MDGSF/iutils"
+)
+
+var (
+	// ErrNotFound is returned for blobs and refs that do not exist.
+	ErrNotFound = errors.New("cas: not found")
+	// ErrCorrupt is returned when the content of a blob does not match its
+	// digest.
+	ErrCorrupt = errors.New("cas: blob corrupt")
+	// ErrInvalidDigest is returned for malformed digests.
+	ErrInvalidDigest = errors.New("cas: invalid digest")
+	// ErrInvalidRef is returned for malformed ref names.
+	ErrInvalidRef = errors.New("cas: invalid ref name")
+)
+
+// Digest is the lower-case hex SHA-256 of a blob.
+type Digest string
+
+// ParseDigest parses a hex SHA-256, optionally prefixed with "sha256:".
+func ParseDigest(s string) (Digest, error) {
+	s = strings.ToLower(strings.TrimPrefix(s, "sha256:"))
+	if len(s) != sha256.Size*2 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDigest, s)
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDigest, s)
+	}
+	return Digest(s), nil
+}
+
+// Sum returns the digest of data.
+func Sum(data []byte) Digest {
+	sum := sha256.Sum256(data)
+	return Digest(hex.EncodeToString(sum[:]))
+}
+
+func (d Digest) String() string {
+	return string(d)
+}
+
+func (d Digest) valid() error {
+	_, err := ParseDigest(string(d))
+	if err == nil && string(d) != strings.ToLower(string(d)) {
+		err = fmt.Errorf("%w: %q", ErrInvalidDigest, string(d))
+	}
+	return err
+}
+
+// Options configures Open. A nil *Options uses two levels of two hex
+// characters each.
+type Options struct {
+	// ShardLevels is the number of directory levels, 2 if zero.
+	ShardLevels int
+	// ShardWidth is the number of hex characters per level, 2 if zero.
+	ShardWidth int
+}
+
+// Store is a blob store rooted at a directory. It is safe for concurrent
+// use, also by several processes sharing the directory: GC holds an
+// exclusive lock on the store while puts and SetRef hold shared ones.
+type Store struct {
+	root   string
+	levels int
+	width  int
+}
+
+// Open opens the store at root, creating its directories if needed.
+func Open(root string, opts *Options) (*Store, error) {
+	s := &Store{root: root, levels: 2, width: 2}
+	if opts != nil {
+		if opts.ShardLevels > 0 {
+			s.levels = opts.ShardLevels
+		}
+		if opts.ShardWidth > 0 {
+			s.width = opts.ShardWidth
+		}
+	}
+	if s.levels*s.width > sha256.Size*2 {
+		return nil, fmt.Errorf("cas: %d levels of %d characters exceed the digest", s.levels, s.width)
+	}
+	for _, dir := range []string{"blobs", "refs", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// lock takes the GC lock of the store, shared for puts and refs and
+// exclusive for GC.
+func (s *Store) lock(shared bool) (*iutils.FileLock, error) {
+	return iutils.LockFile(context.Background(), filepath.Join(s.root, "gc.lock"), &iutils.LockOptions{Shared: shared})
+}
+
+// Root returns the directory of the store.
+func (s *Store) Root() string {
+	return s.root
+}
+
+// Path returns the file holding the blob d.
+func (s *Store) Path(d Digest) string {
+	parts := []string{s.root, "blobs"}
+	for i := 0; i < s.levels; i++ {
+		parts = append(parts, string(d[i*s.width:(i+1)*s.width]))
+	}
+	return filepath.Join(append(parts, string(d))...)
+}
+
+// Put stores the content of r and returns its digest and size. The
+// content is streamed to a temporary file, so it never has to fit in
+// memory. Storing content that is already present keeps the existing
+// blob.
+func (s *Store) Put(r io.Reader) (Digest, int64, error) {
+	return s.put(r, "")
+}
+
+// PutExpected is Put for content whose digest is known in advance, e.g.
+// from an upload request. It fails with ErrCorrupt if the content does
+// not match, and stores nothing.
+func (s *Store) PutExpected(r io.Reader, want Digest) (int64, error) {
+	if err := want.valid(); err != nil {
+		return 0, err
+	}
+	_, size, err := s.put(r, want)
+	return size, err
+}
+
+// PutBytes stores data.
+func (s *Store) PutBytes(data []byte) (Digest, error) {
+	d, _, err := s.Put(bytes.NewReader(data))
+	return d, err
+}
+
+// PutFile stores the content of filename.
+func (s *Store) PutFile(filename string) (Digest, int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	return s.Put(file)
+}
+
+func (s *Store) put(r io.Reader, want Digest) (Digest, int64, error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.root, "tmp"), "put-*")
+	if err != nil {
+		return "", 0, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		return "", 0, err
+	}
+	d := Digest(hex.EncodeToString(h.Sum(nil)))
+	if want != "" && d != want {
+		return "", 0, fmt.Errorf("%w: content is %s, want %s", ErrCorrupt, d, want)
+	}
+
+	// GC cannot remove the blob between the check below and the return.
+	lock, err := s.lock(true)
+	if err != nil {
+		return "", 0, err
+	}
+	defer lock.Unlock()
+
+	path := s.Path(d)
+	if _, err := os.Stat(path); err == nil {
+		// Already stored. Refresh the time so that the next GC treats the
+		// blob as new. If it was deleted in the meantime, store it again.
+		now := time.Now()
+		err := os.Chtimes(path, now, now)
+		if err == nil {
+			return d, size, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", 0, err
+		}
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+	if err := os.Chmod(tmp.Name(), 0444); err != nil {
+		return "", 0, err
+	}
+	var created []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		created = append(created, dir)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, err
+	}
+	// Concurrent puts of the same content rename identical files, so the
+	// last one winning is harmless.
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, err
+	}
+	committed = true
+	// Sync the new entry, and those of the shard directories just created.
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return "", 0, err
+	}
+	for _, dir := range created {
+		if err := syncDir(filepath.Dir(dir)); err != nil {
+			return "", 0, err
+		}
+	}
+	return d, size, nil
+}
+
+// syncDir makes the entries of dir durable.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+// Has reports whether the blob d is stored.
+func (s *Store) Has(d Digest) bool {
+	if d.valid() != nil {
+		return false
+	}
+	return iutils.FileExists(s.Path(d))
+}
+
+// Size returns the size of the blob d.
+func (s *Store) Size(d Digest) (int64, error) {
+	if err := d.valid(); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(s.Path(d))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("blob %s: %w", d, ErrNotFound)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Get opens the blob d for reading. The content is verified while it is
+// read: the reader returns ErrCorrupt instead of io.EOF if it does not
+// match d.
+func (s *Store) Get(d Digest) (io.ReadCloser, error) {
+	if err := d.valid(); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(s.Path(d))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("blob %s: %w", d, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &verifyingReader{file: file, digest: d, h: sha256.New()}, nil
+}
+
+// GetBytes reads and verifies the blob d.
+func (s *Store) GetBytes(d Digest) ([]byte, error) {
+	rc, err := s.Get(d)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// Verify checks that the content of the blob d matches its digest.
+func (s *Store) Verify(d Digest) error {
+	rc, err := s.Get(d)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(io.Discard, rc)
+	return err
+}
+
+type verifyingReader struct {
+	file   *os.File
+	digest Digest
+	h      hash.Hash
+	err    error
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	n, err := v.file.Read(p)
+	v.h.Write(p[:n])
+	if err == io.EOF {
+		if got := Digest(hex.EncodeToString(v.h.Sum(nil))); got != v.digest {
+			err = fmt.Errorf("blob %s: %w: content is %s", v.digest, ErrCorrupt, got)
+		}
+	}
+	if err != nil {
+		v.err = err
+	}
+	return n, err
+}
+
+func (v *verifyingReader) Close() error {
+	return v.file.Close()
+}
+
+// Delete removes the blob d. Refs to it are left dangling.
+func (s *Store) Delete(d Digest) error {
+	if err := d.valid(); err != nil {
+		return err
+	}
+	err := os.Remove(s.Path(d))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("blob %s: %w", d, ErrNotFound)
+	}
+	return err
+}
+
+// Walk calls fn for every stored blob, in no particular order. Files that
+// are not named like blobs are skipped.
+func (s *Store) Walk(fn func(d Digest, info fs.FileInfo) error) error {
+	return filepath.WalkDir(filepath.Join(s.root, "blobs"), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		d := Digest(entry.Name())
+		if d.valid() != nil || s.Path(d) != path {
+			return nil
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fn(d, info)
+	})
+}
@@ -0,0 +1,291 @@
+package cas
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseDigest(t *testing.T) {
+	valid := strings.Repeat("ab", 32)
+	tests := []struct {
+		in      string
+		want    Digest
+		wantErr bool
+	}{
+		{valid, Digest(valid), false},
+		{"sha256:" + strings.ToUpper(valid), Digest(valid), false},
+		{valid[:62], "", true},
+		{strings.Repeat("zz", 32), "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDigest(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseDigest(%q) = %q, %v", tt.in, got, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidDigest) {
+			t.Errorf("ParseDigest(%q) error = %v, want %v", tt.in, err, ErrInvalidDigest)
+		}
+	}
+}
+
+func TestStorePutGet(t *testing.T) {
+	s, err := Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := s.PutBytes([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := Sum([]byte("hello")); d != want || d != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("PutBytes() = %s, want %s", d, want)
+	}
+	rel, _ := filepath.Rel(s.Root(), s.Path(d))
+	if want := filepath.Join("blobs", "2c", "f2", string(d)); rel != want {
+		t.Errorf("Path() = %s, want %s", rel, want)
+	}
+
+	// Storing the same content again keeps one copy.
+	d2, size, err := s.Put(strings.NewReader("hello"))
+	if err != nil || d2 != d || size != 5 {
+		t.Errorf("Put() of duplicate = %s, %d, %v", d2, size, err)
+	}
+	count := 0
+	s.Walk(func(Digest, fs.FileInfo) error { count++; return nil })
+	if count != 1 {
+		t.Errorf("Walk() found %d blobs, want 1", count)
+	}
+
+	if data, err := s.GetBytes(d); err != nil || string(data) != "hello" {
+		t.Errorf("GetBytes() = %q, %v", data, err)
+	}
+	if n, err := s.Size(d); err != nil || n != 5 {
+		t.Errorf("Size() = %d, %v", n, err)
+	}
+	missing := Sum([]byte("missing"))
+	if _, err := s.Get(missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of missing blob error = %v, want %v", err, ErrNotFound)
+	}
+	if s.Has(missing) || !s.Has(d) {
+		t.Errorf("Has() disagrees with the store")
+	}
+
+	if _, err := s.PutExpected(strings.NewReader("hellO"), d); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("PutExpected() of wrong content error = %v, want %v", err, ErrCorrupt)
+	}
+	if size, err := s.PutExpected(strings.NewReader("hello"), d); err != nil || size != 5 {
+		t.Errorf("PutExpected() = %d, %v", size, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(s.Root(), "tmp")); len(entries) != 0 {
+		t.Errorf("%d temporary files left", len(entries))
+	}
+
+	if err := s.Delete(d); err != nil || s.Has(d) {
+		t.Errorf("Delete() = %v, Has() = %v", err, s.Has(d))
+	}
+}
+
+func TestStoreVerifiesOnRead(t *testing.T) {
+	s, err := Open(t.TempDir(), &Options{ShardLevels: 1, ShardWidth: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := s.PutBytes([]byte("original"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(filepath.Dir(s.Path(d))) != string(d[:3]) {
+		t.Errorf("Path() = %s, want one level of 3 characters", s.Path(d))
+	}
+
+	os.Chmod(s.Path(d), 0644)
+	if err := os.WriteFile(s.Path(d), []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetBytes(d); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("GetBytes() of tampered blob error = %v, want %v", err, ErrCorrupt)
+	}
+	if err := s.Verify(d); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Verify() of tampered blob error = %v, want %v", err, ErrCorrupt)
+	}
+}
+
+func TestStoreStreaming(t *testing.T) {
+	s, err := Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 3<<20+17)
+	rand.Read(data)
+
+	// Concurrent puts of the same content agree on one blob.
+	var wg sync.WaitGroup
+	digests := make([]Digest, 4)
+	for i := range digests {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			d, _, err := s.Put(io.MultiReader(bytes.NewReader(data[:1<<20]), bytes.NewReader(data[1<<20:])))
+			if err != nil {
+				t.Error(err)
+			}
+			digests[i] = d
+		}(i)
+	}
+	wg.Wait()
+	for _, d := range digests[1:] {
+		if d != digests[0] {
+			t.Fatalf("digests differ: %v", digests)
+		}
+	}
+
+	rc, err := s.Get(digests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var got bytes.Buffer
+	if _, err := io.CopyBuffer(&got, rc, make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), data) {
+		t.Errorf("Get() returned different content")
+	}
+}
+
+func TestStoreRefsAndGC(t *testing.T) {
+	s, err := Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(content string, age time.Duration) Digest {
+		d, err := s.PutBytes([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-age)
+		os.Chtimes(s.Path(d), old, old)
+		return d
+	}
+	kept := put("kept", 2*time.Hour)
+	pinned := put("pinned", 2*time.Hour)
+	garbage := put("garbage", 2*time.Hour)
+	fresh := put("fresh", 0)
+
+	if err := s.SetRef("releases/v1", kept); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetRef("dangling", Sum([]byte("nothing"))); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetRef() to missing blob error = %v, want %v", err, ErrNotFound)
+	}
+	for _, name := range []string{"", "../x", "a/.hidden", "/abs"} {
+		if err := s.SetRef(name, kept); !errors.Is(err, ErrInvalidRef) {
+			t.Errorf("SetRef(%q) error = %v, want %v", name, err, ErrInvalidRef)
+		}
+	}
+	if d, err := s.Ref("releases/v1"); err != nil || d != kept {
+		t.Errorf("Ref() = %s, %v", d, err)
+	}
+	refs, err := s.Refs()
+	if err != nil || len(refs) != 1 || refs["releases/v1"] != kept {
+		t.Errorf("Refs() = %v, %v", refs, err)
+	}
+
+	stats, err := s.GC(&GCOptions{Keep: []Digest{pinned}, DryRun: true})
+	if err != nil || stats.Removed != 1 || !s.Has(garbage) {
+		t.Errorf("GC(DryRun) = %+v, %v", stats, err)
+	}
+	stats, err = s.GC(&GCOptions{Keep: []Digest{pinned}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Blobs != 4 || stats.Removed != 1 || stats.RemovedBytes != 7 || stats.RemovedDigests[0] != garbage {
+		t.Errorf("GC() = %+v", stats)
+	}
+	if s.Has(garbage) || !s.Has(kept) || !s.Has(pinned) || !s.Has(fresh) {
+		t.Errorf("GC() removed the wrong blobs")
+	}
+
+	if err := s.DeleteRef("releases/v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Ref("releases/v1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Ref() after DeleteRef error = %v, want %v", err, ErrNotFound)
+	}
+	stats, err = s.GC(&GCOptions{GracePeriod: -1})
+	if err != nil || stats.Removed != 3 {
+		t.Errorf("GC() without grace = %+v, %v", stats, err)
+	}
+}
+
+func TestStoreConcurrentGC(t *testing.T) {
+	s, err := Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for round := 0; round < 20; round++ {
+		var digests []Digest
+		for i := 0; i < 50; i++ {
+			d, err := s.PutBytes([]byte{byte(round), byte(i)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			old := time.Now().Add(-2 * time.Hour)
+			os.Chtimes(s.Path(d), old, old)
+			digests = append(digests, d)
+		}
+
+		// Blobs put again, or referenced, while GC runs must survive it.
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := s.GC(nil); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i, d := range digests {
+				if i%2 == 0 {
+					if _, err := s.PutBytes([]byte{byte(round), byte(i)}); err != nil {
+						t.Error(err)
+					}
+				} else if err := s.SetRef("r/"+d.String(), d); err != nil {
+					if !errors.Is(err, ErrNotFound) {
+						t.Error(err)
+					}
+					continue
+				}
+				if !s.Has(d) {
+					t.Errorf("round %d: blob %d reported stored but removed by GC", round, i)
+				}
+			}
+		}()
+		wg.Wait()
+		if t.Failed() {
+			return
+		}
+	}
+	// Check again after all GCs: refs must not dangle.
+	refs, err := s.Refs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, d := range refs {
+		if !s.Has(d) {
+			t.Errorf("ref %s points at a removed blob", name)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package cas
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MDGSF/iutils"
+)
+
+// checkRef validates a ref name: slash-separated components that do not
+// start with a dot, such as "releases/v1.2".
+func checkRef(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return fmt.Errorf("%w: %q", ErrInvalidRef, name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return fmt.Errorf("%w: %q", ErrInvalidRef, name)
+		}
+	}
+	return nil
+}
+
+func (s *Store) refPath(name string) string {
+	return filepath.Join(s.root, "refs", filepath.FromSlash(name))
+}
+
+// SetRef points the ref name at the blob d, which must be stored. Refs keep
+// their blobs alive across GC.
+func (s *Store) SetRef(name string, d Digest) error {
+	if err := checkRef(name); err != nil {
+		return err
+	}
+	lock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if !s.Has(d) {
+		return fmt.Errorf("blob %s: %w", d, ErrNotFound)
+	}
+	af, err := iutils.NewAtomicFile(s.refPath(name), &iutils.AtomicOptions{MkdirAll: true})
+	if err != nil {
+		return err
+	}
+	defer af.Close()
+	if _, err := af.Write([]byte(string(d) + "\n")); err != nil {
+		return err
+	}
+	return af.Commit()
+}
+
+// Ref returns the blob the ref name points at.
+func (s *Store) Ref(name string) (Digest, error) {
+	if err := checkRef(name); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(s.refPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("ref %s: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	d, err := ParseDigest(strings.TrimSpace(string(data)))
+	if err != nil {
+		return "", fmt.Errorf("ref %s: %w", name, err)
+	}
+	return d, nil
+}
+
+// DeleteRef removes the ref name. The blob stays until the next GC.
+func (s *Store) DeleteRef(name string) error {
+	if err := checkRef(name); err != nil {
+		return err
+	}
+	err := os.Remove(s.refPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("ref %s: %w", name, ErrNotFound)
+	}
+	return err
+}
+
+// Refs returns all refs and the blobs they point at.
+func (s *Store) Refs() (map[string]Digest, error) {
+	refs := make(map[string]Digest)
+	dir := filepath.Join(s.root, "refs")
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if checkRef(name) != nil {
+			// Temporary files of refs being written.
+			return nil
+		}
+		d, err := s.Ref(name)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		refs[name] = d
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// GCOptions configures GC. A nil *GCOptions keeps only referenced blobs
+// and blobs stored within the last hour.
+type GCOptions struct {
+	// Keep lists blobs to keep in addition to the referenced ones.
+	Keep []Digest
+	// GracePeriod keeps blobs stored or re-put more recently than this,
+	// so that a blob put just before its ref is set survives a concurrent
+	// GC. It also applies to abandoned temporary files. One hour if zero;
+	// negative keeps nothing.
+	GracePeriod time.Duration
+	// DryRun only reports what would be removed.
+	DryRun bool
+}
+
+// GCStats reports the result of GC.
+type GCStats struct {
+	Blobs          int // blobs examined
+	Removed        int // blobs removed
+	RemovedBytes   int64
+	RemovedDigests []Digest
+}
+
+// GC removes the blobs that no ref points at, mark-and-sweep style. Puts
+// and SetRef wait while it runs.
+func (s *Store) GC(opts *GCOptions) (*GCStats, error) {
+	if opts == nil {
+		opts = &GCOptions{}
+	}
+	grace := opts.GracePeriod
+	if grace == 0 {
+		grace = time.Hour
+	}
+	lock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	cutoff := time.Now().Add(-grace)
+
+	// Mark.
+	live := make(map[Digest]bool)
+	refs, err := s.Refs()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range refs {
+		live[d] = true
+	}
+	for _, d := range opts.Keep {
+		live[d] = true
+	}
+
+	// Sweep.
+	stats := &GCStats{}
+	err = s.Walk(func(d Digest, info fs.FileInfo) error {
+		stats.Blobs++
+		if live[d] || info.ModTime().After(cutoff) {
+			return nil
+		}
+		if !opts.DryRun {
+			if err := os.Remove(s.Path(d)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		stats.Removed++
+		stats.RemovedBytes += info.Size()
+		stats.RemovedDigests = append(stats.RemovedDigests, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.DryRun {
+		s.removeStaleTemp(cutoff)
+	}
+	return stats, nil
+}
+
+// removeStaleTemp removes temporary files of puts that never finished.
+func (s *Store) removeStaleTemp(cutoff time.Time) {
+	dir := filepath.Join(s.root, "tmp")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
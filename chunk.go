@@ -0,0 +1,258 @@
+package iutils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	// ErrChunkCorrupt is returned when chunk data does not match its plan.
+	ErrChunkCorrupt = errors.New("iutils: chunk does not match plan")
+	// ErrChunkPlanMismatch is returned when a receiver is resumed with a
+	// different plan than the one recorded in its state file.
+	ErrChunkPlanMismatch = errors.New("iutils: chunk plan does not match saved state")
+	// ErrChunksMissing is returned by Finish while chunks are outstanding.
+	ErrChunksMissing = errors.New("iutils: chunks missing")
+)
+
+// ChunkInfo describes one fixed-size piece of a file. Sum is the hex
+// encoded SHA-256 of the chunk data.
+type ChunkInfo struct {
+	Index  int    `json:"index"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Sum    string `json:"sum"`
+}
+
+// ChunkPlan describes how a file is split into chunks. Sum is the hex
+// encoded SHA-256 of the whole file.
+type ChunkPlan struct {
+	FileSize  int64       `json:"fileSize"`
+	ChunkSize int64       `json:"chunkSize"`
+	Sum       string      `json:"sum"`
+	Chunks    []ChunkInfo `json:"chunks"`
+}
+
+// SplitFile reads filename once and returns a plan of chunkSize pieces
+// with per-chunk and whole-file SHA-256 digests.
+func SplitFile(ctx context.Context, filename string, chunkSize int64) (*ChunkPlan, error) {
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	plan := &ChunkPlan{ChunkSize: chunkSize}
+	fileHasher := sha256.New()
+	r := &ctxReader{ctx: ctx, r: file}
+	for {
+		chunkHasher := sha256.New()
+		n, err := io.Copy(io.MultiWriter(fileHasher, chunkHasher), io.LimitReader(r, chunkSize))
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 && plan.FileSize > 0 {
+			break
+		}
+
+		plan.Chunks = append(plan.Chunks, ChunkInfo{
+			Index:  len(plan.Chunks),
+			Offset: plan.FileSize,
+			Size:   n,
+			Sum:    hex.EncodeToString(chunkHasher.Sum(nil)),
+		})
+		plan.FileSize += n
+		if n < chunkSize {
+			break
+		}
+	}
+	plan.Sum = hex.EncodeToString(fileHasher.Sum(nil))
+	return plan, nil
+}
+
+// ReadChunk returns the data of chunk read from filename.
+func ReadChunk(filename string, chunk ChunkInfo) ([]byte, error) {
+	return ReadFileParts(filename, chunk.Offset, chunk.Size)
+}
+
+// chunkState is the content of the sidecar state file.
+type chunkState struct {
+	Plan     *ChunkPlan `json:"plan"`
+	Received []bool     `json:"received"`
+}
+
+// ChunkReceiver reassembles a file from chunks that may arrive in any order
+// and across process restarts. Received data goes to filename + ".part"
+// and progress is recorded in filename + ".chunks.json"; Finish verifies
+// the result and renames it to filename.
+type ChunkReceiver struct {
+	mu        sync.Mutex
+	filename  string
+	partName  string
+	stateName string
+	state     chunkState
+}
+
+// OpenChunkReceiver starts or resumes receiving filename. When a state
+// file exists, plan may be nil to resume with the recorded plan; a non-nil
+// plan must match the recorded one.
+func OpenChunkReceiver(filename string, plan *ChunkPlan) (*ChunkReceiver, error) {
+	cr := &ChunkReceiver{
+		filename:  filename,
+		partName:  filename + ".part",
+		stateName: filename + ".chunks.json",
+	}
+
+	data, err := ReadFile(cr.stateName)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &cr.state); err != nil {
+			return nil, fmt.Errorf("load chunk state %s: %w", cr.stateName, err)
+		}
+		if cr.state.Plan == nil || len(cr.state.Received) != len(cr.state.Plan.Chunks) {
+			return nil, fmt.Errorf("load chunk state %s: %w", cr.stateName, ErrChunkPlanMismatch)
+		}
+		if plan != nil && (plan.Sum != cr.state.Plan.Sum || plan.ChunkSize != cr.state.Plan.ChunkSize) {
+			return nil, ErrChunkPlanMismatch
+		}
+		// Data written after the last state save may be lost, but chunks
+		// marked as received were synced before the state was saved.
+		return cr, nil
+	case errors.Is(err, os.ErrNotExist):
+		if plan == nil {
+			return nil, fmt.Errorf("no chunk state for %s and no plan given", filename)
+		}
+	default:
+		return nil, err
+	}
+
+	cr.state = chunkState{Plan: plan, Received: make([]bool, len(plan.Chunks))}
+	if err := mkdirParent(filename, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Truncate(cr.partName, 0); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := cr.saveState(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// Plan returns the plan being received.
+func (cr *ChunkReceiver) Plan() *ChunkPlan {
+	return cr.state.Plan
+}
+
+// WriteChunk verifies data against chunk index of the plan, writes it at
+// its offset and records it as received. Writing a chunk twice is allowed.
+func (cr *ChunkReceiver) WriteChunk(index int, data []byte) error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if index < 0 || index >= len(cr.state.Plan.Chunks) {
+		return fmt.Errorf("chunk index %d out of range", index)
+	}
+	chunk := cr.state.Plan.Chunks[index]
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != chunk.Size || hex.EncodeToString(sum[:]) != chunk.Sum {
+		return fmt.Errorf("chunk %d: %w", index, ErrChunkCorrupt)
+	}
+
+	file, err := os.OpenFile(cr.partName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteAt(data, chunk.Offset); err != nil {
+		return err
+	}
+	// The chunk must be on disk before the state file claims it is.
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	cr.state.Received[index] = true
+	return cr.saveState()
+}
+
+// Missing returns the indexes of the chunks that have not been received.
+func (cr *ChunkReceiver) Missing() []int {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	missing := []int{}
+	for i, ok := range cr.state.Received {
+		if !ok {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// Finish checks that all chunks arrived and that the reassembled file
+// matches the plan, then moves it to its final name and removes the state
+// file.
+func (cr *ChunkReceiver) Finish(ctx context.Context) error {
+	if missing := cr.Missing(); len(missing) > 0 {
+		return fmt.Errorf("%w: %d of %d", ErrChunksMissing, len(missing), len(cr.state.Received))
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	plan := cr.state.Plan
+	if plan.FileSize == 0 {
+		// An empty file has no data to write; make sure it exists.
+		if err := WriteFile(cr.partName, nil); err != nil {
+			return err
+		}
+	}
+
+	hashes, err := HashFile(ctx, cr.partName, HashSHA256)
+	if err != nil {
+		return err
+	}
+	if hashes.Size != plan.FileSize || hashes.Hex(HashSHA256) != plan.Sum {
+		return fmt.Errorf("reassembled %s: %w", cr.filename, ErrChunkCorrupt)
+	}
+
+	if err := os.Rename(cr.partName, cr.filename); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(cr.filename)); err != nil {
+		return err
+	}
+	return os.Remove(cr.stateName)
+}
+
+// Discard removes the partial file and the state file.
+func (cr *ChunkReceiver) Discard() error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	var errs []error
+	for _, name := range []string{cr.partName, cr.stateName} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (cr *ChunkReceiver) saveState() error {
+	return WriteJson(cr.stateName, &cr.state)
+}
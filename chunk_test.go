@@ -0,0 +1,147 @@
+package iutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitFile(t *testing.T) {
+	tempDir := t.TempDir()
+	tests := []struct {
+		name      string
+		size      int
+		chunkSize int64
+		wantSizes []int64
+	}{
+		{"empty", 0, 4, []int64{0}},
+		{"exact", 8, 4, []int64{4, 4}},
+		{"remainder", 10, 4, []int64{4, 4, 2}},
+		{"single", 3, 4, []int64{3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.name)
+			if err := os.WriteFile(filename, bytes.Repeat([]byte("x"), tt.size), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			plan, err := SplitFile(context.Background(), filename, tt.chunkSize)
+			if err != nil {
+				t.Fatalf("SplitFile() error = %v", err)
+			}
+
+			var sizes []int64
+			for i, chunk := range plan.Chunks {
+				if chunk.Index != i || chunk.Offset != int64(i)*tt.chunkSize {
+					t.Errorf("chunk %d = %+v", i, chunk)
+				}
+				sizes = append(sizes, chunk.Size)
+			}
+			if !reflect.DeepEqual(sizes, tt.wantSizes) {
+				t.Errorf("chunk sizes = %v, want %v", sizes, tt.wantSizes)
+			}
+			if plan.FileSize != int64(tt.size) {
+				t.Errorf("FileSize = %d, want %d", plan.FileSize, tt.size)
+			}
+		})
+	}
+
+	if _, err := SplitFile(context.Background(), filepath.Join(tempDir, "single"), 0); err == nil {
+		t.Errorf("SplitFile() expected error for zero chunk size")
+	}
+}
+
+func TestChunkReceiverResume(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src.bin")
+	content := []byte("the quick brown fox jumps over the lazy dog")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := SplitFile(context.Background(), src, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(tempDir, "out", "dst.bin")
+	cr, err := OpenChunkReceiver(dst, plan)
+	if err != nil {
+		t.Fatalf("OpenChunkReceiver() error = %v", err)
+	}
+
+	// Deliver chunks out of order and one corrupt chunk.
+	for _, i := range []int{3, 0} {
+		data, err := ReadChunk(src, plan.Chunks[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cr.WriteChunk(i, data); err != nil {
+			t.Fatalf("WriteChunk(%d) error = %v", i, err)
+		}
+	}
+	if err := cr.WriteChunk(1, []byte("0123456789")); !errors.Is(err, ErrChunkCorrupt) {
+		t.Errorf("WriteChunk() corrupt error = %v, want %v", err, ErrChunkCorrupt)
+	}
+	if err := cr.Finish(context.Background()); !errors.Is(err, ErrChunksMissing) {
+		t.Errorf("Finish() early error = %v, want %v", err, ErrChunksMissing)
+	}
+
+	// Simulate a restart: resume from the state file without a plan.
+	cr, err = OpenChunkReceiver(dst, nil)
+	if err != nil {
+		t.Fatalf("OpenChunkReceiver() resume error = %v", err)
+	}
+	missing := cr.Missing()
+	if !reflect.DeepEqual(missing, []int{1, 2, 4}) {
+		t.Fatalf("Missing() = %v, want [1 2 4]", missing)
+	}
+	for _, i := range missing {
+		data, err := ReadChunk(src, plan.Chunks[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cr.WriteChunk(i, data); err != nil {
+			t.Fatalf("WriteChunk(%d) error = %v", i, err)
+		}
+	}
+
+	if err := cr.Finish(context.Background()); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("reassembled = %q, want %q", got, content)
+	}
+	if FileExists(dst+".part") || FileExists(dst+".chunks.json") {
+		t.Errorf("Finish() left sidecar files behind")
+	}
+}
+
+func TestChunkReceiverPlanMismatch(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "dst.bin")
+	plan := &ChunkPlan{FileSize: 1, ChunkSize: 1, Sum: "a", Chunks: []ChunkInfo{{Size: 1, Sum: "a"}}}
+	cr, err := OpenChunkReceiver(dst, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cr.Discard()
+
+	other := *plan
+	other.Sum = "b"
+	if _, err := OpenChunkReceiver(dst, &other); !errors.Is(err, ErrChunkPlanMismatch) {
+		t.Errorf("OpenChunkReceiver() error = %v, want %v", err, ErrChunkPlanMismatch)
+	}
+	if _, err := OpenChunkReceiver(dst+"2", nil); err == nil {
+		t.Errorf("OpenChunkReceiver() expected error without plan or state")
+	}
+}
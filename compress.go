@@ -0,0 +1,285 @@
+package iutils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Compression describes a compressed file format for the transparent
+// readers and writers of this package. Formats outside the standard
+// library, such as zstd or lz4, can be added with RegisterCompression.
+type Compression struct {
+	// Name identifies the format, e.g. "gzip". Registering a name again
+	// replaces the previous entry.
+	Name string
+	// Exts are the file extensions of the format, e.g. ".gz".
+	Exts []string
+	// Magic is the prefix every stream of the format starts with.
+	Magic []byte
+	// Match, if set, is used instead of Magic to recognize the first bytes
+	// of a stream.
+	Match func(header []byte) bool
+	// NewReader returns a decompressing reader.
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+	// NewWriter returns a compressing writer, or nil for formats that can
+	// only be read.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+func (c *Compression) matches(header []byte) bool {
+	if c.Match != nil {
+		return c.Match(header)
+	}
+	return len(c.Magic) > 0 && bytes.HasPrefix(header, c.Magic)
+}
+
+var (
+	compressionsMu sync.RWMutex
+	compressions   = []*Compression{
+		{
+			Name:  "gzip",
+			Exts:  []string{".gz", ".gzip"},
+			Magic: []byte{0x1f, 0x8b},
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				return gzip.NewReader(r)
+			},
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return gzip.NewWriter(w), nil
+			},
+		},
+		{
+			Name:  "zlib",
+			Exts:  []string{".zz", ".zlib"},
+			Match: isZlibHeader,
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				return zlib.NewReader(r)
+			},
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return zlib.NewWriter(w), nil
+			},
+		},
+		{
+			Name:  "bzip2",
+			Exts:  []string{".bz2"},
+			Match: isBzip2Header,
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				return io.NopCloser(bzip2.NewReader(r)), nil
+			},
+		},
+	}
+)
+
+// isZlibHeader recognizes the headers written by common zlib encoders: a
+// 32K window followed by one of the four compression level flags. Matching
+// any valid RFC 1950 header would misdetect too much plain text.
+func isZlibHeader(header []byte) bool {
+	if len(header) < 2 || header[0] != 0x78 {
+		return false
+	}
+	switch header[1] {
+	case 0x01, 0x5e, 0x9c, 0xda:
+		return true
+	}
+	return false
+}
+
+func isBzip2Header(header []byte) bool {
+	return len(header) >= 4 && string(header[:3]) == "BZh" && header[3] >= '1' && header[3] <= '9'
+}
+
+// RegisterCompression adds c to the formats recognized by OpenCompressed
+// and CreateCompressedFile.
+func RegisterCompression(c Compression) {
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+
+	for i, existing := range compressions {
+		if existing.Name == c.Name {
+			compressions[i] = &c
+			return
+		}
+	}
+	compressions = append(compressions, &c)
+}
+
+// compressionForExt returns the format registered for the extension of
+// filename, or nil.
+func compressionForExt(filename string) *Compression {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == "" {
+		return nil
+	}
+
+	compressionsMu.RLock()
+	defer compressionsMu.RUnlock()
+	for _, c := range compressions {
+		if containsString(c.Exts, ext) {
+			return c
+		}
+	}
+	return nil
+}
+
+func compressionForHeader(header []byte) *Compression {
+	compressionsMu.RLock()
+	defer compressionsMu.RUnlock()
+	for _, c := range compressions {
+		if c.matches(header) {
+			return c
+		}
+	}
+	return nil
+}
+
+// NewDecompressingReader returns a reader of the decompressed content of
+// r. The format is detected from the first bytes of r, falling back to the
+// extension of filename; unrecognized content is returned unchanged.
+func NewDecompressingReader(r io.Reader, filename string) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(16)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	c := compressionForHeader(header)
+	if c == nil && len(header) > 0 {
+		c = compressionForExt(filename)
+	}
+	if c == nil {
+		return io.NopCloser(br), nil
+	}
+	return c.NewReader(br)
+}
+
+// OpenCompressed opens filename for reading and transparently decompresses
+// it. See NewDecompressingReader for how the format is detected.
+func OpenCompressed(filename string) (io.ReadCloser, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := NewDecompressingReader(file, filename)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return &compressedReadCloser{ReadCloser: rc, file: file}, nil
+}
+
+type compressedReadCloser struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (c *compressedReadCloser) Close() error {
+	err := c.ReadCloser.Close()
+	if fileErr := c.file.Close(); err == nil {
+		err = fileErr
+	}
+	return err
+}
+
+// ReadCompressedFile is ReadFile for files that may be compressed.
+func ReadCompressedFile(filename string) ([]byte, error) {
+	rc, err := OpenCompressed(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// CompressedFile is an AtomicFile whose content is compressed according to
+// the extension of its name.
+type CompressedFile struct {
+	af *AtomicFile
+	w  io.WriteCloser
+}
+
+// CreateCompressedFile starts an atomic write of filename, compressing the
+// data with the format registered for its extension. Files with other
+// extensions are written uncompressed.
+func CreateCompressedFile(filename string, opts *AtomicOptions) (*CompressedFile, error) {
+	af, err := NewAtomicFile(filename, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cf := &CompressedFile{af: af}
+	if c := compressionForExt(filename); c != nil {
+		if c.NewWriter == nil {
+			af.Abort()
+			return nil, fmt.Errorf("%s: writing %s is not supported", filename, c.Name)
+		}
+		if cf.w, err = c.NewWriter(af); err != nil {
+			af.Abort()
+			return nil, err
+		}
+	}
+	return cf, nil
+}
+
+// Write compresses p into the temporary file.
+func (cf *CompressedFile) Write(p []byte) (int, error) {
+	if cf.w == nil {
+		return cf.af.Write(p)
+	}
+	return cf.w.Write(p)
+}
+
+// Commit flushes the compressor and publishes the file atomically.
+func (cf *CompressedFile) Commit() error {
+	if cf.w != nil {
+		if err := cf.w.Close(); err != nil {
+			cf.af.Abort()
+			return err
+		}
+	}
+	return cf.af.Commit()
+}
+
+// Close discards the file unless it has been committed.
+func (cf *CompressedFile) Close() error {
+	return cf.af.Abort()
+}
+
+// WriteCompressedFile is WriteFile3 for files that may be compressed.
+func WriteCompressedFile(filename string, data []byte) error {
+	cf, err := CreateCompressedFile(filename, nil)
+	if err != nil {
+		return err
+	}
+	defer cf.Close()
+
+	if _, err := cf.Write(data); err != nil {
+		return err
+	}
+	return cf.Commit()
+}
+
+// WriteCompressedJson is WriteJson for files that may be compressed.
+func WriteCompressedJson(filename string, data interface{}) error {
+	cf, err := CreateCompressedFile(filename, nil)
+	if err != nil {
+		return err
+	}
+	defer cf.Close()
+
+	encoder := json.NewEncoder(cf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		return err
+	}
+	return cf.Commit()
+}
@@ -0,0 +1,145 @@
+package iutils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressedRoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	content := bytes.Repeat([]byte("compressible data "), 100)
+
+	tests := []struct {
+		name       string
+		filename   string
+		compressed bool
+	}{
+		{"gzip", "data.gz", true},
+		{"zlib", "data.zlib", true},
+		{"plain", "data.txt", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(tempDir, tt.filename)
+			if err := WriteCompressedFile(filename, content); err != nil {
+				t.Fatalf("WriteCompressedFile() error = %v", err)
+			}
+
+			raw, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.compressed == bytes.Equal(raw, content) {
+				t.Errorf("file compressed = %v, want %v", !bytes.Equal(raw, content), tt.compressed)
+			}
+
+			got, err := ReadCompressedFile(filename)
+			if err != nil {
+				t.Fatalf("ReadCompressedFile() error = %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("ReadCompressedFile() content mismatch")
+			}
+		})
+	}
+}
+
+func TestOpenCompressedDetectsMagic(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// A gzip stream behind a misleading extension.
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write([]byte("hidden gzip"))
+	gw.Close()
+	filename := filepath.Join(tempDir, "data.bin")
+	if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadCompressedFile(filename)
+	if err != nil || string(got) != "hidden gzip" {
+		t.Errorf("ReadCompressedFile() = %q, %v; want %q", got, err, "hidden gzip")
+	}
+
+	buf.Reset()
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte("zlib"))
+	zw.Close()
+	rc, err := NewDecompressingReader(bytes.NewReader(buf.Bytes()), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = io.ReadAll(rc)
+	if string(got) != "zlib" {
+		t.Errorf("NewDecompressingReader() = %q, want zlib", got)
+	}
+
+	empty := filepath.Join(tempDir, "empty.gz")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadCompressedFile(empty); err != nil || len(got) != 0 {
+		t.Errorf("ReadCompressedFile(empty) = %q, %v", got, err)
+	}
+}
+
+func TestRegisterCompression(t *testing.T) {
+	// A toy format that stores data verbatim after a magic header.
+	magic := []byte("TOY1")
+	RegisterCompression(Compression{
+		Name:  "toy",
+		Exts:  []string{".toy"},
+		Magic: magic,
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			header := make([]byte, len(magic))
+			if _, err := io.ReadFull(r, header); err != nil {
+				return nil, err
+			}
+			return io.NopCloser(r), nil
+		},
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			_, err := w.Write(magic)
+			return nopWriteCloser{w}, err
+		},
+	})
+	defer func() {
+		compressionsMu.Lock()
+		compressions = compressions[:len(compressions)-1]
+		compressionsMu.Unlock()
+	}()
+
+	filename := filepath.Join(t.TempDir(), "data.toy")
+	if err := WriteCompressedJson(filename, map[string]int{"a": 1}); err != nil {
+		t.Fatalf("WriteCompressedJson() error = %v", err)
+	}
+	raw, _ := os.ReadFile(filename)
+	if !bytes.HasPrefix(raw, magic) {
+		t.Errorf("file does not start with magic: %q", raw)
+	}
+	got, err := ReadCompressedFile(filename)
+	if err != nil || string(got) != "{\n  \"a\": 1\n}\n" {
+		t.Errorf("ReadCompressedFile() = %q, %v", got, err)
+	}
+}
+
+func TestCreateCompressedFileReadOnlyFormat(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.bz2")
+	if err := WriteCompressedFile(filename, []byte("x")); err == nil {
+		t.Errorf("WriteCompressedFile() expected error for bzip2")
+	}
+	if FileExists(filename) {
+		t.Errorf("WriteCompressedFile() left a file behind")
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,332 @@
+package iutils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrDestinationExists is returned by CopyFile, CopyDir and Move when the
+// destination exists and the overwrite policy is OverwriteFail.
+var ErrDestinationExists = errors.New("iutils: destination exists")
+
+// OverwritePolicy decides what happens when a copy destination exists.
+type OverwritePolicy int
+
+const (
+	// OverwriteReplace replaces the destination.
+	OverwriteReplace OverwritePolicy = iota
+	// OverwriteSkip keeps the destination and skips the file.
+	OverwriteSkip
+	// OverwriteFail returns ErrDestinationExists.
+	OverwriteFail
+	// OverwriteIfNewer replaces the destination only if the source has a
+	// later modification time.
+	OverwriteIfNewer
+)
+
+// CopyOptions configures CopyFile, CopyDir and Move. A nil *CopyOptions
+// replaces existing files, follows symlinks and gives new files mode 0644
+// and new directories mode 0755.
+type CopyOptions struct {
+	Overwrite OverwritePolicy
+	// PreserveMode copies the permission bits of the source.
+	PreserveMode bool
+	// PreserveTimes copies the modification time of the source.
+	PreserveTimes bool
+	// PreserveSymlinks recreates symlinks instead of copying their target.
+	PreserveSymlinks bool
+}
+
+// CopyFile copies the regular file src to dst. dst is written atomically,
+// so readers never see a partial copy. On Linux the data is cloned with a
+// reflink when the filesystem supports it and copied with copy_file_range
+// otherwise.
+func CopyFile(src, dst string, opts *CopyOptions) error {
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if opts.PreserveSymlinks {
+			return copySymlink(src, dst, info, opts)
+		}
+		if info, err = os.Stat(src); err != nil {
+			return err
+		}
+	}
+	if !info.Mode().IsRegular() {
+		return &fs.PathError{Op: "copy", Path: src, Err: errors.New("not a regular file")}
+	}
+
+	ok, err := checkOverwrite(dst, info, opts.Overwrite)
+	if err != nil || !ok {
+		return err
+	}
+	return copyRegularFile(src, dst, info, opts)
+}
+
+func copyRegularFile(src, dst string, info fs.FileInfo, opts *CopyOptions) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	af, err := NewAtomicFile(dst, nil)
+	if err != nil {
+		return err
+	}
+	defer af.Close()
+
+	if opts.PreserveMode {
+		if err := af.file.Chmod(info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	if err := cloneFile(af.file, srcFile); err != nil {
+		if _, err := io.Copy(af.file, srcFile); err != nil {
+			return err
+		}
+	}
+
+	if err := af.Commit(); err != nil {
+		return err
+	}
+	if opts.PreserveTimes {
+		return os.Chtimes(dst, time.Now(), info.ModTime())
+	}
+	return nil
+}
+
+// copySymlink recreates the symlink src at dst, replacing dst atomically.
+func copySymlink(src, dst string, info fs.FileInfo, opts *CopyOptions) error {
+	ok, err := checkOverwrite(dst, info, opts.Overwrite)
+	if err != nil || !ok {
+		return err
+	}
+
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+
+	tempName := filepath.Join(filepath.Dir(dst), ".tmp-"+filepath.Base(dst)+"-"+GenerateRandomString(8))
+	if err := os.Symlink(target, tempName); err != nil {
+		return err
+	}
+	if err := os.Rename(tempName, dst); err != nil {
+		_ = os.Remove(tempName)
+		return err
+	}
+	return nil
+}
+
+// checkOverwrite reports whether dst may be written according to policy.
+func checkOverwrite(dst string, srcInfo fs.FileInfo, policy OverwritePolicy) (bool, error) {
+	dstInfo, err := os.Lstat(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if dstInfo.IsDir() {
+		return false, &fs.PathError{Op: "copy", Path: dst, Err: errors.New("is a directory")}
+	}
+
+	switch policy {
+	case OverwriteSkip:
+		return false, nil
+	case OverwriteFail:
+		return false, &fs.PathError{Op: "copy", Path: dst, Err: ErrDestinationExists}
+	case OverwriteIfNewer:
+		return srcInfo.ModTime().After(dstInfo.ModTime()), nil
+	}
+	return true, nil
+}
+
+// CopyDir copies the directory tree src to dst, creating dst if needed.
+// Existing files below dst are handled according to opts.Overwrite.
+func CopyDir(src, dst string, opts *CopyOptions) error {
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: "copy", Path: src, Err: errors.New("not a directory")}
+	}
+	if inside, err := isSubPath(src, dst); err != nil {
+		return err
+	} else if inside {
+		return fmt.Errorf("copy %s: destination %s is inside the source", src, dst)
+	}
+
+	type dirAttrs struct {
+		path    string
+		perm    fs.FileMode
+		modTime time.Time
+	}
+	var dirs []dirAttrs
+	visited := make(map[fileKey]bool)
+
+	var copyTree func(src, dst string, info fs.FileInfo) error
+	copyTree = func(src, dst string, info fs.FileInfo) error {
+		if key, ok := fileIdentity(info); ok {
+			if visited[key] {
+				return nil // Symlink loop.
+			}
+			visited[key] = true
+		}
+
+		// Directories stay writable until their contents are copied, so
+		// read-only trees can be copied by their owner.
+		perm := fs.FileMode(0755)
+		if opts.PreserveMode {
+			perm = info.Mode().Perm()
+		}
+		if err := os.MkdirAll(dst, perm|0700); err != nil {
+			return err
+		}
+		if opts.PreserveMode {
+			if err := os.Chmod(dst, perm|0700); err != nil {
+				return err
+			}
+		}
+
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			srcPath := filepath.Join(src, entry.Name())
+			dstPath := filepath.Join(dst, entry.Name())
+
+			entryInfo, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if entry.Type()&fs.ModeSymlink != 0 {
+				if opts.PreserveSymlinks {
+					if err := copySymlink(srcPath, dstPath, entryInfo, opts); err != nil {
+						return err
+					}
+					continue
+				}
+				if entryInfo, err = os.Stat(srcPath); err != nil {
+					return err
+				}
+			}
+
+			switch {
+			case entryInfo.IsDir():
+				err = copyTree(srcPath, dstPath, entryInfo)
+			case entryInfo.Mode().IsRegular():
+				var ok bool
+				if ok, err = checkOverwrite(dstPath, entryInfo, opts.Overwrite); err == nil && ok {
+					err = copyRegularFile(srcPath, dstPath, entryInfo, opts)
+				}
+			default:
+				// Devices, sockets and pipes are not copied.
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		dirs = append(dirs, dirAttrs{path: dst, perm: perm, modTime: info.ModTime()})
+		return nil
+	}
+
+	if err := copyTree(src, dst, info); err != nil {
+		return err
+	}
+
+	// Copying files into a directory changes its mtime and may need it to
+	// be writable, so directory modes and times are applied after all
+	// contents are in place. Children come before their parents.
+	for _, dir := range dirs {
+		if opts.PreserveMode && dir.perm&0700 != 0700 {
+			if err := os.Chmod(dir.path, dir.perm); err != nil {
+				return err
+			}
+		}
+		if opts.PreserveTimes {
+			if err := os.Chtimes(dir.path, time.Now(), dir.modTime); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Move renames src to dst. When they are on different filesystems it
+// copies src, preserving mode, times and symlinks, and then removes it.
+// opts.Overwrite applies to files; a directory is never moved onto an
+// existing path.
+func Move(src, dst string, opts *CopyOptions) error {
+	moveOpts := CopyOptions{PreserveMode: true, PreserveTimes: true, PreserveSymlinks: true}
+	if opts != nil {
+		moveOpts.Overwrite = opts.Overwrite
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		ok, err := checkOverwrite(dst, info, moveOpts.Overwrite)
+		if err != nil || !ok {
+			return err
+		}
+	} else if _, err := os.Lstat(dst); err == nil {
+		return &fs.PathError{Op: "move", Path: dst, Err: ErrDestinationExists}
+	}
+
+	err = os.Rename(src, dst)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+
+	if info.IsDir() {
+		err = CopyDir(src, dst, &moveOpts)
+	} else {
+		moveOpts.Overwrite = OverwriteReplace // Already checked above.
+		err = CopyFile(src, dst, &moveOpts)
+	}
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// isSubPath reports whether child is parent or a path below it.
+func isSubPath(parent, child string) (bool, error) {
+	parentAbs, err := filepath.Abs(parent)
+	if err != nil {
+		return false, err
+	}
+	childAbs, err := filepath.Abs(child)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(parentAbs, childAbs)
+	if err != nil {
+		return false, nil
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))), nil
+}
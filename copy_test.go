@@ -0,0 +1,197 @@
+package iutils
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCopyFile(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src.sh")
+	if err := os.WriteFile(src, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(src, 0750); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(tempDir, "dst.sh")
+	if err := CopyFile(src, dst, &CopyOptions{PreserveMode: true, PreserveTimes: true}); err != nil {
+		t.Fatalf("CopyFile() error = %v", err)
+	}
+
+	content, err := os.ReadFile(dst)
+	if err != nil || string(content) != "#!/bin/sh\n" {
+		t.Errorf("CopyFile() content = %q, %v", content, err)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0750 {
+		t.Errorf("mode = %v, want %v", info.Mode().Perm(), os.FileMode(0750))
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("mtime = %v, want %v", info.ModTime(), mtime)
+	}
+
+	if err := CopyFile(tempDir, dst, nil); err == nil {
+		t.Errorf("CopyFile() expected error for directory source")
+	}
+}
+
+func TestCopyFileOverwrite(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+	dst := filepath.Join(tempDir, "dst")
+	if err := os.WriteFile(src, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	older := time.Now().Add(-time.Hour)
+	newer := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		policy   OverwritePolicy
+		dstTime  time.Time
+		want     string
+		wantErr  error
+		checkErr bool
+	}{
+		{"replace", OverwriteReplace, older, "new", nil, false},
+		{"skip", OverwriteSkip, older, "old", nil, false},
+		{"fail", OverwriteFail, older, "old", ErrDestinationExists, true},
+		{"if newer replaces older", OverwriteIfNewer, older, "new", nil, false},
+		{"if newer keeps newer", OverwriteIfNewer, newer, "old", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(dst, []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(dst, tt.dstTime, tt.dstTime); err != nil {
+				t.Fatal(err)
+			}
+
+			err := CopyFile(src, dst, &CopyOptions{Overwrite: tt.policy})
+			if tt.checkErr {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("CopyFile() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("CopyFile() error = %v", err)
+			}
+
+			content, _ := os.ReadFile(dst)
+			if string(content) != tt.want {
+				t.Errorf("content = %q, want %q", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyDir(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+	writeTestTree(t, src, map[string]string{
+		"a.txt":       "a",
+		"sub/b.txt":   "b",
+		"sub/x/c.txt": "c",
+	})
+	hasSymlinks := os.Symlink("a.txt", filepath.Join(src, "link")) == nil
+
+	dst := filepath.Join(tempDir, "dst")
+	if err := CopyDir(src, dst, &CopyOptions{PreserveSymlinks: true, PreserveTimes: true}); err != nil {
+		t.Fatalf("CopyDir() error = %v", err)
+	}
+
+	for name, want := range map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/x/c.txt": "c"} {
+		content, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil || string(content) != want {
+			t.Errorf("%s = %q, %v; want %q", name, content, err, want)
+		}
+	}
+	if hasSymlinks {
+		target, err := os.Readlink(filepath.Join(dst, "link"))
+		if err != nil || target != "a.txt" {
+			t.Errorf("symlink target = %q, %v; want a.txt", target, err)
+		}
+	}
+
+	if err := CopyDir(src, filepath.Join(src, "sub", "inner"), nil); err == nil {
+		t.Errorf("CopyDir() expected error when copying into itself")
+	}
+}
+
+// chmodDirs sets the mode of root and all directories below it.
+func chmodDirs(root string, perm fs.FileMode) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return err
+		}
+		return os.Chmod(path, perm)
+	})
+}
+
+func TestCopyDirReadOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directory permissions are not enforced on Windows")
+	}
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+	writeTestTree(t, src, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	dst := filepath.Join(tempDir, "dst")
+	// Let the temporary directory be removed.
+	t.Cleanup(func() {
+		chmodDirs(src, 0755)
+		chmodDirs(dst, 0755)
+	})
+	if err := chmodDirs(src, 0555); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CopyDir(src, dst, &CopyOptions{PreserveMode: true}); err != nil {
+		t.Fatalf("CopyDir() of a read-only tree error = %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(dst, "sub", "b.txt")); err != nil || string(content) != "b" {
+		t.Errorf("sub/b.txt = %q, %v", content, err)
+	}
+	for _, dir := range []string{dst, filepath.Join(dst, "sub")} {
+		if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0555 {
+			t.Errorf("mode of %s = %v, %v, want 0555", dir, info.Mode().Perm(), err)
+		}
+	}
+}
+
+func TestMove(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+	writeTestTree(t, src, map[string]string{"f.txt": "data", "d/g.txt": "more"})
+
+	dst := filepath.Join(tempDir, "moved")
+	if err := Move(src, dst, nil); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	if DirExists(src) || !FileExists(filepath.Join(dst, "d", "g.txt")) {
+		t.Errorf("Move() did not move the tree")
+	}
+
+	if err := WriteFile2(filepath.Join(tempDir, "other"), []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	err := Move(filepath.Join(dst, "f.txt"), filepath.Join(tempDir, "other"), &CopyOptions{Overwrite: OverwriteFail})
+	if !errors.Is(err, ErrDestinationExists) {
+		t.Errorf("Move() error = %v, want %v", err, ErrDestinationExists)
+	}
+}
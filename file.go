@@ -78,15 +78,8 @@ func WriteFile(filename string, data []byte) error {
 
 // writeFile 自动创建目录并写入文件
 func WriteFile2(filename string, data []byte) error {
-	// 分离文件名和路径
-	dirName := filepath.Dir(filename)
-
-	// 检查目录是否存在，不存在则创建
-	if _, err := os.Stat(dirName); os.IsNotExist(err) {
-		// 使用 MkdirAll 创建缺失的多级目录
-		if err := os.MkdirAll(dirName, 0755); err != nil {
-			return err
-		}
+	if err := mkdirParent(filename, 0755); err != nil {
+		return err
 	}
 
 	// 写入文件
@@ -97,39 +90,12 @@ func WriteFile2(filename string, data []byte) error {
 	return nil
 }
 
-// WriteFile writes data to the file specified by filename.
-// It uses a temporary file for safety and ensures data is flushed to disk.
+// WriteFile3 writes data to the file specified by filename atomically.
+// The data is written to a temporary file next to filename, flushed to disk
+// and then renamed over filename, so readers see either the old or the new
+// content. The mode and owner of an existing file are preserved.
 func WriteFile3(filename string, data []byte) error {
-	// Create a temporary file
-	tempFile, err := os.CreateTemp(os.TempDir(), ".tmp-"+filepath.Base(filename))
-	if err != nil {
-		return err
-	}
-	defer func(name string) {
-		_ = os.Remove(name) // Attempt to remove the temp file if it still exists.
-	}(tempFile.Name())
-
-	// Write data to the temporary file.
-	if _, err := tempFile.Write(data); err != nil {
-		return err
-	}
-
-	// Close the temporary file before moving it to avoid file locking issues.
-	if err := tempFile.Close(); err != nil {
-		return err
-	}
-
-	// Move the temporary file to the destination, overwriting it if it exists.
-	if err := os.Rename(tempFile.Name(), filename); err != nil {
-		return err
-	}
-
-	// Sync the directory to ensure the rename operation is flushed to disk.
-	if err := syncDir(filepath.Dir(filename)); err != nil {
-		return err
-	}
-
-	return nil
+	return writeFileAtomic(filename, data, nil)
 }
 
 // syncDir forces a synchronization of the file system metadata and any delayed writes to disk for the given directory.
@@ -145,12 +111,21 @@ func syncDir(dirName string) error {
 	return dir.Sync()
 }
 
+// WriteJson encodes data as indented JSON and writes it to filename
+// atomically.
 func WriteJson(filename string, data interface{}) error {
-	bytes, err := json.MarshalIndent(data, "", "  ")
+	af, err := CreateAtomicFile(filename)
 	if err != nil {
 		return err
 	}
-	return WriteFile3(filename, bytes)
+	defer af.Close()
+
+	encoder := json.NewEncoder(af)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		return err
+	}
+	return af.Commit()
 }
 
 func WriteFileParts(
@@ -158,15 +133,8 @@ func WriteFileParts(
 	fileoffset int64,
 	data []byte,
 ) error {
-	// 分离文件名和路径
-	dirName := filepath.Dir(filename)
-
-	// 检查目录是否存在，不存在则创建
-	if _, err := os.Stat(dirName); os.IsNotExist(err) {
-		// 使用 MkdirAll 创建缺失的多级目录
-		if err := os.MkdirAll(dirName, 0755); err != nil {
-			return err
-		}
+	if err := mkdirParent(filename, 0755); err != nil {
+		return err
 	}
 
 	// 写入文件
@@ -194,15 +162,8 @@ func WriteFileParts(
 }
 
 func WriteScript(filename string, data []byte) error {
-	// 分离文件名和路径
-	dirName := filepath.Dir(filename)
-
-	// 检查目录是否存在，不存在则创建
-	if _, err := os.Stat(dirName); os.IsNotExist(err) {
-		// 使用 MkdirAll 创建缺失的多级目录
-		if err := os.MkdirAll(dirName, 0755); err != nil {
-			return err
-		}
+	if err := mkdirParent(filename, 0755); err != nil {
+		return err
 	}
 
 	// 写入文件
@@ -243,19 +204,8 @@ func IsTargetExt(info fs.DirEntry, ext string) bool {
 	return filepath.Ext(info.Name()) == ext
 }
 
+// FindFilesWithExt returns the regular files below dirPath whose extension
+// is ext. See Find for more selective searches.
 func FindFilesWithExt(dirPath, ext string) ([]string, error) {
-	var files []string
-	err := filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if IsTargetExt(d, ext) {
-			files = append(files, path)
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-	return files, nil
+	return Find(dirPath, &FindOptions{Exts: []string{ext}})
 }
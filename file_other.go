@@ -0,0 +1,36 @@
+//go:build !unix
+
+package iutils
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// fileOwner is not supported on this platform.
+func fileOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// fileKey identifies a file independently of the path used to reach it.
+type fileKey struct {
+	dev, ino uint64
+}
+
+// fileIdentity is not supported on this platform.
+func fileIdentity(info fs.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
+
+// fileAllocation is not supported on this platform.
+func fileAllocation(info fs.FileInfo) (allocated int64, nlink uint64, ok bool) {
+	return 0, 0, false
+}
+
+// isCrossDevice cannot tell the cause of a rename failure on this platform,
+// so any rename error lets the caller fall back to copying.
+func isCrossDevice(err error) bool {
+	var linkErr *os.LinkError
+	return errors.As(err, &linkErr)
+}
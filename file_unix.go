@@ -0,0 +1,49 @@
+//go:build unix
+
+package iutils
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+// fileOwner returns the uid and gid recorded in info.
+func fileOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
+
+// fileKey identifies a file independently of the path used to reach it.
+type fileKey struct {
+	dev, ino uint64
+}
+
+// fileIdentity returns the device and inode recorded in info.
+func fileIdentity(info fs.FileInfo) (fileKey, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+// fileAllocation returns the bytes allocated to a file and its number of
+// hard links.
+func fileAllocation(info fs.FileInfo) (allocated int64, nlink uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	// Blocks are counted in 512-byte units on all Unix systems.
+	return int64(st.Blocks) * 512, uint64(st.Nlink), true
+}
+
+// isCrossDevice reports whether err is a rename failure caused by source
+// and destination being on different filesystems.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
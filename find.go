@@ -0,0 +1,463 @@
+package iutils
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FindOptions selects the files returned by Find. A nil *FindOptions or a
+// zero FindOptions matches every regular file below the root.
+type FindOptions struct {
+	// Exts keeps files whose extension, as returned by filepath.Ext, is
+	// one of the listed values, e.g. ".txt".
+	Exts []string
+	// Patterns keeps files matching any of the glob patterns. A pattern
+	// containing "/" is matched against the slash separated path relative
+	// to the root and may use "**" for any number of directories; other
+	// patterns are matched against the file name.
+	Patterns []string
+	// IgnoreCase makes Exts and Patterns case-insensitive.
+	IgnoreCase bool
+	// NameRegexp keeps files whose name matches the expression.
+	NameRegexp *regexp.Regexp
+
+	// MinSize and MaxSize bound the file size in bytes. Zero means no
+	// bound.
+	MinSize int64
+	MaxSize int64
+	// ModifiedAfter and ModifiedBefore bound the modification time. The
+	// zero time means no bound.
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+
+	// MaxDepth limits how deep Find descends; 1 only looks at the entries
+	// of the root itself. Zero means no limit.
+	MaxDepth int
+	// IncludeDirs, if set, keeps only files whose parent directory, relative
+	// to the root, matches one of the patterns.
+	IncludeDirs []string
+	// ExcludeDirs lists directory patterns that are not descended into,
+	// e.g. ".git" or "build/**".
+	ExcludeDirs []string
+	// IgnoreFile names a .gitignore style file that is read in every
+	// directory, e.g. ".gitignore".
+	IgnoreFile string
+
+	// FollowSymlinks reports symlinks to files and descends into symlinks
+	// to directories. Directories already visited are skipped, so symlink
+	// loops terminate.
+	FollowSymlinks bool
+}
+
+// Find returns the paths of the regular files below root selected by opts,
+// in lexical order. It stops at the first error.
+func Find(root string, opts *FindOptions) ([]string, error) {
+	var files []string
+	var walkErr error
+	FindSeq(root, opts)(func(path string, err error) bool {
+		if err != nil {
+			walkErr = err
+			return false
+		}
+		files = append(files, path)
+		return true
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+	return files, nil
+}
+
+// FindSeq is the iterator form of Find. Paths are produced lazily while the
+// tree is walked; an error is yielded once and ends the sequence.
+func FindSeq(root string, opts *FindOptions) func(yield func(string, error) bool) {
+	return func(yield func(string, error) bool) {
+		if opts == nil {
+			opts = &FindOptions{}
+		}
+		f, err := newFinder(opts)
+		if err != nil {
+			yield("", err)
+			return
+		}
+		f.yield = yield
+
+		info, err := os.Lstat(root)
+		if err == nil && info.Mode()&fs.ModeSymlink != 0 && opts.FollowSymlinks {
+			info, err = os.Stat(root)
+		}
+		if err != nil {
+			yield("", err)
+			return
+		}
+
+		if !info.IsDir() {
+			if info.Mode().IsRegular() {
+				f.visitFile(root, filepath.Base(root), info.Name(), 0, fs.FileInfoToDirEntry(info), nil)
+			}
+			return
+		}
+		f.markVisited(root, info)
+		f.walk(root, "", 0, nil)
+	}
+}
+
+type finder struct {
+	opts        *FindOptions
+	exts        []string
+	patterns    []string
+	includeDirs []string
+	excludeDirs []string
+	yield       func(string, error) bool
+	stopped     bool
+	visited     map[fileKey]bool
+	visitedPath map[string]bool
+}
+
+func newFinder(opts *FindOptions) (*finder, error) {
+	f := &finder{
+		opts:        opts,
+		visited:     make(map[fileKey]bool),
+		visitedPath: make(map[string]bool),
+	}
+	for _, ext := range opts.Exts {
+		f.exts = append(f.exts, f.fold(ext))
+	}
+
+	var err error
+	if f.patterns, err = compilePatterns(opts.Patterns, opts.IgnoreCase); err != nil {
+		return nil, err
+	}
+	if f.includeDirs, err = compilePatterns(opts.IncludeDirs, false); err != nil {
+		return nil, err
+	}
+	if f.excludeDirs, err = compilePatterns(opts.ExcludeDirs, false); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *finder) fold(s string) string {
+	if f.opts.IgnoreCase {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+func (f *finder) emit(path string, err error) {
+	if f.stopped {
+		return
+	}
+	if !f.yield(path, err) || err != nil {
+		f.stopped = true
+	}
+}
+
+// walk visits the entries of dirPath. rel is the slash separated path of
+// dirPath relative to the root ("" for the root itself).
+func (f *finder) walk(dirPath, rel string, depth int, ignores []*ignoreRules) {
+	if f.opts.IgnoreFile != "" {
+		rules, err := readIgnoreRules(filepath.Join(dirPath, f.opts.IgnoreFile), rel)
+		if err != nil {
+			f.emit("", err)
+			return
+		}
+		if rules != nil {
+			ignores = append(ignores[:len(ignores):len(ignores)], rules)
+		}
+	}
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		f.emit("", err)
+		return
+	}
+
+	for _, entry := range entries {
+		if f.stopped {
+			return
+		}
+
+		name := entry.Name()
+		entryPath := filepath.Join(dirPath, name)
+		entryRel := path.Join(rel, name)
+
+		isDir := entry.IsDir()
+		var info fs.FileInfo
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if !f.opts.FollowSymlinks {
+				continue
+			}
+			if info, err = os.Stat(entryPath); err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue // Dangling symlink.
+				}
+				f.emit("", err)
+				return
+			}
+			isDir = info.IsDir()
+			entry = fs.FileInfoToDirEntry(info)
+		}
+
+		if matchIgnoreRules(ignores, entryRel, isDir) {
+			continue
+		}
+
+		if isDir {
+			if f.opts.MaxDepth > 0 && depth+1 >= f.opts.MaxDepth {
+				continue
+			}
+			if matchAnyPattern(f.excludeDirs, entryRel) {
+				continue
+			}
+			if info == nil {
+				if info, err = entry.Info(); err != nil {
+					f.emit("", err)
+					return
+				}
+			}
+			if !f.markVisited(entryPath, info) {
+				continue
+			}
+			f.walk(entryPath, entryRel, depth+1, ignores)
+			continue
+		}
+
+		if entry.Type().IsRegular() {
+			f.visitFile(entryPath, entryRel, name, depth+1, entry, info)
+		}
+	}
+}
+
+// markVisited records a directory and reports whether it was new.
+func (f *finder) markVisited(dirPath string, info fs.FileInfo) bool {
+	if key, ok := fileIdentity(info); ok {
+		if f.visited[key] {
+			return false
+		}
+		f.visited[key] = true
+		return true
+	}
+
+	realPath, err := filepath.EvalSymlinks(dirPath)
+	if err != nil {
+		realPath = dirPath
+	}
+	if f.visitedPath[realPath] {
+		return false
+	}
+	f.visitedPath[realPath] = true
+	return true
+}
+
+func (f *finder) visitFile(filePath, rel, name string, depth int, entry fs.DirEntry, info fs.FileInfo) {
+	opts := f.opts
+
+	if len(f.exts) > 0 && !containsString(f.exts, f.fold(filepath.Ext(name))) {
+		return
+	}
+	if len(f.patterns) > 0 && !matchAnyPattern(f.patterns, f.fold(rel)) {
+		return
+	}
+	if opts.NameRegexp != nil && !opts.NameRegexp.MatchString(name) {
+		return
+	}
+	if len(f.includeDirs) > 0 && !matchAnyPattern(f.includeDirs, path.Dir(rel)) {
+		return
+	}
+
+	if opts.MinSize > 0 || opts.MaxSize > 0 || !opts.ModifiedAfter.IsZero() || !opts.ModifiedBefore.IsZero() {
+		if info == nil {
+			var err error
+			if info, err = entry.Info(); err != nil {
+				f.emit("", err)
+				return
+			}
+		}
+		if opts.MinSize > 0 && info.Size() < opts.MinSize {
+			return
+		}
+		if opts.MaxSize > 0 && info.Size() > opts.MaxSize {
+			return
+		}
+		if !opts.ModifiedAfter.IsZero() && !info.ModTime().After(opts.ModifiedAfter) {
+			return
+		}
+		if !opts.ModifiedBefore.IsZero() && !info.ModTime().Before(opts.ModifiedBefore) {
+			return
+		}
+	}
+
+	f.emit(filePath, nil)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPattern reports whether the slash separated name matches pattern.
+// Pattern segments use the path.Match syntax; a "**" segment matches zero
+// or more path segments.
+func MatchPattern(pattern, name string) (bool, error) {
+	if err := validatePattern(pattern); err != nil {
+		return false, err
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/")), nil
+}
+
+func validatePattern(pattern string) error {
+	for _, seg := range strings.Split(pattern, "/") {
+		if _, err := path.Match(seg, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for len(pat) > 0 && pat[0] == "**" {
+				pat = pat[1:]
+			}
+			if len(pat) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pat, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// compilePatterns validates patterns and rewrites the ones without a "/"
+// so that they match the last path segment at any depth.
+func compilePatterns(patterns []string, ignoreCase bool) ([]string, error) {
+	compiled := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if err := validatePattern(pattern); err != nil {
+			return nil, err
+		}
+		if ignoreCase {
+			pattern = strings.ToLower(pattern)
+		}
+		if !strings.Contains(pattern, "/") {
+			pattern = "**/" + pattern
+		}
+		compiled = append(compiled, strings.TrimPrefix(pattern, "/"))
+	}
+	return compiled, nil
+}
+
+func matchAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreRules holds the rules of one .gitignore style file. base is the
+// slash separated directory of the file relative to the walk root.
+type ignoreRules struct {
+	base  string
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// readIgnoreRules parses filename, returning nil if it does not exist.
+func readIgnoreRules(filename, base string) (*ignoreRules, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseIgnoreRules(string(data), base), nil
+}
+
+func parseIgnoreRules(content, base string) *ignoreRules {
+	ir := &ignoreRules{base: base}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		line = strings.TrimRight(line, " ")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:] // Escaped leading "#" or "!".
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" || validatePattern(line) != nil {
+			continue
+		}
+
+		// A pattern with a slash is relative to the ignore file, any other
+		// pattern matches at any depth below it.
+		if !strings.Contains(line, "/") {
+			line = "**/" + line
+		}
+		rule.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+		ir.rules = append(ir.rules, rule)
+	}
+	return ir
+}
+
+// matchIgnoreRules reports whether rel is ignored. Rules from deeper ignore
+// files and later lines take precedence.
+func matchIgnoreRules(stack []*ignoreRules, rel string, isDir bool) bool {
+	ignored := false
+	for _, ir := range stack {
+		name := rel
+		if ir.base != "" {
+			name = strings.TrimPrefix(rel, ir.base+"/")
+		}
+		segments := strings.Split(name, "/")
+		for _, rule := range ir.rules {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if matchSegments(rule.segments, segments) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
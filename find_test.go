@@ -0,0 +1,192 @@
+package iutils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/tool/main.go", true},
+		{"cmd/**", "cmd", true},
+		{"cmd/**/main.go", "cmd/a/b/main.go", true},
+		{"cmd/**/main.go", "pkg/a/main.go", false},
+		{"a/**/**/b", "a/b", true},
+		{"a/?/c", "a/b/c", true},
+	}
+
+	for _, tt := range tests {
+		got, err := MatchPattern(tt.pattern, tt.name)
+		if err != nil {
+			t.Fatalf("MatchPattern(%q, %q) error = %v", tt.pattern, tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("MatchPattern(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := MatchPattern("[", "x"); err == nil {
+		t.Errorf("MatchPattern() expected error for bad pattern")
+	}
+}
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		"a.txt":              "a",
+		"B.TXT":              "bb",
+		"c.log":              "ccc",
+		"src/main.go":        "package main",
+		"src/lib/util.go":    "package lib",
+		"src/lib/util.txt":   "notes",
+		"build/out.txt":      "out",
+		"vendor/x/x.go":      "package x",
+		".git/config":        "[core]",
+		"docs/big.md":        "0123456789",
+		"docs/.gitignore":    "*.tmp\n!keep.tmp\n",
+		"docs/a.tmp":         "tmp",
+		"docs/keep.tmp":      "tmp",
+		".gitignore":         "build/\n/vendor\n",
+		"nested/deep/z.txt":  "z",
+		"nested/deep/zz.txt": "zz",
+	})
+
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "a.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	rel := func(paths []string) []string {
+		out := []string{}
+		for _, p := range paths {
+			r, err := filepath.Rel(root, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, filepath.ToSlash(r))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name string
+		opts *FindOptions
+		want []string
+	}{
+		{
+			name: "exts",
+			opts: &FindOptions{Exts: []string{".txt", ".go"}, ExcludeDirs: []string{".git"}},
+			want: []string{"a.txt", "build/out.txt", "nested/deep/z.txt", "nested/deep/zz.txt", "src/lib/util.go", "src/lib/util.txt", "src/main.go", "vendor/x/x.go"},
+		},
+		{
+			name: "exts ignore case",
+			opts: &FindOptions{Exts: []string{".txt"}, IgnoreCase: true, MaxDepth: 1},
+			want: []string{"B.TXT", "a.txt"},
+		},
+		{
+			name: "doublestar",
+			opts: &FindOptions{Patterns: []string{"src/**/*.go"}},
+			want: []string{"src/lib/util.go", "src/main.go"},
+		},
+		{
+			name: "regexp",
+			opts: &FindOptions{NameRegexp: regexp.MustCompile(`^z+\.txt$`)},
+			want: []string{"nested/deep/z.txt", "nested/deep/zz.txt"},
+		},
+		{
+			name: "size",
+			opts: &FindOptions{MinSize: 5, MaxSize: 10, ExcludeDirs: []string{".git", "vendor"}},
+			want: []string{"docs/big.md", "src/lib/util.txt"},
+		},
+		{
+			name: "mtime",
+			opts: &FindOptions{ModifiedBefore: time.Now().Add(-time.Minute)},
+			want: []string{"a.txt"},
+		},
+		{
+			name: "include dirs",
+			opts: &FindOptions{IncludeDirs: []string{"src/**"}, Exts: []string{".txt"}},
+			want: []string{"src/lib/util.txt"},
+		},
+		{
+			name: "gitignore",
+			opts: &FindOptions{IgnoreFile: ".gitignore", ExcludeDirs: []string{".git", "src", "nested"}},
+			want: []string{".gitignore", "B.TXT", "a.txt", "c.log", "docs/.gitignore", "docs/big.md", "docs/keep.tmp"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Find(root, tt.opts)
+			if err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			if !reflect.DeepEqual(rel(got), tt.want) {
+				t.Errorf("Find() = %v, want %v", rel(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestFindSymlinks(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{"dir/file.txt": "x"})
+	if err := os.Symlink(filepath.Join(root, "dir"), filepath.Join(root, "dir", "loop")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "dir", "file.txt"), filepath.Join(root, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Find(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(root, "dir", "file.txt")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Find() without FollowSymlinks = %v, want %v", got, want)
+	}
+
+	got, err = Find(root, &FindOptions{FollowSymlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(root, "dir", "file.txt"), filepath.Join(root, "link.txt")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Find() with FollowSymlinks = %v, want %v", got, want)
+	}
+}
+
+func TestFindSeqStop(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{"a": "", "b": "", "c": ""})
+
+	var seen []string
+	FindSeq(root, nil)(func(path string, err error) bool {
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen = append(seen, filepath.Base(path))
+		return len(seen) < 2
+	})
+	if !reflect.DeepEqual(seen, []string{"a", "b"}) {
+		t.Errorf("FindSeq() yielded %v after stop, want [a b]", seen)
+	}
+
+	if _, err := Find(filepath.Join(root, "missing"), nil); err == nil {
+		t.Errorf("Find() expected error for missing root")
+	}
+	if _, err := Find(root, &FindOptions{Patterns: []string{"["}}); err == nil {
+		t.Errorf("Find() expected error for bad pattern")
+	}
+}
@@ -0,0 +1,388 @@
+package iutils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"time"
+)
+
+// FollowOptions configures OpenFollower. A nil *FollowOptions reads lines
+// from the start of the file and keeps no checkpoint.
+type FollowOptions struct {
+	// FromEnd starts at the end of the file instead of the beginning when
+	// there is no usable checkpoint.
+	FromEnd bool
+	// Checkpoint names a file that stores the read position. A follower
+	// opened with an existing checkpoint resumes where the last one
+	// stopped, as long as the file was not rotated in between.
+	Checkpoint string
+	// CheckpointInterval is how often the position is saved, every call
+	// of Next if zero. It is always saved by Close.
+	CheckpointInterval time.Duration
+
+	// Split cuts records out of the data, bufio.ScanLines if nil. It is
+	// called with atEOF set only when the file was rotated or FlushAfter
+	// expired, so an incomplete last record waits for more data.
+	Split bufio.SplitFunc
+	// FlushAfter hands out an incomplete record once the file has not
+	// grown for this long. Zero waits forever.
+	FlushAfter time.Duration
+	// MaxRecordSize limits the size of one record, 1 MiB if zero.
+	MaxRecordSize int
+	// PollInterval is how often the file is checked for new data, 250ms if
+	// zero.
+	PollInterval time.Duration
+}
+
+// FollowRecord is a record read by a Follower.
+type FollowRecord struct {
+	Data []byte
+	// Offset is the position of the record in the file it was read from.
+	Offset int64
+}
+
+// Follower reads records appended to a file, like tail -F. It reopens the
+// file when it is rotated, that is replaced by a new file of the same name,
+// and starts over when it is truncated.
+type Follower struct {
+	path string
+	opts FollowOptions
+	file *os.File
+
+	buf   []byte // data read but not yet returned
+	start int64  // file offset of buf[0]
+
+	returned  int64 // offset after the last returned record
+	committed int64 // offset after the records known to be processed
+	saved     int64
+	lastSave  time.Time
+	grown     time.Time
+}
+
+// followCheckpoint is the content of a checkpoint file.
+type followCheckpoint struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	Dev    uint64 `json:"dev,omitempty"`
+	Ino    uint64 `json:"ino,omitempty"`
+	// Head is the XXH64 of the first bytes of the file, up to
+	// followHeadSize or Offset, to notice a new file reusing the inode.
+	Head uint64 `json:"head"`
+}
+
+const followHeadSize = 1024
+
+// followHead returns the hash of the first n bytes of file, n limited to
+// followHeadSize.
+func followHead(file *os.File, n int64) (uint64, error) {
+	if n > followHeadSize {
+		n = followHeadSize
+	}
+	buf := make([]byte, n)
+	if _, err := file.ReadAt(buf, 0); err != nil && err != io.EOF {
+		return 0, err
+	}
+	h := NewXXH64()
+	h.Write(buf)
+	return h.Sum64(), nil
+}
+
+// OpenFollower opens path for following.
+func OpenFollower(path string, opts *FollowOptions) (*Follower, error) {
+	f := &Follower{path: path, saved: -1, grown: time.Now()}
+	if opts != nil {
+		f.opts = *opts
+	}
+	if f.opts.Split == nil {
+		f.opts.Split = bufio.ScanLines
+	}
+	if f.opts.MaxRecordSize <= 0 {
+		f.opts.MaxRecordSize = 1 << 20
+	}
+	if f.opts.PollInterval <= 0 {
+		f.opts.PollInterval = 250 * time.Millisecond
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	f.file = file
+
+	offset := int64(0)
+	if f.opts.FromEnd {
+		offset = info.Size()
+	}
+	if f.opts.Checkpoint != "" {
+		cp, err := readFollowCheckpoint(f.opts.Checkpoint)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			file.Close()
+			return nil, err
+		}
+		if err == nil {
+			// A file rotated while we were away is read from its start.
+			offset = 0
+			same := cp.Offset <= info.Size()
+			if id, ok := fileIdentity(info); ok && same {
+				same = id.dev == cp.Dev && id.ino == cp.Ino
+			}
+			if same {
+				head, err := followHead(file, cp.Offset)
+				if err != nil {
+					file.Close()
+					return nil, err
+				}
+				if head == cp.Head {
+					offset = cp.Offset
+				}
+			}
+		}
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	f.start, f.returned, f.committed = offset, offset, offset
+	return f, nil
+}
+
+func readFollowCheckpoint(filename string) (followCheckpoint, error) {
+	var cp followCheckpoint
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return cp, err
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return cp, fmt.Errorf("%s: %w", filename, err)
+	}
+	return cp, nil
+}
+
+// Offset returns the position after the last record returned by Next.
+func (f *Follower) Offset() int64 {
+	return f.returned
+}
+
+// Next returns the next record, waiting for it to be written until ctx is
+// done. Calling Next marks the previous record as processed for the
+// checkpoint, so records are delivered at least once across restarts.
+func (f *Follower) Next(ctx context.Context) (FollowRecord, error) {
+	f.committed = f.returned
+	if f.opts.Checkpoint != "" && time.Since(f.lastSave) >= f.opts.CheckpointInterval {
+		if err := f.Checkpoint(); err != nil {
+			return FollowRecord{}, err
+		}
+	}
+
+	for {
+		if rec, ok, err := f.split(false); ok || err != nil {
+			return rec, err
+		}
+
+		n, err := f.read()
+		if err != nil {
+			return FollowRecord{}, err
+		}
+		if n > 0 {
+			f.grown = time.Now()
+			continue
+		}
+
+		// At the end of the file: look for truncation and rotation.
+		next, err := f.checkFile()
+		if err != nil {
+			return FollowRecord{}, err
+		}
+		if next != nil {
+			// Everything left in the old file is a complete record.
+			if rec, ok, err := f.split(true); ok || err != nil {
+				next.Close()
+				return rec, err
+			}
+			f.file.Close()
+			f.file, f.buf, f.start, f.returned = next, f.buf[:0], 0, 0
+			continue
+		}
+		if f.opts.FlushAfter > 0 && len(f.buf) > 0 && time.Since(f.grown) >= f.opts.FlushAfter {
+			if rec, ok, err := f.split(true); ok || err != nil {
+				return rec, err
+			}
+		}
+
+		timer := time.NewTimer(f.opts.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return FollowRecord{}, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// split cuts the next record out of the buffer.
+func (f *Follower) split(atEOF bool) (FollowRecord, bool, error) {
+	for len(f.buf) > 0 {
+		advance, token, err := f.opts.Split(f.buf, atEOF)
+		if err != nil && err != bufio.ErrFinalToken {
+			return FollowRecord{}, false, err
+		}
+		if advance == 0 && token == nil {
+			if len(f.buf) >= f.opts.MaxRecordSize {
+				return FollowRecord{}, false, fmt.Errorf("%s: record at offset %d: %w", f.path, f.start, bufio.ErrTooLong)
+			}
+			return FollowRecord{}, false, nil
+		}
+		if advance < 0 || advance > len(f.buf) {
+			return FollowRecord{}, false, fmt.Errorf("%s: split function advanced %d of %d bytes", f.path, advance, len(f.buf))
+		}
+
+		rec := FollowRecord{Data: append([]byte(nil), token...), Offset: f.start}
+		f.buf = f.buf[advance:]
+		f.start += int64(advance)
+		f.returned = f.start
+		if token != nil {
+			return rec, true, nil
+		}
+	}
+	return FollowRecord{}, false, nil
+}
+
+// read appends the next chunk of the file to the buffer.
+func (f *Follower) read() (int, error) {
+	if cap(f.buf)-len(f.buf) < 32*1024 {
+		grown := make([]byte, len(f.buf), 2*len(f.buf)+64*1024)
+		copy(grown, f.buf)
+		f.buf = grown
+	}
+	n, err := f.file.Read(f.buf[len(f.buf):cap(f.buf)])
+	f.buf = f.buf[:len(f.buf)+n]
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// checkFile handles a truncated file and returns the new file if path has
+// been rotated.
+func (f *Follower) checkFile() (*os.File, error) {
+	current, err := f.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if current.Size() < f.start+int64(len(f.buf)) {
+		// Truncated in place, e.g. by copytruncate.
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		f.buf, f.start, f.returned = f.buf[:0], 0, 0
+		return nil, nil
+	}
+
+	info, err := os.Stat(f.path)
+	if err != nil || os.SameFile(info, current) {
+		// A missing path is a rotation in progress; keep the old file.
+		return nil, nil
+	}
+	next, err := os.Open(f.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return next, nil
+}
+
+// Checkpoint saves the position of the processed records, see Next.
+func (f *Follower) Checkpoint() error {
+	if f.opts.Checkpoint == "" || f.committed == f.saved {
+		return nil
+	}
+	cp := followCheckpoint{Path: f.path, Offset: f.committed}
+	if info, err := f.file.Stat(); err == nil {
+		if id, ok := fileIdentity(info); ok {
+			cp.Dev, cp.Ino = id.dev, id.ino
+		}
+	}
+	head, err := followHead(f.file, f.committed)
+	if err != nil {
+		return err
+	}
+	cp.Head = head
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if err := mkdirParent(f.opts.Checkpoint, 0755); err != nil {
+		return err
+	}
+	if err := WriteFile3(f.opts.Checkpoint, data); err != nil {
+		return err
+	}
+	f.saved, f.lastSave = f.committed, time.Now()
+	return nil
+}
+
+// Close saves the checkpoint, counting the last returned record as
+// processed, and closes the file.
+func (f *Follower) Close() error {
+	f.committed = f.returned
+	err := f.Checkpoint()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// MultilineSplit returns a split function for records spanning several
+// lines, such as stack traces. A record starts with a line matching start
+// and continues with the following lines that do not match it. Records are
+// returned without their final line break.
+func MultilineSplit(start *regexp.Regexp) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		first := bytes.IndexByte(data, '\n')
+		if first < 0 {
+			if atEOF && len(data) > 0 {
+				return len(data), trimLineBreak(data), nil
+			}
+			return 0, nil, nil
+		}
+
+		pos := first + 1
+		for {
+			next := bytes.IndexByte(data[pos:], '\n')
+			if next < 0 {
+				if !atEOF {
+					return 0, nil, nil
+				}
+				if rest := data[pos:]; len(rest) > 0 && !start.Match(rest) {
+					pos = len(data)
+				}
+				return pos, trimLineBreak(data[:pos]), nil
+			}
+			if start.Match(trimLineBreak(data[pos : pos+next])) {
+				return pos, trimLineBreak(data[:pos]), nil
+			}
+			pos += next + 1
+		}
+	}
+}
+
+func trimLineBreak(data []byte) []byte {
+	data = bytes.TrimSuffix(data, []byte{'\n'})
+	return bytes.TrimSuffix(data, []byte{'\r'})
+}
@@ -0,0 +1,176 @@
+package iutils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func appendTestFile(t *testing.T, filename, data string) {
+	t.Helper()
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectRecords reads len(want) records from f within a timeout.
+func expectRecords(t *testing.T, f *Follower, want ...string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, w := range want {
+		rec, err := f.Next(ctx)
+		if err != nil {
+			t.Fatalf("Next() error = %v, want record %q", err, w)
+		}
+		if string(rec.Data) != w {
+			t.Fatalf("Next() = %q, want %q", rec.Data, w)
+		}
+	}
+}
+
+// expectNoRecord checks that f has nothing to return right now.
+func expectNoRecord(t *testing.T, f *Follower) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if rec, err := f.Next(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Next() = %q, %v, want %v", rec.Data, err, context.DeadlineExceeded)
+	}
+}
+
+func TestFollowerAppendTruncateRotate(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	appendTestFile(t, filename, "a\nb\nc")
+
+	f, err := OpenFollower(filename, &FollowOptions{PollInterval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	expectRecords(t, f, "a", "b")
+	// The last line is incomplete until its line break is written.
+	expectNoRecord(t, f)
+	appendTestFile(t, filename, "\nd\n")
+	expectRecords(t, f, "c", "d")
+	if f.Offset() != 8 {
+		t.Errorf("Offset() = %d, want 8", f.Offset())
+	}
+
+	if err := os.Truncate(filename, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendTestFile(t, filename, "e\n")
+	expectRecords(t, f, "e")
+
+	// Rotate: the old file gets a last line after the rename and a new file
+	// takes its name.
+	if err := os.Rename(filename, filename+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendTestFile(t, filename+".1", "f\ng")
+	appendTestFile(t, filename, "h\n")
+	expectRecords(t, f, "f", "g", "h")
+	if f.Offset() != 2 {
+		t.Errorf("Offset() after rotation = %d, want 2", f.Offset())
+	}
+}
+
+func TestFollowerCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	checkpoint := filepath.Join(dir, "state", "app.offset")
+	appendTestFile(t, filename, "a\nb\nc\n")
+	opts := &FollowOptions{Checkpoint: checkpoint, PollInterval: 5 * time.Millisecond}
+
+	f, err := OpenFollower(filename, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRecords(t, f, "a", "b")
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	f, err = OpenFollower(filename, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// c was never returned, so the follower resumes with it.
+	expectRecords(t, f, "c")
+	f.Close()
+
+	// A file replaced while no follower ran is read from its start.
+	if err := os.Remove(filename); err != nil {
+		t.Fatal(err)
+	}
+	appendTestFile(t, filename, "x\ny\nz\n")
+	f, err = OpenFollower(filename, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	expectRecords(t, f, "x")
+
+	f2, err := OpenFollower(filename, &FollowOptions{FromEnd: true, PollInterval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+	expectNoRecord(t, f2)
+	appendTestFile(t, filename, "new\n")
+	expectRecords(t, f2, "new")
+}
+
+func TestFollowerMultiline(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	appendTestFile(t, filename, "2024 start\n  at a\n  at b\n2024 next\n")
+
+	f, err := OpenFollower(filename, &FollowOptions{
+		Split:        MultilineSplit(regexp.MustCompile(`^\d{4} `)),
+		FlushAfter:   20 * time.Millisecond,
+		PollInterval: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	expectRecords(t, f, "2024 start\n  at a\n  at b", "2024 next")
+	appendTestFile(t, filename, "2024 last\r\n  more\r\n")
+	expectRecords(t, f, "2024 last\r\n  more")
+}
+
+func TestMultilineSplit(t *testing.T) {
+	split := MultilineSplit(regexp.MustCompile(`^\S`))
+	tests := []struct {
+		data    string
+		atEOF   bool
+		advance int
+		token   string
+	}{
+		{"a\n b\nc\n", false, 5, "a\n b"},
+		{"a\n b\n", false, 0, ""},
+		{"a\n b\n", true, 5, "a\n b"},
+		{"a\n b\nc", true, 5, "a\n b"},
+		{"a\n b\n c", true, 7, "a\n b\n c"},
+		{"a", false, 0, ""},
+		{"a", true, 1, "a"},
+	}
+	for _, tt := range tests {
+		advance, token, err := split([]byte(tt.data), tt.atEOF)
+		if err != nil || advance != tt.advance || string(token) != tt.token {
+			t.Errorf("split(%q, %v) = %d, %q, %v, want %d, %q", tt.data, tt.atEOF, advance, token, err, tt.advance, tt.token)
+		}
+	}
+}
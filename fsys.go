@@ -0,0 +1,217 @@
+package iutils
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// WritableFS is an fs.FS that can also be modified. Names are slash
+// separated and unrooted, as for fs.FS. DirFS writes to a directory on
+// disk; MemFS keeps everything in memory for tests.
+type WritableFS interface {
+	fs.FS
+	// OpenFile opens name with the os.O_* flags, as os.OpenFile does.
+	OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error)
+	// MkdirAll creates a directory and its missing parents.
+	MkdirAll(name string, perm fs.FileMode) error
+	// Remove removes a file or an empty directory.
+	Remove(name string) error
+	// Rename moves oldname to newname, replacing an existing file.
+	Rename(oldname, newname string) error
+}
+
+// WritableFile is a file opened by a WritableFS.
+type WritableFile interface {
+	fs.File
+	io.Writer
+	io.Seeker
+	io.ReaderAt
+	Sync() error
+}
+
+// osFS is a WritableFS backed by a directory.
+type osFS struct {
+	dir string
+	fs.FS
+}
+
+// DirFS returns a WritableFS for the files below dir, extending os.DirFS.
+func DirFS(dir string) WritableFS {
+	return &osFS{dir: dir, FS: os.DirFS(dir)}
+}
+
+func (o *osFS) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(o.dir, filepath.FromSlash(name)), nil
+}
+
+func (o *osFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	full, err := o.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(full, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (o *osFS) MkdirAll(name string, perm fs.FileMode) error {
+	full, err := o.join("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(full, perm)
+}
+
+func (o *osFS) Remove(name string) error {
+	full, err := o.join("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(full)
+}
+
+func (o *osFS) Rename(oldname, newname string) error {
+	oldFull, err := o.join("rename", oldname)
+	if err != nil {
+		return err
+	}
+	newFull, err := o.join("rename", newname)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldFull, newFull)
+}
+
+// ReadFileFS is ReadFile for a file of fsys.
+func ReadFileFS(fsys fs.FS, name string) ([]byte, error) {
+	return fs.ReadFile(fsys, name)
+}
+
+// ReadFilePartsFS is ReadFileParts for a file of fsys.
+func ReadFilePartsFS(fsys fs.FS, name string, fileoffset int64, length int64) ([]byte, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if s, ok := file.(io.Seeker); ok {
+		if _, err := s.Seek(fileoffset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	} else if _, err := io.CopyN(io.Discard, file, fileoffset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return io.ReadAll(io.LimitReader(file, length))
+}
+
+// writeFileFS writes data to a file opened with flag, failing on short
+// writes.
+func writeFileFS(fsys WritableFS, name string, flag int, perm fs.FileMode, fileoffset int64, data []byte, sync bool) error {
+	file, err := fsys.OpenFile(name, flag, perm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if fileoffset > 0 {
+		if _, err := file.Seek(fileoffset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	n, err := file.Write(data)
+	if err != nil {
+		return err
+	}
+	if n != len(data) {
+		return fmt.Errorf("only wrote %d bytes out of %d", n, len(data))
+	}
+	if sync {
+		if err := file.Sync(); err != nil {
+			return err
+		}
+	}
+	return file.Close()
+}
+
+// WriteFileFS is WriteFile for a file of fsys.
+func WriteFileFS(fsys WritableFS, name string, data []byte) error {
+	return writeFileFS(fsys, name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644, 0, data, false)
+}
+
+// WriteFile2FS is WriteFile2 for a file of fsys: missing parent
+// directories are created.
+func WriteFile2FS(fsys WritableFS, name string, data []byte) error {
+	if err := fsys.MkdirAll(path.Dir(name), 0755); err != nil {
+		return err
+	}
+	return WriteFileFS(fsys, name, data)
+}
+
+// WriteFile3FS is WriteFile3 for a file of fsys: data is written to a
+// synced temporary file that is renamed over name.
+func WriteFile3FS(fsys WritableFS, name string, data []byte) error {
+	tmp := path.Join(path.Dir(name), ".tmp-"+path.Base(name)+"-"+GenerateRandomString(8))
+	err := writeFileFS(fsys, tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644, 0, data, true)
+	if err == nil {
+		err = fsys.Rename(tmp, name)
+	}
+	if err != nil {
+		fsys.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// WriteFilePartsFS is WriteFileParts for a file of fsys.
+func WriteFilePartsFS(fsys WritableFS, name string, fileoffset int64, data []byte) error {
+	if err := fsys.MkdirAll(path.Dir(name), 0755); err != nil {
+		return err
+	}
+	return writeFileFS(fsys, name, os.O_RDWR|os.O_CREATE, 0644, fileoffset, data, false)
+}
+
+// CalcFileMD5FS is CalcFileMD5 for a file of fsys.
+func CalcFileMD5FS(fsys fs.FS, name string) (string, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := md5.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// FindFilesWithExtFS is FindFilesWithExt for the files of fsys below dir.
+// The names are returned in lexical order.
+func FindFilesWithExtFS(fsys fs.FS, dir, ext string) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if IsTargetExt(d, ext) {
+			files = append(files, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
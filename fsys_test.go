@@ -0,0 +1,63 @@
+package iutils
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func TestFSHelpers(t *testing.T) {
+	for name, fsys := range map[string]WritableFS{"dir": DirFS(t.TempDir()), "mem": NewMemFS()} {
+		t.Run(name, func(t *testing.T) {
+			if err := WriteFile2FS(fsys, "a/b/c.txt", []byte("hello world")); err != nil {
+				t.Fatalf("WriteFile2FS() error = %v", err)
+			}
+			if err := WriteFilePartsFS(fsys, "a/b/c.txt", 6, []byte("there")); err != nil {
+				t.Fatalf("WriteFilePartsFS() error = %v", err)
+			}
+			if err := WriteFilePartsFS(fsys, "parts/p.bin", 3, []byte("x")); err != nil {
+				t.Fatalf("WriteFilePartsFS() new file error = %v", err)
+			}
+			if err := WriteFile3FS(fsys, "a/d.txt", []byte("atomic")); err != nil {
+				t.Fatalf("WriteFile3FS() error = %v", err)
+			}
+			if err := WriteFile3FS(fsys, "a/d.txt", []byte("again")); err != nil {
+				t.Fatalf("WriteFile3FS() replace error = %v", err)
+			}
+			if err := WriteFileFS(fsys, "a/e.log", []byte("log")); err != nil {
+				t.Fatalf("WriteFileFS() error = %v", err)
+			}
+			if err := WriteFileFS(fsys, "missing/e.log", nil); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("WriteFileFS() without parent error = %v, want %v", err, fs.ErrNotExist)
+			}
+
+			if data, err := ReadFileFS(fsys, "a/b/c.txt"); err != nil || string(data) != "hello there" {
+				t.Errorf("ReadFileFS() = %q, %v", data, err)
+			}
+			if data, err := ReadFilePartsFS(fsys, "a/b/c.txt", 6, 3); err != nil || string(data) != "the" {
+				t.Errorf("ReadFilePartsFS() = %q, %v", data, err)
+			}
+			if data, err := ReadFileFS(fsys, "parts/p.bin"); err != nil || string(data) != "\x00\x00\x00x" {
+				t.Errorf("ReadFileFS() of parts = %q, %v", data, err)
+			}
+			if data, err := ReadFileFS(fsys, "a/d.txt"); err != nil || string(data) != "again" {
+				t.Errorf("ReadFileFS() after WriteFile3FS = %q, %v", data, err)
+			}
+			if sum, err := CalcFileMD5FS(fsys, "a/e.log"); err != nil || sum != "dc1d71bbb5c4d2a5e936db79ef10c19f" {
+				t.Errorf("CalcFileMD5FS() = %s, %v", sum, err)
+			}
+
+			files, err := FindFilesWithExtFS(fsys, ".", ".txt")
+			if want := []string{"a/b/c.txt", "a/d.txt"}; err != nil || !reflect.DeepEqual(files, want) {
+				t.Errorf("FindFilesWithExtFS() = %v, %v, want %v", files, err, want)
+			}
+			if _, err := ReadFileFS(fsys, "../escape"); err == nil {
+				t.Errorf("ReadFileFS() of an invalid name succeeded")
+			}
+			if err := WriteFileFS(fsys, "/abs", nil); !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("WriteFileFS() of an absolute name error = %v, want %v", err, fs.ErrInvalid)
+			}
+		})
+	}
+}
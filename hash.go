@@ -0,0 +1,191 @@
+package iutils
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+)
+
+// HashAlgorithm identifies a digest supported by HashFile.
+type HashAlgorithm int
+
+const (
+	HashMD5 HashAlgorithm = iota + 1
+	HashSHA1
+	HashSHA256
+	HashSHA512
+	HashCRC32C
+	HashXXH64
+)
+
+var hashAlgorithmNames = map[HashAlgorithm]string{
+	HashMD5:    "md5",
+	HashSHA1:   "sha1",
+	HashSHA256: "sha256",
+	HashSHA512: "sha512",
+	HashCRC32C: "crc32c",
+	HashXXH64:  "xxh64",
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+func (a HashAlgorithm) String() string {
+	if name, ok := hashAlgorithmNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("HashAlgorithm(%d)", int(a))
+}
+
+// New returns a fresh hash.Hash for the algorithm, or nil if a is unknown.
+func (a HashAlgorithm) New() hash.Hash {
+	switch a {
+	case HashMD5:
+		return md5.New()
+	case HashSHA1:
+		return sha1.New()
+	case HashSHA256:
+		return sha256.New()
+	case HashSHA512:
+		return sha512.New()
+	case HashCRC32C:
+		return crc32.New(crc32cTable)
+	case HashXXH64:
+		return NewXXH64()
+	}
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (a HashAlgorithm) MarshalText() ([]byte, error) {
+	if _, ok := hashAlgorithmNames[a]; !ok {
+		return nil, fmt.Errorf("unknown hash algorithm %v", a)
+	}
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (a *HashAlgorithm) UnmarshalText(text []byte) error {
+	algo, err := ParseHashAlgorithm(string(text))
+	if err != nil {
+		return err
+	}
+	*a = algo
+	return nil
+}
+
+// ParseHashAlgorithm returns the algorithm with the given name, e.g. "sha256".
+func ParseHashAlgorithm(name string) (HashAlgorithm, error) {
+	name = strings.ToLower(strings.ReplaceAll(name, "-", ""))
+	for algo, algoName := range hashAlgorithmNames {
+		if algoName == name {
+			return algo, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown hash algorithm %q", name)
+}
+
+// FileHashes holds the digests computed by a single pass over some data.
+type FileHashes struct {
+	Size int64
+	Sums map[HashAlgorithm][]byte
+}
+
+// Hex returns the hex encoded digest for algo, or "" if it was not computed.
+func (h *FileHashes) Hex(algo HashAlgorithm) string {
+	sum, ok := h.Sums[algo]
+	if !ok {
+		return ""
+	}
+	return hex.EncodeToString(sum)
+}
+
+// HashReader reads r until EOF and computes all algos in a single pass.
+// SHA-256 is used when no algorithm is given.
+func HashReader(ctx context.Context, r io.Reader, algos ...HashAlgorithm) (*FileHashes, error) {
+	if len(algos) == 0 {
+		algos = []HashAlgorithm{HashSHA256}
+	}
+
+	hashers := make(map[HashAlgorithm]hash.Hash, len(algos))
+	writers := make([]io.Writer, 0, len(algos))
+	for _, algo := range algos {
+		if _, ok := hashers[algo]; ok {
+			continue
+		}
+		hasher := algo.New()
+		if hasher == nil {
+			return nil, fmt.Errorf("unknown hash algorithm %v", algo)
+		}
+		hashers[algo] = hasher
+		writers = append(writers, hasher)
+	}
+
+	n, err := io.Copy(io.MultiWriter(writers...), &ctxReader{ctx: ctx, r: r})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &FileHashes{Size: n, Sums: make(map[HashAlgorithm][]byte, len(hashers))}
+	for algo, hasher := range hashers {
+		result.Sums[algo] = hasher.Sum(nil)
+	}
+	return result, nil
+}
+
+// HashFile computes all algos over the content of filename.
+func HashFile(ctx context.Context, filename string, algos ...HashAlgorithm) (*FileHashes, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return HashReader(ctx, file, algos...)
+}
+
+// HashFileParts computes all algos over length bytes of filename starting at
+// fileoffset, the same range ReadFileParts would return.
+func HashFileParts(ctx context.Context, filename string, fileoffset int64, length int64, algos ...HashAlgorithm) (*FileHashes, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	_, err = file.Seek(fileoffset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return HashReader(ctx, io.LimitReader(file, length), algos...)
+}
+
+// CalcFileSHA256 计算并返回指定文件的SHA-256哈希值
+func CalcFileSHA256(filename string) (string, error) {
+	hashes, err := HashFile(context.Background(), filename, HashSHA256)
+	if err != nil {
+		return "", err
+	}
+	return hashes.Hex(HashSHA256), nil
+}
+
+// ctxReader stops reading once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
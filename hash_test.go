@@ -0,0 +1,143 @@
+package iutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestXXH64(t *testing.T) {
+	tests := []struct {
+		input string
+		want  uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"abc", 0x44bc2cf5ad770999},
+		{"The quick brown fox jumps over the lazy dog", 0x0b242d361fda71bc},
+		{strings.Repeat("a", 100), 0x375041e8b1decfb3},
+	}
+
+	for _, tt := range tests {
+		h := NewXXH64()
+		h.Write([]byte(tt.input))
+		if got := h.Sum64(); got != tt.want {
+			t.Errorf("XXH64(%q) = %016x, want %016x", tt.input, got, tt.want)
+		}
+
+		// Feeding the data byte by byte must give the same result.
+		h.Reset()
+		for i := 0; i < len(tt.input); i++ {
+			h.Write([]byte{tt.input[i]})
+		}
+		if got := h.Sum64(); got != tt.want {
+			t.Errorf("XXH64(%q) streamed = %016x, want %016x", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "hash.txt")
+	if err := os.WriteFile(filename, []byte("123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hashes, err := HashFile(context.Background(), filename,
+		HashMD5, HashSHA1, HashSHA256, HashSHA512, HashCRC32C, HashXXH64)
+	if err != nil {
+		t.Fatalf("HashFile() error = %v", err)
+	}
+
+	want := map[HashAlgorithm]string{
+		HashMD5:    "25f9e794323b453885f5181f1b624d0b",
+		HashSHA1:   "f7c3bc1d808e04732adf679965ccc34ca7ae3441",
+		HashSHA256: "15e2b0d3c33891ebb0f1ef609ec419420c20e320ce94c65fbc8c3312448eb225",
+		HashCRC32C: "e3069283",
+	}
+	for algo, sum := range want {
+		if got := hashes.Hex(algo); got != sum {
+			t.Errorf("%v = %s, want %s", algo, got, sum)
+		}
+	}
+	if hashes.Size != 9 {
+		t.Errorf("Size = %d, want 9", hashes.Size)
+	}
+	if len(hashes.Sums[HashSHA512]) != 64 || len(hashes.Sums[HashXXH64]) != 8 {
+		t.Errorf("unexpected digest lengths")
+	}
+
+	md5Sum, err := CalcFileMD5(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md5Sum != hashes.Hex(HashMD5) {
+		t.Errorf("HashFile md5 = %s, CalcFileMD5 = %s", hashes.Hex(HashMD5), md5Sum)
+	}
+
+	if _, err := HashFile(context.Background(), filename+".missing"); err == nil {
+		t.Errorf("HashFile() expected error for missing file")
+	}
+}
+
+func TestHashFileParts(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "parts.txt")
+	if err := os.WriteFile(filename, []byte("xxx123456789yyy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hashes, err := HashFileParts(context.Background(), filename, 3, 9, HashCRC32C)
+	if err != nil {
+		t.Fatalf("HashFileParts() error = %v", err)
+	}
+	if got := hashes.Hex(HashCRC32C); got != "e3069283" {
+		t.Errorf("crc32c = %s, want e3069283", got)
+	}
+
+	if _, err := HashFileParts(context.Background(), filename, -1, 9); err == nil {
+		t.Errorf("HashFileParts() expected error for negative offset")
+	}
+}
+
+func TestHashReaderCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := HashReader(ctx, bytes.NewReader([]byte("data")))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("HashReader() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestParseHashAlgorithm(t *testing.T) {
+	for algo, name := range hashAlgorithmNames {
+		got, err := ParseHashAlgorithm(strings.ToUpper(name))
+		if err != nil || got != algo {
+			t.Errorf("ParseHashAlgorithm(%q) = %v, %v", name, got, err)
+		}
+	}
+	if got, err := ParseHashAlgorithm("SHA-256"); err != nil || got != HashSHA256 {
+		t.Errorf("ParseHashAlgorithm(SHA-256) = %v, %v", got, err)
+	}
+	if _, err := ParseHashAlgorithm("md4"); err == nil {
+		t.Errorf("ParseHashAlgorithm(md4) expected error")
+	}
+}
+
+func TestCalcFileSHA256(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "abc.txt")
+	if err := os.WriteFile(filename, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := CalcFileSHA256(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if sum != want {
+		t.Errorf("CalcFileSHA256() = %s, want %s", sum, want)
+	}
+}
@@ -0,0 +1,269 @@
+package iutils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrJSONLinesWriterClosed is returned by a JSONLinesWriter after Close.
+var ErrJSONLinesWriterClosed = errors.New("iutils: JSON Lines writer closed")
+
+// DefaultMaxJSONLineSize is the longest record the JSON Lines readers
+// accept unless JSONLinesOptions.MaxLineSize says otherwise.
+const DefaultMaxJSONLineSize = 16 << 20
+
+// JSONLinesOptions configures ReadJSONLines and ReadJSONLinesFile.
+type JSONLinesOptions struct {
+	// Strict rejects fields that do not exist in the record type.
+	Strict bool
+	// SkipInvalid keeps reading after a malformed record. The record is
+	// still reported as a *DecodeError; without SkipInvalid it ends the
+	// iteration.
+	SkipInvalid bool
+	// MaxLineSize limits the length of one line, DefaultMaxJSONLineSize if
+	// zero. A longer line always ends the iteration.
+	MaxLineSize int
+}
+
+// jsonLinesDecoder decodes one record per line, skipping empty lines.
+type jsonLinesDecoder struct {
+	scanner *bufio.Scanner
+	strict  bool
+	line    int
+}
+
+func newJSONLinesDecoder(r io.Reader, strict bool, maxLineSize int) *jsonLinesDecoder {
+	if maxLineSize <= 0 {
+		maxLineSize = DefaultMaxJSONLineSize
+	}
+	// The scanner ignores the limit while the initial buffer has room.
+	initial := 64 * 1024
+	if maxLineSize < initial {
+		initial = maxLineSize
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, initial), maxLineSize)
+	return &jsonLinesDecoder{scanner: scanner, strict: strict}
+}
+
+// next decodes the next record into v. It returns io.EOF after the last
+// record and a *DecodeError for a malformed one.
+func (d *jsonLinesDecoder) next(v interface{}) error {
+	for d.scanner.Scan() {
+		d.line++
+		line := d.scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if err := decodeJSON(line, v, d.strict, false); err != nil {
+			de := err.(*DecodeError)
+			de.Line = d.line
+			return de
+		}
+		return nil
+	}
+
+	err := d.scanner.Err()
+	if errors.Is(err, bufio.ErrTooLong) {
+		return &DecodeError{Line: d.line + 1, Column: 1, Err: err}
+	}
+	if err == nil {
+		err = io.EOF
+	}
+	return err
+}
+
+// ReadJSONLines returns an iterator over the records of the JSON Lines
+// stream r. Malformed records are reported as *DecodeError with their line
+// number; see JSONLinesOptions.SkipInvalid. Empty lines are ignored and
+// records are decoded only as the iteration advances.
+func ReadJSONLines[T any](r io.Reader, opts *JSONLinesOptions) func(yield func(T, error) bool) {
+	return func(yield func(T, error) bool) {
+		readJSONLines(r, "", opts, yield)
+	}
+}
+
+// ReadJSONLinesFile is ReadJSONLines for a file, which may be compressed
+// (see OpenCompressed). The file is closed when the iteration ends.
+func ReadJSONLinesFile[T any](filename string, opts *JSONLinesOptions) func(yield func(T, error) bool) {
+	return func(yield func(T, error) bool) {
+		rc, err := OpenCompressed(filename)
+		if err != nil {
+			var zero T
+			yield(zero, err)
+			return
+		}
+		defer rc.Close()
+		readJSONLines(rc, filename, opts, yield)
+	}
+}
+
+func readJSONLines[T any](r io.Reader, filename string, opts *JSONLinesOptions, yield func(T, error) bool) {
+	if opts == nil {
+		opts = &JSONLinesOptions{}
+	}
+	d := newJSONLinesDecoder(r, opts.Strict, opts.MaxLineSize)
+	for {
+		var record T
+		err := d.next(&record)
+		if err == io.EOF {
+			return
+		}
+
+		de, malformed := err.(*DecodeError)
+		if malformed {
+			de.Filename = filename
+		}
+		if !yield(record, err) {
+			return
+		}
+		if err != nil && (!malformed || !opts.SkipInvalid || errors.Is(err, bufio.ErrTooLong)) {
+			return
+		}
+	}
+}
+
+// JSONLinesWriterOptions configures OpenJSONLinesWriter.
+type JSONLinesWriterOptions struct {
+	// Perm is the mode of a newly created file, 0644 if zero.
+	Perm fs.FileMode
+	// MkdirAll creates missing parent directories.
+	MkdirAll bool
+	// SyncInterval controls fsync. Zero syncs after every Append, a
+	// positive interval syncs in the background at most that often, and a
+	// negative one syncs only on Sync and Close.
+	SyncInterval time.Duration
+}
+
+// JSONLinesWriter appends JSON records to a file, one per line. It is safe
+// for concurrent use; every record is written with a single write call so
+// lines of concurrent writers never interleave.
+type JSONLinesWriter struct {
+	mu     sync.Mutex
+	file   *os.File
+	dirty  bool
+	closed bool
+	sync   time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenJSONLinesWriter opens filename for appending, creating it if needed.
+func OpenJSONLinesWriter(filename string, opts *JSONLinesWriterOptions) (*JSONLinesWriter, error) {
+	if opts == nil {
+		opts = &JSONLinesWriterOptions{}
+	}
+	perm := opts.Perm
+	if perm == 0 {
+		perm = 0644
+	}
+	if opts.MkdirAll {
+		if err := mkdirParent(filename, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &JSONLinesWriter{file: file, sync: opts.SyncInterval}
+	if w.sync > 0 {
+		w.stop = make(chan struct{})
+		w.done = make(chan struct{})
+		go w.syncLoop()
+	}
+	return w, nil
+}
+
+// Append writes v as one line.
+func (w *JSONLinesWriter) Append(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrJSONLinesWriterClosed
+	}
+	if _, err := w.file.Write(data); err != nil {
+		return err
+	}
+	if w.sync == 0 {
+		return w.file.Sync()
+	}
+	w.dirty = true
+	return nil
+}
+
+// Sync flushes appended records to stable storage.
+func (w *JSONLinesWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrJSONLinesWriterClosed
+	}
+	return w.syncLocked()
+}
+
+func (w *JSONLinesWriter) syncLocked() error {
+	if !w.dirty {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.dirty = false
+	return nil
+}
+
+func (w *JSONLinesWriter) syncLoop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.sync)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			// A failed sync is retried on the next tick and by Close.
+			w.syncLocked()
+			w.mu.Unlock()
+		}
+	}
+}
+
+// Close syncs pending records and closes the file.
+func (w *JSONLinesWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrJSONLinesWriterClosed
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+	}
+
+	err := w.syncLocked()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
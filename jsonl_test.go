@@ -0,0 +1,129 @@
+package iutils
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type jsonlTestEvent struct {
+	ID   int    `json:"id"`
+	Kind string `json:"kind"`
+}
+
+func TestReadJSONLines(t *testing.T) {
+	input := "{\"id\":1,\"kind\":\"a\"}\n\n{\"id\":\"bad\"}\n{\"id\":3,\"kind\":\"c\"}\nnot json\n"
+
+	tests := []struct {
+		name      string
+		opts      *JSONLinesOptions
+		wantIDs   []int
+		wantLines []int
+	}{
+		{"fail", nil, []int{1}, []int{3}},
+		{"skip", &JSONLinesOptions{SkipInvalid: true}, []int{1, 3}, []int{3, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids, lines []int
+			ReadJSONLines[jsonlTestEvent](strings.NewReader(input), tt.opts)(func(event jsonlTestEvent, err error) bool {
+				var de *DecodeError
+				if errors.As(err, &de) {
+					lines = append(lines, de.Line)
+				} else if err != nil {
+					t.Fatal(err)
+				} else {
+					ids = append(ids, event.ID)
+				}
+				return true
+			})
+			if !equalInts(ids, tt.wantIDs) || !equalInts(lines, tt.wantLines) {
+				t.Errorf("records %v, errors on lines %v; want %v and %v", ids, lines, tt.wantIDs, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestReadJSONLinesLimits(t *testing.T) {
+	input := "{\"id\":1}\n{\"id\":2,\"kind\":\"" + strings.Repeat("x", 100) + "\"}\n{\"id\":3}\n"
+	var got []int
+	var lastErr error
+	ReadJSONLines[jsonlTestEvent](strings.NewReader(input), &JSONLinesOptions{MaxLineSize: 64, SkipInvalid: true})(func(event jsonlTestEvent, err error) bool {
+		if err != nil {
+			lastErr = err
+		} else {
+			got = append(got, event.ID)
+		}
+		return true
+	})
+	var de *DecodeError
+	if !equalInts(got, []int{1}) || !errors.As(lastErr, &de) || de.Line != 2 {
+		t.Errorf("records %v, error %v; want [1] and an error on line 2", got, lastErr)
+	}
+
+	input = "{\"id\":1,\"extra\":true}\n"
+	ReadJSONLines[jsonlTestEvent](strings.NewReader(input), &JSONLinesOptions{Strict: true})(func(_ jsonlTestEvent, err error) bool {
+		if err == nil || !strings.Contains(err.Error(), "unknown field") {
+			t.Errorf("strict error = %v, want unknown field", err)
+		}
+		return true
+	})
+}
+
+func TestJSONLinesWriterConcurrent(t *testing.T) {
+	for _, interval := range []time.Duration{0, time.Millisecond, -1} {
+		filename := filepath.Join(t.TempDir(), "logs", "events.jsonl")
+		w, err := OpenJSONLinesWriter(filename, &JSONLinesWriterOptions{MkdirAll: true, SyncInterval: interval})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		const writers, perWriter = 8, 50
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < perWriter; j++ {
+					if err := w.Append(jsonlTestEvent{ID: i*perWriter + j, Kind: strings.Repeat("k", j)}); err != nil {
+						t.Error(err)
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if err := w.Append(jsonlTestEvent{}); !errors.Is(err, ErrJSONLinesWriterClosed) {
+			t.Errorf("Append() after Close error = %v, want %v", err, ErrJSONLinesWriterClosed)
+		}
+
+		seen := make(map[int]bool)
+		ReadJSONLinesFile[jsonlTestEvent](filename, nil)(func(event jsonlTestEvent, err error) bool {
+			if err != nil {
+				t.Fatalf("interval %v: %v", interval, err)
+			}
+			seen[event.ID] = true
+			return true
+		})
+		if len(seen) != writers*perWriter {
+			t.Errorf("interval %v: read %d distinct records, want %d", interval, len(seen), writers*perWriter)
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,507 @@
+// Package kvstore implements a small embedded key-value store backed by
+// files.
+//
+// All data is kept in memory. Changes are appended to a log file, one
+// checksummed record per change, and the log is folded into a snapshot
+// once it grows large. The snapshot is replaced atomically, and a record
+// torn by a crash at the end of the log is dropped on the next Open.
+package kvstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MDGSF/iutils"
+)
+
+var (
+	// ErrNotFound is returned by Get for missing keys.
+	ErrNotFound = errors.New("kvstore: key not found")
+	// ErrClosed is returned by operations on a closed Store.
+	ErrClosed = errors.New("kvstore: store closed")
+	// ErrCorrupt is returned by Open when a file is damaged in a way a
+	// crash cannot explain.
+	ErrCorrupt = errors.New("kvstore: corrupt data")
+)
+
+const (
+	snapshotName = "snapshot"
+	logName      = "log"
+	lockName     = "LOCK"
+
+	snapshotMagic = "IKVSNAP1"
+
+	opPut    = 1
+	opDelete = 2
+
+	// A record is crc32c(4) op(1) keyLen(4) valueLen(4) key value; the
+	// checksum covers everything after it.
+	headerSize = 13
+
+	// DefaultCompactThreshold is the log size that triggers compaction.
+	DefaultCompactThreshold = 4 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Options configures Open. A nil *Options syncs every change and compacts
+// at DefaultCompactThreshold.
+type Options struct {
+	// SyncInterval controls fsync of the log. Zero syncs after every
+	// change, a positive interval syncs in the background at most that
+	// often, and a negative one syncs only on Sync and Close.
+	SyncInterval time.Duration
+	// CompactThreshold is the log size in bytes that triggers a
+	// compaction, DefaultCompactThreshold if zero. Negative disables
+	// automatic compaction.
+	CompactThreshold int64
+}
+
+// Store is a key-value store in a directory. It is safe for concurrent use
+// within a process; other processes are kept out by a lock file.
+type Store struct {
+	dir  string
+	opts Options
+	lock *iutils.FileLock
+
+	mu      sync.RWMutex
+	data    map[string][]byte
+	log     *os.File
+	logSize int64
+	dirty   bool
+	closed  bool
+	// compactErr is the error of the last automatic compaction.
+	compactErr error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Open opens the store in dir, creating it if needed. It fails with
+// iutils.ErrLocked if another process has the store open.
+func Open(dir string, opts *Options) (*Store, error) {
+	s := &Store{dir: dir, data: make(map[string][]byte)}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.CompactThreshold == 0 {
+		s.opts.CompactThreshold = DefaultCompactThreshold
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	lock, err := iutils.TryLockFile(filepath.Join(dir, lockName), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.lock = lock
+
+	if err := s.load(); err != nil {
+		if s.log != nil {
+			s.log.Close()
+		}
+		lock.Unlock()
+		return nil, err
+	}
+
+	if s.opts.SyncInterval > 0 {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.syncLoop()
+	}
+	return s, nil
+}
+
+// load reads the snapshot and replays the log.
+func (s *Store) load() error {
+	snapshot, err := os.Open(filepath.Join(s.dir, snapshotName))
+	if err == nil {
+		err = s.readSnapshot(snapshot)
+		snapshot.Close()
+		if err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	s.log, err = os.OpenFile(filepath.Join(s.dir, logName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := s.log.Stat()
+	if err != nil {
+		return err
+	}
+
+	good, err := s.replay(bufio.NewReader(s.log), info.Size())
+	if err != nil {
+		return err
+	}
+	if good < info.Size() {
+		// Drop the torn record so new records follow the last good one.
+		if err := s.log.Truncate(good); err != nil {
+			return err
+		}
+		if err := s.log.Sync(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.log.Seek(good, io.SeekStart); err != nil {
+		return err
+	}
+	s.logSize = good
+	return nil
+}
+
+func (s *Store) readSnapshot(file *os.File) error {
+	r := bufio.NewReader(file)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != snapshotMagic {
+		return fmt.Errorf("%s: %w: bad snapshot header", file.Name(), ErrCorrupt)
+	}
+	for {
+		op, key, value, err := readRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil || op != opPut {
+			return fmt.Errorf("%s: %w", file.Name(), ErrCorrupt)
+		}
+		s.data[key] = value
+	}
+}
+
+// replay applies the log records and returns the offset after the last
+// good one. Only the last record may be damaged.
+func (s *Store) replay(r *bufio.Reader, size int64) (int64, error) {
+	var offset int64
+	for {
+		op, key, value, err := readRecord(r)
+		if err == io.EOF {
+			return offset, nil
+		}
+		end := offset + recordSize(key, value)
+		if err == io.ErrUnexpectedEOF || (err != nil && end >= size) {
+			return offset, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w at offset %d: %v", s.log.Name(), ErrCorrupt, offset, err)
+		}
+
+		switch op {
+		case opPut:
+			s.data[key] = value
+		case opDelete:
+			delete(s.data, key)
+		}
+		offset = end
+	}
+}
+
+func recordSize(key string, value []byte) int64 {
+	return int64(headerSize + len(key) + len(value))
+}
+
+// appendRecord encodes a record.
+func appendRecord(buf []byte, op byte, key string, value []byte) []byte {
+	start := len(buf)
+	buf = append(buf, 0, 0, 0, 0, op)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(key)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(value)))
+	buf = append(buf, key...)
+	buf = append(buf, value...)
+	binary.LittleEndian.PutUint32(buf[start:], crc32.Checksum(buf[start+4:], crcTable))
+	return buf
+}
+
+var errChecksum = errors.New("checksum mismatch")
+
+// readRecord decodes a record. It returns io.EOF at a clean end and
+// io.ErrUnexpectedEOF for a record cut short. On a checksum error the key
+// and value are returned too, so that the caller knows the record size.
+func readRecord(r *bufio.Reader) (op byte, key string, value []byte, err error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, "", nil, err
+	}
+	op = header[4]
+	keyLen := binary.LittleEndian.Uint32(header[5:])
+	valueLen := binary.LittleEndian.Uint32(header[9:])
+
+	// Read in steps, so a garbage length fails at the end of the file
+	// instead of allocating it.
+	body, err := readN(r, int64(keyLen)+int64(valueLen))
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, "", nil, err
+	}
+	h := crc32.New(crcTable)
+	h.Write(header[4:])
+	h.Write(body)
+	key, value = string(body[:keyLen]), body[keyLen:]
+	if h.Sum32() != binary.LittleEndian.Uint32(header[:4]) {
+		return op, key, value, errChecksum
+	}
+	if op != opPut && op != opDelete {
+		return op, key, value, fmt.Errorf("unknown record type %d", op)
+	}
+	return op, key, value, nil
+}
+
+func readN(r io.Reader, n int64) ([]byte, error) {
+	const step = 1 << 20
+	buf := make([]byte, 0, min(n, step))
+	for int64(len(buf)) < n {
+		chunk := min(n-int64(len(buf)), step)
+		start := len(buf)
+		buf = append(buf, make([]byte, chunk)...)
+		if _, err := io.ReadFull(r, buf[start:]); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// Get returns a copy of the value of key.
+func (s *Store) Get(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	value, ok := s.data[key]
+	if !ok {
+		return nil, fmt.Errorf("%q: %w", key, ErrNotFound)
+	}
+	return append([]byte{}, value...), nil
+}
+
+// Has reports whether key is present.
+func (s *Store) Has(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.data[key]
+	return ok && !s.closed
+}
+
+// Len returns the number of keys.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data)
+}
+
+// Put sets the value of key. A failed automatic compaction does not fail
+// Put; it is retried on later writes and reported by Close.
+func (s *Store) Put(key string, value []byte) error {
+	return s.write(opPut, key, value)
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (s *Store) Delete(key string) error {
+	return s.write(opDelete, key, nil)
+}
+
+func (s *Store) write(op byte, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if op == opDelete {
+		if _, ok := s.data[key]; !ok {
+			return nil
+		}
+	}
+
+	record := appendRecord(nil, op, key, value)
+	n, err := s.log.Write(record)
+	if err == nil && s.opts.SyncInterval == 0 {
+		err = s.log.Sync()
+	}
+	if err != nil {
+		// Take the record back, so that a failed change is in neither the
+		// log nor memory.
+		truncErr := s.log.Truncate(s.logSize)
+		if truncErr == nil || n < len(record) {
+			// A torn record is overwritten by the next one.
+			s.log.Seek(s.logSize, io.SeekStart)
+			return err
+		}
+		// The complete record stays in the log. Apply it anyway, so that
+		// memory matches what the next Open loads.
+	}
+	s.logSize += int64(len(record))
+	if s.opts.SyncInterval != 0 || err != nil {
+		s.dirty = true
+	}
+
+	if op == opPut {
+		s.data[key] = append([]byte{}, value...)
+	} else {
+		delete(s.data, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.opts.CompactThreshold > 0 && s.logSize >= s.opts.CompactThreshold {
+		// The change is logged and applied, so a failed compaction does
+		// not fail it. The log stays over the threshold and the next
+		// write tries again; Close reports the error if none succeeds.
+		s.compactErr = s.compactLocked()
+	}
+	return nil
+}
+
+// Scan returns the keys starting with prefix and their values, in key
+// order. The keys are collected when the iteration starts, so the store
+// may be modified during it; values are read as the iteration reaches
+// them and keys deleted in the meantime are skipped.
+func (s *Store) Scan(prefix string) func(yield func(key string, value []byte) bool) {
+	return func(yield func(string, []byte) bool) {
+		s.mu.RLock()
+		var keys []string
+		for key := range s.data {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		s.mu.RUnlock()
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s.mu.RLock()
+			value, ok := s.data[key]
+			if ok {
+				value = append([]byte{}, value...)
+			}
+			s.mu.RUnlock()
+			if ok && !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// Compact writes all data to a new snapshot and empties the log.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	s.compactErr = s.compactLocked()
+	return s.compactErr
+}
+
+func (s *Store) compactLocked() error {
+	keys := make([]string, 0, len(s.data))
+	size := len(snapshotMagic)
+	for key, value := range s.data {
+		keys = append(keys, key)
+		size += int(recordSize(key, value))
+	}
+	sort.Strings(keys)
+	buf := make([]byte, 0, size)
+	buf = append(buf, snapshotMagic...)
+	for _, key := range keys {
+		buf = appendRecord(buf, opPut, key, s.data[key])
+	}
+
+	if err := iutils.WriteFile3(filepath.Join(s.dir, snapshotName), buf); err != nil {
+		return err
+	}
+	// A crash before the truncation replays the log over the new
+	// snapshot, which yields the same data.
+	if err := s.log.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.logSize, s.dirty = 0, false
+	return s.log.Sync()
+}
+
+// Sync flushes the log to stable storage.
+func (s *Store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return s.syncLocked()
+}
+
+func (s *Store) syncLocked() error {
+	if !s.dirty {
+		return nil
+	}
+	if err := s.log.Sync(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+func (s *Store) syncLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			// A failed sync is retried on the next tick and by Close.
+			s.syncLocked()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Close syncs the log and releases the store. It also returns the error of
+// the last automatic compaction if that failed.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+
+	err := s.syncLocked()
+	if err == nil {
+		err = s.compactErr
+	}
+	if closeErr := s.log.Close(); err == nil {
+		err = closeErr
+	}
+	if unlockErr := s.lock.Unlock(); err == nil {
+		err = unlockErr
+	}
+	return err
+}
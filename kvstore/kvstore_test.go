@@ -0,0 +1,281 @@
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MDGSF/iutils"
+)
+
+func TestStoreOperations(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(dir, nil); !errors.Is(err, iutils.ErrLocked) {
+		t.Errorf("second Open() error = %v, want %v", err, iutils.ErrLocked)
+	}
+
+	for key, value := range map[string]string{"user/1": "ann", "user/2": "bob", "user/10": "cy", "group/1": "admins"} {
+		if err := s.Put(key, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put("user/2", []byte("ben")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("group/1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("missing"); err != nil {
+		t.Errorf("Delete() of missing key error = %v", err)
+	}
+
+	if value, err := s.Get("user/2"); err != nil || string(value) != "ben" {
+		t.Errorf("Get() = %q, %v", value, err)
+	}
+	if _, err := s.Get("group/1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of deleted key error = %v, want %v", err, ErrNotFound)
+	}
+
+	got := iterate(s.Scan("user/"))
+	want := map[string]string{"user/1": "ann", "user/10": "cy", "user/2": "ben"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Scan() = %v, want %v", got, want)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("k", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Put() after Close error = %v, want %v", err, ErrClosed)
+	}
+
+	// Reopening replays the log.
+	s, err = Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Len() != 3 || s.Has("group/1") {
+		t.Errorf("reopened store has %d keys", s.Len())
+	}
+	if value, _ := s.Get("user/2"); string(value) != "ben" {
+		t.Errorf("Get() after reopen = %q", value)
+	}
+}
+
+// iterate collects the pairs of a Scan.
+func iterate(seq func(func(string, []byte) bool)) map[string]string {
+	m := make(map[string]string)
+	seq(func(key string, value []byte) bool {
+		m[key] = string(value)
+		return true
+	})
+	return m
+}
+
+func TestStoreScanOrderAndEarlyStop(t *testing.T) {
+	s, err := Open(t.TempDir(), &Options{SyncInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, key := range []string{"c", "a", "b", "d"} {
+		s.Put(key, []byte(key))
+	}
+
+	var keys []string
+	s.Scan("")(func(key string, value []byte) bool {
+		keys = append(keys, key)
+		// Modifying the store during a scan does not deadlock.
+		s.Delete("c")
+		return key != "b"
+	})
+	if fmt.Sprint(keys) != "[a b]" {
+		t.Errorf("Scan() visited %v, want [a b]", keys)
+	}
+}
+
+func TestStoreCompaction(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, &Options{CompactThreshold: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := s.Put(fmt.Sprintf("key%d", i%10), []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dir, snapshotName)); err != nil || info.Size() == 0 {
+		t.Fatalf("no snapshot after exceeding the threshold: %v", err)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, logName)); info.Size() >= 1024 {
+		t.Errorf("log size = %d after compaction", info.Size())
+	}
+	s.Delete("key0")
+	s.Close()
+
+	s, err = Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Len() != 9 || s.Has("key0") {
+		t.Errorf("reopened store has %d keys", s.Len())
+	}
+	if value, _ := s.Get("key9"); string(value) != "99" {
+		t.Errorf("Get() after compaction = %q, want %q", value, "99")
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, logName)); info.Size() != 0 {
+		t.Errorf("log size = %d after Compact", info.Size())
+	}
+}
+
+func TestStoreCompactionFailure(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, &Options{CompactThreshold: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A non-empty directory in place of the snapshot cannot be replaced.
+	obstacle := filepath.Join(dir, snapshotName, "x")
+	if err := os.MkdirAll(obstacle, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := s.Put(fmt.Sprintf("key%d", i), []byte("value")); err != nil {
+			t.Fatalf("Put() with failing compaction error = %v", err)
+		}
+	}
+	if s.Len() != 20 {
+		t.Errorf("Len() = %d, want 20", s.Len())
+	}
+	if err := s.Compact(); err == nil {
+		t.Errorf("Compact() succeeded with the snapshot blocked")
+	}
+
+	// The next write retries the compaction.
+	if err := os.RemoveAll(filepath.Join(dir, snapshotName)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("last", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, logName)); info.Size() != 0 {
+		t.Errorf("log size = %d after the retried compaction", info.Size())
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() after a successful retry error = %v", err)
+	}
+
+	s, err = Open(dir, &Options{CompactThreshold: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 21 {
+		t.Errorf("reopened store has %d keys, want 21", s.Len())
+	}
+	os.Remove(filepath.Join(dir, snapshotName))
+	os.MkdirAll(obstacle, 0755)
+	for i := 0; i < 20; i++ {
+		s.Put(fmt.Sprintf("key%d", i), []byte("other"))
+	}
+	if err := s.Close(); err == nil {
+		t.Errorf("Close() did not report the failed compaction")
+	}
+}
+
+func TestStoreRecovery(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("a", []byte("1"))
+	s.Put("b", []byte("2"))
+	s.Close()
+	logPath := filepath.Join(dir, logName)
+	full, _ := os.ReadFile(logPath)
+	last := int(recordSize("b", []byte("2")))
+
+	tests := []struct {
+		name    string
+		log     []byte
+		want    int
+		wantErr bool
+	}{
+		{"torn header", full[:len(full)-last+3], 1, false},
+		{"torn body", full[:len(full)-1], 1, false},
+		{"bad checksum at end", append(append([]byte{}, full[:len(full)-1]...), 'x'), 1, false},
+		{"bad checksum in the middle", append([]byte{full[0] ^ 1}, full[1:]...), 0, true},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(logPath, tt.log, 0644); err != nil {
+			t.Fatal(err)
+		}
+		s, err := Open(dir, nil)
+		if tt.wantErr {
+			if !errors.Is(err, ErrCorrupt) {
+				t.Errorf("%s: Open() error = %v, want %v", tt.name, err, ErrCorrupt)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if s.Len() != tt.want {
+			t.Errorf("%s: %d keys, want %d", tt.name, s.Len(), tt.want)
+		}
+		// New records follow the last good one.
+		s.Put("c", []byte("3"))
+		s.Close()
+		s, err = Open(dir, nil)
+		if err != nil || !s.Has("c") || !s.Has("a") {
+			t.Errorf("%s: reopen after recovery = %v", tt.name, err)
+		}
+		s.Close()
+	}
+}
+
+func TestStoreConcurrent(t *testing.T) {
+	s, err := Open(t.TempDir(), &Options{SyncInterval: 10 * time.Millisecond, CompactThreshold: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("g%d/%d", g, i%20)
+				if err := s.Put(key, []byte(key)); err != nil {
+					t.Error(err)
+					return
+				}
+				if value, err := s.Get(key); err != nil || string(value) != key {
+					t.Errorf("Get(%q) = %q, %v", key, value, err)
+				}
+				iterate(s.Scan(fmt.Sprintf("g%d/", g)))
+			}
+		}(g)
+	}
+	wg.Wait()
+	if s.Len() != 80 {
+		t.Errorf("Len() = %d, want 80", s.Len())
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
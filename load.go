@@ -0,0 +1,632 @@
+package iutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// FileFormat is a structured file format understood by Load and Save.
+type FileFormat int
+
+const (
+	// FormatAuto detects the format from the file extension.
+	FormatAuto FileFormat = iota
+	FormatJSON
+	FormatJSONLines
+	FormatYAML
+	FormatTOML
+)
+
+func (f FileFormat) String() string {
+	switch f {
+	case FormatAuto:
+		return "auto"
+	case FormatJSON:
+		return "json"
+	case FormatJSONLines:
+		return "jsonl"
+	case FormatYAML:
+		return "yaml"
+	case FormatTOML:
+		return "toml"
+	}
+	return fmt.Sprintf("FileFormat(%d)", int(f))
+}
+
+// DetectFileFormat returns the format matching the extension of filename.
+// A compression extension such as ".gz" is skipped, so "data.json.gz" is
+// JSON.
+func DetectFileFormat(filename string) (FileFormat, error) {
+	if compressionForExt(filename) != nil {
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".jsonl", ".ndjson":
+		return FormatJSONLines, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	}
+	return FormatAuto, fmt.Errorf("cannot detect file format of %s", filename)
+}
+
+// LoadOptions configures Load.
+type LoadOptions struct {
+	// Format overrides the format detected from the file extension.
+	Format FileFormat
+	// Strict rejects fields that do not exist in the target type.
+	Strict bool
+}
+
+// SaveOptions configures Save.
+type SaveOptions struct {
+	// Format overrides the format detected from the file extension.
+	Format FileFormat
+}
+
+// DecodeError reports where decoding a file failed. Line and Column are
+// 1-based and zero when the position is unknown.
+type DecodeError struct {
+	Filename string
+	Line     int
+	Column   int
+	Err      error
+}
+
+func (e *DecodeError) Error() string {
+	switch {
+	case e.Filename != "" && e.Line > 0:
+		return fmt.Sprintf("%s:%d:%d: %v", e.Filename, e.Line, e.Column, e.Err)
+	case e.Filename != "":
+		return fmt.Sprintf("%s: %v", e.Filename, e.Err)
+	case e.Line > 0:
+		return fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
+	}
+	return e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ReadJson is the read side of WriteJson: it decodes the JSON file
+// filename into a new T.
+func ReadJson[T any](filename string) (T, error) {
+	return Load[T](filename, &LoadOptions{Format: FormatJSON})
+}
+
+// Load decodes filename into a new T. The file may be compressed (see
+// ReadCompressedFile). For FormatJSONLines T must be a slice type and
+// every line becomes one element.
+//
+// YAML and TOML support the subsets used by typical configuration files:
+// YAML block and flow collections, scalars and block strings but no
+// anchors, tags or multiple documents; TOML tables, arrays of tables,
+// inline tables, arrays, strings, numbers and booleans, with dates kept as
+// strings. Integers keep all their digits, and numbers decoded into
+// interface{} values are json.Number for YAML and TOML, but float64 for
+// JSON and JSON Lines, as with encoding/json.
+func Load[T any](filename string, opts *LoadOptions) (T, error) {
+	var out T
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+
+	format := opts.Format
+	if format == FormatAuto {
+		var err error
+		if format, err = DetectFileFormat(filename); err != nil {
+			return out, err
+		}
+	}
+
+	data, err := ReadCompressedFile(filename)
+	if err != nil {
+		return out, err
+	}
+
+	switch format {
+	case FormatJSON:
+		err = decodeJSON(data, &out, opts.Strict, false)
+	case FormatJSONLines:
+		err = decodeJSONLines(data, &out, opts.Strict)
+	case FormatYAML, FormatTOML:
+		var generic interface{}
+		if format == FormatYAML {
+			generic, err = parseYAML(data)
+		} else {
+			generic, err = parseTOML(data)
+		}
+		if err == nil {
+			err = decodeGeneric(generic, &out, opts.Strict)
+		}
+	default:
+		err = fmt.Errorf("unsupported file format %v", format)
+	}
+
+	if de, ok := err.(*DecodeError); ok {
+		de.Filename = filename
+	} else if err != nil {
+		err = &DecodeError{Filename: filename, Err: err}
+	}
+	return out, err
+}
+
+// Save encodes v in the format of filename and writes it atomically, see
+// WriteFile3. Compression extensions are honoured as in
+// WriteCompressedFile.
+func Save[T any](filename string, v T, opts *SaveOptions) error {
+	format := FormatAuto
+	if opts != nil {
+		format = opts.Format
+	}
+	if format == FormatAuto {
+		var err error
+		if format, err = DetectFileFormat(filename); err != nil {
+			return err
+		}
+	}
+
+	data, err := encodeFileFormat(v, format)
+	if err != nil {
+		return err
+	}
+	if compressionForExt(filename) != nil {
+		return WriteCompressedFile(filename, data)
+	}
+	return WriteFile3(filename, data)
+}
+
+func encodeFileFormat(v interface{}, format FileFormat) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case FormatJSONLines:
+		return encodeJSONLines(v)
+	case FormatYAML, FormatTOML:
+		generic, err := toOrderedGeneric(v)
+		if err != nil {
+			return nil, err
+		}
+		if format == FormatYAML {
+			return emitYAML(generic), nil
+		}
+		return emitTOML(generic)
+	}
+	return nil, fmt.Errorf("unsupported file format %v", format)
+}
+
+func decodeJSON(data []byte, v interface{}, strict, useNumber bool) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if useNumber {
+		dec.UseNumber()
+	}
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+
+	err := dec.Decode(v)
+	if err == nil {
+		// Only whitespace may follow the value.
+		if _, tokErr := dec.Token(); tokErr != io.EOF {
+			err = errors.New("invalid data after top-level value")
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	offset := dec.InputOffset()
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) {
+		// The offset is just past the offending byte.
+		offset = syntaxErr.Offset - 1
+	} else if errors.As(err, &typeErr) {
+		offset = typeErr.Offset
+	}
+	line, col := lineColumn(data, offset)
+	return &DecodeError{Line: line, Column: col, Err: err}
+}
+
+// exactInteger converts an integer literal to a json.Number in decimal.
+// Unlike strconv.ParseInt it has no size limit, so that values beyond
+// int64, such as a large uint64, are not rounded through float64.
+func exactInteger(s string, base int) (json.Number, bool) {
+	n, ok := new(big.Int).SetString(s, base)
+	if !ok {
+		return "", false
+	}
+	return json.Number(n.String()), true
+}
+
+// decodeGeneric decodes a parsed YAML or TOML document into v through
+// JSON. Type errors and unknown fields are reported with the path and the
+// source position of the key that holds the offending value.
+func decodeGeneric(generic interface{}, v interface{}, strict bool) error {
+	data, spans, err := encodeGeneric(generic)
+	if err != nil {
+		return err
+	}
+	// Numbers stay exact on their way through the intermediate JSON, also
+	// into interface{} values.
+	err = decodeJSON(data, v, strict, true)
+	de, ok := err.(*DecodeError)
+	if !ok {
+		return err
+	}
+	// Positions in the intermediate JSON mean nothing to the reader of the
+	// original file.
+	de.Line, de.Column = 0, 0
+
+	var path string
+	var pos srcPos
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(de.Err, &typeErr) {
+		// The offset is inside or just past the offending value.
+		best := -1
+		for i, span := range spans {
+			if span.start < typeErr.Offset && typeErr.Offset <= span.end &&
+				(best < 0 || span.end-span.start < spans[best].end-spans[best].start) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			path, pos = spans[best].path, spans[best].pos
+		}
+	} else if strings.HasPrefix(de.Err.Error(), "json: unknown field ") {
+		if m, key, keyPath := findUnknownField(generic, reflect.TypeOf(v).Elem(), ""); m != nil {
+			path, pos = keyPath, m.pos[key]
+		}
+	}
+	if path != "" {
+		de.Line, de.Column = pos.line, pos.col
+		de.Err = fmt.Errorf("%s: %w", path, de.Err)
+	}
+	return de
+}
+
+// jsonSpan locates the value of a map entry in the intermediate JSON of a
+// YAML or TOML document.
+type jsonSpan struct {
+	start, end int64
+	path       string
+	pos        srcPos // of the key in the source
+}
+
+// encodeGeneric encodes a parsed YAML or TOML document as JSON and returns
+// the spans of all map values.
+func encodeGeneric(v interface{}) ([]byte, []jsonSpan, error) {
+	var buf bytes.Buffer
+	var spans []jsonSpan
+	var encode func(v interface{}, path string) error
+	encode = func(v interface{}, path string) error {
+		switch v := v.(type) {
+		case *orderedMap:
+			buf.WriteByte('{')
+			for i, key := range v.keys {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				k, err := json.Marshal(key)
+				if err != nil {
+					return err
+				}
+				buf.Write(k)
+				buf.WriteByte(':')
+				sub := key
+				if path != "" {
+					sub = path + "." + key
+				}
+				start := int64(buf.Len())
+				if err := encode(v.values[key], sub); err != nil {
+					return err
+				}
+				spans = append(spans, jsonSpan{start: start, end: int64(buf.Len()), path: sub, pos: v.pos[key]})
+			}
+			buf.WriteByte('}')
+		case []interface{}:
+			buf.WriteByte('[')
+			for i, item := range v {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				if err := encode(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
+		default:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			buf.Write(data)
+		}
+		return nil
+	}
+	if err := encode(v, ""); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), spans, nil
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// findUnknownField returns the first key of v, in document order, that
+// has no field in the type t, following the field matching of
+// encoding/json.
+func findUnknownField(v interface{}, t reflect.Type, path string) (*orderedMap, string, string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Implements(jsonUnmarshalerType) || reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		return nil, "", ""
+	}
+
+	switch v := v.(type) {
+	case *orderedMap:
+		if t.Kind() != reflect.Map && t.Kind() != reflect.Struct {
+			return nil, "", ""
+		}
+		var fields map[string]reflect.Type
+		if t.Kind() == reflect.Struct {
+			fields = make(map[string]reflect.Type)
+			collectJSONFields(t, fields)
+		}
+		for _, key := range v.keys {
+			sub := key
+			if path != "" {
+				sub = path + "." + key
+			}
+			elem := t
+			if t.Kind() == reflect.Map {
+				elem = t.Elem()
+			} else if elem = fields[key]; elem == nil {
+				for name, ft := range fields {
+					if strings.EqualFold(name, key) {
+						elem = ft
+						break
+					}
+				}
+				if elem == nil {
+					return v, key, sub
+				}
+			}
+			if m, k, p := findUnknownField(v.values[key], elem, sub); m != nil {
+				return m, k, p
+			}
+		}
+	case []interface{}:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return nil, "", ""
+		}
+		for i, item := range v {
+			if m, k, p := findUnknownField(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); m != nil {
+				return m, k, p
+			}
+		}
+	}
+	return nil, "", ""
+}
+
+// collectJSONFields adds the JSON names of the fields of the struct type t
+// to fields, including those promoted from embedded structs.
+func collectJSONFields(t reflect.Type, fields map[string]reflect.Type) {
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	// Fields of the outer struct take precedence.
+	for _, ft := range embedded {
+		inner := make(map[string]reflect.Type)
+		collectJSONFields(ft, inner)
+		for name, ftype := range inner {
+			if _, ok := fields[name]; !ok {
+				fields[name] = ftype
+			}
+		}
+	}
+}
+
+// lineColumn converts a byte offset into a 1-based line and column.
+func lineColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte{'\n'}) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+func decodeJSONLines(data []byte, v interface{}, strict bool) error {
+	slice := reflect.ValueOf(v).Elem()
+	if slice.Kind() != reflect.Slice {
+		return fmt.Errorf("JSON Lines needs a slice type, got %v", slice.Type())
+	}
+
+	d := newJSONLinesDecoder(bytes.NewReader(data), strict, len(data)+1)
+	for {
+		elem := reflect.New(slice.Type().Elem())
+		err := d.next(elem.Interface())
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+}
+
+func encodeJSONLines(v interface{}) ([]byte, error) {
+	slice := reflect.ValueOf(v)
+	if slice.Kind() != reflect.Slice && slice.Kind() != reflect.Array {
+		return nil, fmt.Errorf("JSON Lines needs a slice, got %T", v)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := 0; i < slice.Len(); i++ {
+		if err := enc.Encode(slice.Index(i).Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// orderedMap is a JSON object that remembers the order of its keys, so
+// YAML and TOML output follows the field order of the Go struct. Maps
+// parsed from YAML and TOML also remember where their keys are.
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+	pos    map[string]srcPos
+}
+
+// srcPos is a 1-based line and column in a source file.
+type srcPos struct {
+	line, col int
+}
+
+func newOrderedMap() *orderedMap {
+	return &orderedMap{values: make(map[string]interface{})}
+}
+
+func (m *orderedMap) set(key string, value interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// setPos records where key is first mentioned in the source.
+func (m *orderedMap) setPos(key string, line, col int) {
+	if m.pos == nil {
+		m.pos = make(map[string]srcPos)
+	}
+	if _, ok := m.pos[key]; !ok {
+		m.pos[key] = srcPos{line: line, col: col}
+	}
+}
+
+func (m *orderedMap) get(key string) (interface{}, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// toOrderedGeneric converts v to nil, bool, json.Number, string,
+// []interface{} and *orderedMap values through its JSON encoding.
+func toOrderedGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return decodeOrdered(dec)
+}
+
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		m := newOrderedMap()
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			m.set(keyTok.(string), value)
+		}
+		_, err = dec.Token()
+		return m, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err = dec.Token()
+		return list, err
+	}
+	return tok, nil
+}
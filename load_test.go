@@ -0,0 +1,226 @@
+package iutils
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type loadTestConfig struct {
+	Name    string            `json:"name"`
+	Port    int               `json:"port"`
+	Ratio   float64           `json:"ratio"`
+	Debug   bool              `json:"debug"`
+	Tags    []string          `json:"tags"`
+	Labels  map[string]string `json:"labels"`
+	Started time.Time         `json:"started"`
+	Servers []loadTestServer  `json:"servers"`
+	Note    string            `json:"note"`
+}
+
+type loadTestServer struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	want := loadTestConfig{
+		Name:    "demo: \"quoted\" # not a comment",
+		Port:    8080,
+		Ratio:   0.25,
+		Debug:   true,
+		Tags:    []string{"a", "b c", "true", "1"},
+		Labels:  map[string]string{"env": "prod", "team.name": "core"},
+		Started: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Servers: []loadTestServer{{Host: "a.example", Port: 1}, {Host: "b.example", Port: 2}},
+		Note:    "line one\nline two\n",
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"c.json", "c.yaml", "c.yml", "c.toml", "c.json.gz"} {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(dir, name)
+			if err := Save(filename, want, nil); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			got, err := Load[loadTestConfig](filename, &LoadOptions{Strict: true})
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Load() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestReadJson(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "v.json")
+	want := map[string][]int{"a": {1, 2}}
+	if err := WriteJson(filename, want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadJson[map[string][]int](filename)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadJson() = %v, %v; want %v", got, err, want)
+	}
+}
+
+func TestReadJsonGeneric(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "v.json")
+	if err := WriteJson(filename, map[string]any{"n": 1.5, "list": []any{2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Numbers decode into interface{} as float64, as with encoding/json.
+	got, err := ReadJson[map[string]any](filename)
+	want := map[string]any{"n": 1.5, "list": []any{2.0}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadJson() = %#v, %v; want %#v", got, err, want)
+	}
+}
+
+func TestLoadGenericNumbers(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]any
+	}{
+		{"v.json", `{"n": 2, "f": 1.5}`, map[string]any{"n": 2.0, "f": 1.5}},
+		{"v.yaml", "n: 2\nf: 1.5\n", map[string]any{"n": json.Number("2"), "f": json.Number("1.5")}},
+		{"v.toml", "n = 2\nf = 1.5\n", map[string]any{"n": json.Number("2"), "f": json.Number("1.5")}},
+		{"big.yaml", "n: 18446744073709551615\nf: 0x20000000000001\n", map[string]any{"n": json.Number("18446744073709551615"), "f": json.Number("9007199254740993")}},
+	}
+	for _, tt := range tests {
+		filename := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Load[map[string]any](filename, nil)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Load(%s) = %#v, %v; want %#v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestSaveLoadBigIntegers(t *testing.T) {
+	type numbers struct {
+		Max   uint64 `json:"max"`
+		Above int64  `json:"above"`
+		Min   int64  `json:"min"`
+	}
+	want := numbers{Max: math.MaxUint64, Above: 1<<53 + 1, Min: math.MinInt64}
+
+	dir := t.TempDir()
+	for _, name := range []string{"n.json", "n.yaml", "n.toml"} {
+		filename := filepath.Join(dir, name)
+		if err := Save(filename, want, nil); err != nil {
+			t.Fatalf("Save(%s) error = %v", name, err)
+		}
+		got, err := Load[numbers](filename, nil)
+		if err != nil || got != want {
+			t.Errorf("Load(%s) = %+v, %v; want %+v", name, got, err, want)
+		}
+	}
+}
+
+func TestLoadJSONLines(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "events.jsonl")
+	want := []loadTestServer{{"a", 1}, {"b", 2}}
+	if err := Save(filename, want, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filename)
+	if string(data) != "{\"host\":\"a\",\"port\":1}\n{\"host\":\"b\",\"port\":2}\n" {
+		t.Errorf("saved JSON Lines = %q", data)
+	}
+
+	got, err := Load[[]loadTestServer](filename, nil)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %v, %v; want %v", got, err, want)
+	}
+
+	WriteFile3(filename, []byte("{\"host\":\"a\"}\n\n{\"host\": 1}\n"))
+	_, err = Load[[]loadTestServer](filename, nil)
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Line != 3 {
+		t.Errorf("Load() error = %v, want a DecodeError on line 3", err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		strict   bool
+		wantLine int
+		wantCol  int
+		wantText string
+	}{
+		{"bad.json", "{\n  \"name\": \"x\",\n  \"port\": ,\n}", false, 3, 11, "invalid character"},
+		{"type.json", "{\n  \"port\": \"x\"\n}", false, 2, 0, "cannot unmarshal"},
+		{"unknown.json", "{\"name\": \"x\", \"bogus\": 1}", true, 1, 0, "unknown field"},
+		{"unknown.yaml", "name: x\nbogus: 1\n", true, 2, 1, "bogus: json: unknown field"},
+		{"type.yaml", "name: x\nservers:\n  - host: a\n  - host: b\n    port: x\n", false, 5, 5, "servers[1].port: "},
+		{"unknown-nested.yaml", "servers:\n  - {host: a, bogus: 1}\n", true, 2, 15, "servers[0].bogus: "},
+		{"type.toml", "name = \"x\"\n[labels]\nenv = 1\n", false, 3, 1, "labels.env: "},
+		{"unknown.toml", "[[servers]]\nhost = \"a\"\n\n[[servers]]\n  hots = \"b\"\n", true, 5, 3, "servers[1].hots: "},
+		{"dotted.toml", "servers = 1\n", false, 1, 1, "servers: "},
+		{"indent.yaml", "name: x\n  port: 1\n", false, 2, 3, "unexpected indentation"},
+		{"flow.yaml", "tags: [a, b\n", false, 1, 12, "unterminated flow collection"},
+		{"dup.yaml", "name: x\nname: y\n", false, 2, 1, "duplicate key"},
+		{"bad.toml", "name = \"x\"\nport = 80 80\n", false, 2, 11, "expected end of line"},
+		{"dup.toml", "[servers]\n[servers]\n", false, 2, 10, "already defined"},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(dir, tt.name)
+			if err := WriteFile3(filename, []byte(tt.content)); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load[loadTestConfig](filename, &LoadOptions{Strict: tt.strict})
+
+			var de *DecodeError
+			if !errors.As(err, &de) {
+				t.Fatalf("Load() error = %v, want a DecodeError", err)
+			}
+			if de.Filename != filename || de.Line != tt.wantLine || (tt.wantCol > 0 && de.Column != tt.wantCol) {
+				t.Errorf("Load() error at %s:%d:%d, want %s:%d:%d", de.Filename, de.Line, de.Column, filename, tt.wantLine, tt.wantCol)
+			}
+			if !strings.Contains(err.Error(), tt.wantText) {
+				t.Errorf("Load() error = %q, want it to contain %q", err, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestDetectFileFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    FileFormat
+		wantErr bool
+	}{
+		{"a.json", FormatJSON, false},
+		{"a.JSON", FormatJSON, false},
+		{"a.ndjson", FormatJSONLines, false},
+		{"a.yml", FormatYAML, false},
+		{"a.toml.gz", FormatTOML, false},
+		{"a.txt", FormatAuto, true},
+	}
+	for _, tt := range tests {
+		got, err := DetectFileFormat(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("DetectFileFormat(%q) = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
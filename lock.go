@@ -0,0 +1,306 @@
+package iutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrLocked is returned by TryLockFile when another holder has the lock.
+var ErrLocked = errors.New("iutils: file is locked")
+
+// LockOptions configures LockFile and TryLockFile. A nil *LockOptions takes
+// an exclusive flock and waits until the context is done.
+type LockOptions struct {
+	// Shared takes a shared (read) lock instead of an exclusive one.
+	Shared bool
+	// Timeout bounds the wait of LockFile in addition to its context.
+	Timeout time.Duration
+	// PollInterval is how often LockFile retries a busy lock, 50ms if
+	// zero.
+	PollInterval time.Duration
+
+	// Lockfile uses a lock file created with O_EXCL instead of flock. The
+	// file records the PID and hostname of its owner, so a lock left
+	// behind by a crashed process can be detected and broken. Only
+	// exclusive locks are available in this mode.
+	Lockfile bool
+	// StaleAfter breaks lock files older than this even when their owner
+	// cannot be checked, for example because it runs on another host. Zero
+	// only breaks lock files of dead processes on this host.
+	StaleAfter time.Duration
+}
+
+// LockOwner is the content of a lock file.
+type LockOwner struct {
+	PID      int       `json:"pid"`
+	Hostname string    `json:"hostname"`
+	Created  time.Time `json:"created"`
+}
+
+// FileLock is an advisory lock held on a file. Locks coordinate processes
+// as well as goroutines of one process.
+type FileLock struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File // flock mode
+	content  []byte   // lock file mode
+	released bool
+}
+
+// LockPath returns the lock file used by WithLock for path. Locks live next
+// to the file they protect because atomic writes replace the file itself.
+func LockPath(path string) string {
+	return path + ".lock"
+}
+
+// LockFile takes a lock on path, creating the file if needed, and waits
+// while it is held elsewhere. It fails with the context error when ctx is
+// done or opts.Timeout expires first.
+func LockFile(ctx context.Context, path string, opts *LockOptions) (*FileLock, error) {
+	if opts == nil {
+		opts = &LockOptions{}
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = 50 * time.Millisecond
+	}
+
+	// flock cannot be interrupted by a context, so busy locks are polled.
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("lock %s: %w", path, ctx.Err())
+		case <-timer.C:
+		}
+
+		l, err := TryLockFile(path, opts)
+		if !errors.Is(err, ErrLocked) {
+			return l, err
+		}
+		timer.Reset(interval)
+	}
+}
+
+// TryLockFile takes a lock on path without waiting. It returns ErrLocked
+// if the lock is held elsewhere.
+func TryLockFile(path string, opts *LockOptions) (*FileLock, error) {
+	if opts == nil {
+		opts = &LockOptions{}
+	}
+	if err := mkdirParent(path, 0755); err != nil {
+		return nil, err
+	}
+
+	if opts.Lockfile {
+		if opts.Shared {
+			return nil, fmt.Errorf("lock %s: shared locks need flock", path)
+		}
+		return tryLockfile(path, opts.StaleAfter)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := flockFile(file, opts.Shared); err != nil {
+		file.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, err
+		}
+		return nil, &fs.PathError{Op: "lock", Path: path, Err: err}
+	}
+	return &FileLock{path: path, file: file}, nil
+}
+
+// Path returns the locked file.
+func (l *FileLock) Path() string {
+	return l.path
+}
+
+// Unlock releases the lock. A lock file is removed, a flock file is kept
+// so that waiting processes keep locking the same inode.
+func (l *FileLock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released {
+		return &fs.PathError{Op: "unlock", Path: l.path, Err: fs.ErrClosed}
+	}
+	l.released = true
+
+	if l.file != nil {
+		err := funlockFile(l.file)
+		if closeErr := l.file.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+
+	// Only remove the lock file if it is still ours; it may have been
+	// broken as stale and taken over.
+	content, err := os.ReadFile(l.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(content, l.content) {
+		return nil
+	}
+	return os.Remove(l.path)
+}
+
+func tryLockfile(path string, staleAfter time.Duration) (*FileLock, error) {
+	hostname, _ := os.Hostname()
+
+	// A broken stale lock is retried once; losing that race means someone
+	// else holds the lock now.
+	for attempt := 0; attempt < 2; attempt++ {
+		content, err := json.Marshal(LockOwner{PID: os.Getpid(), Hostname: hostname, Created: time.Now()})
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, '\n')
+
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = file.Write(content)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return &FileLock{path: path, content: content}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+
+		existing, stale, err := checkLockfile(path, hostname, staleAfter)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !stale {
+			return nil, ErrLocked
+		}
+		if err := breakLockfile(path, existing); err != nil {
+			return nil, err
+		}
+	}
+	return nil, ErrLocked
+}
+
+// checkLockfile reads a lock file and reports whether it is stale.
+func checkLockfile(path, hostname string, staleAfter time.Duration) ([]byte, bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if staleAfter > 0 && time.Since(info.ModTime()) > staleAfter {
+		return content, true, nil
+	}
+	// A lock file that cannot be parsed may still be being written.
+	var owner LockOwner
+	if json.Unmarshal(content, &owner) != nil || owner.PID <= 0 {
+		return content, false, nil
+	}
+	return content, owner.Hostname == hostname && !processAlive(owner.PID), nil
+}
+
+// breakLockfile removes a stale lock file if its content is still
+// content. Renaming it first makes sure a lock file that was replaced in
+// the meantime is not removed.
+func breakLockfile(path string, content []byte) error {
+	tmp := path + ".stale-" + GenerateRandomString(8)
+	if err := os.Rename(path, tmp); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer os.Remove(tmp)
+
+	got, err := os.ReadFile(tmp)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, content) {
+		// A fresh lock was moved aside; put it back unless the path has
+		// been taken again.
+		os.Link(tmp, path)
+	}
+	return nil
+}
+
+// ReadLockOwner returns the owner recorded in a lock file taken with
+// LockOptions.Lockfile.
+func ReadLockOwner(path string) (LockOwner, error) {
+	var owner LockOwner
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return owner, err
+	}
+	if err := json.Unmarshal(content, &owner); err != nil {
+		return owner, fmt.Errorf("%s: %w", path, err)
+	}
+	return owner, nil
+}
+
+// WithLock runs fn while holding an exclusive lock on LockPath(path).
+func WithLock(path string, fn func() error) error {
+	return WithLockContext(context.Background(), path, nil, fn)
+}
+
+// WithLockContext runs fn while holding a lock on LockPath(path), taken
+// with LockFile.
+func WithLockContext(ctx context.Context, path string, opts *LockOptions, fn func() error) error {
+	l, err := LockFile(ctx, LockPath(path), opts)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	if unlockErr := l.Unlock(); err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+// WriteFile2Locked is WriteFile2 under WithLock, so cooperating processes
+// never write filename at the same time.
+func WriteFile2Locked(filename string, data []byte) error {
+	return WithLock(filename, func() error {
+		return WriteFile2(filename, data)
+	})
+}
+
+// WriteFilePartsLocked is WriteFileParts under WithLock.
+func WriteFilePartsLocked(filename string, fileoffset int64, data []byte) error {
+	return WithLock(filename, func() error {
+		return WriteFileParts(filename, fileoffset, data)
+	})
+}
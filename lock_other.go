@@ -0,0 +1,23 @@
+//go:build !unix
+
+package iutils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+func flockFile(file *os.File, shared bool) error {
+	return fmt.Errorf("%w: use LockOptions.Lockfile", errors.ErrUnsupported)
+}
+
+func funlockFile(file *os.File) error {
+	return errors.ErrUnsupported
+}
+
+// processAlive cannot check other processes here, so lock files are only
+// broken through LockOptions.StaleAfter.
+func processAlive(pid int) bool {
+	return true
+}
@@ -0,0 +1,184 @@
+package iutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileLockModes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locks", "a.lock")
+
+	excl, err := TryLockFile(path, nil)
+	if err != nil {
+		t.Fatalf("TryLockFile() error = %v", err)
+	}
+	if _, err := TryLockFile(path, nil); !errors.Is(err, ErrLocked) {
+		t.Errorf("second exclusive TryLockFile() error = %v, want %v", err, ErrLocked)
+	}
+	if _, err := TryLockFile(path, &LockOptions{Shared: true}); !errors.Is(err, ErrLocked) {
+		t.Errorf("shared TryLockFile() under exclusive error = %v, want %v", err, ErrLocked)
+	}
+	if err := excl.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if err := excl.Unlock(); err == nil {
+		t.Errorf("second Unlock() succeeded, want an error")
+	}
+
+	shared1, err := TryLockFile(path, &LockOptions{Shared: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared2, err := TryLockFile(path, &LockOptions{Shared: true})
+	if err != nil {
+		t.Fatalf("second shared TryLockFile() error = %v", err)
+	}
+	if _, err := TryLockFile(path, nil); !errors.Is(err, ErrLocked) {
+		t.Errorf("exclusive TryLockFile() under shared error = %v, want %v", err, ErrLocked)
+	}
+	shared1.Unlock()
+	shared2.Unlock()
+}
+
+func TestLockFileWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.lock")
+	held, err := TryLockFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &LockOptions{Timeout: 30 * time.Millisecond, PollInterval: 5 * time.Millisecond}
+	if _, err := LockFile(context.Background(), path, opts); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("LockFile() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := LockFile(ctx, path, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("LockFile() error = %v, want %v", err, context.Canceled)
+	}
+
+	time.AfterFunc(20*time.Millisecond, func() { held.Unlock() })
+	l, err := LockFile(context.Background(), path, &LockOptions{PollInterval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("LockFile() after release error = %v", err)
+	}
+	l.Unlock()
+}
+
+func writeLockOwner(t *testing.T, path string, owner LockOwner) {
+	t.Helper()
+	data, err := json.Marshal(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockfileStale(t *testing.T) {
+	hostname, _ := os.Hostname()
+	dir := t.TempDir()
+	opts := &LockOptions{Lockfile: true}
+
+	path := filepath.Join(dir, "live.lock")
+	l, err := TryLockFile(path, opts)
+	if err != nil {
+		t.Fatalf("TryLockFile() error = %v", err)
+	}
+	owner, err := ReadLockOwner(path)
+	if err != nil || owner.PID != os.Getpid() || owner.Hostname != hostname {
+		t.Errorf("ReadLockOwner() = %+v, %v", owner, err)
+	}
+	if _, err := TryLockFile(path, opts); !errors.Is(err, ErrLocked) {
+		t.Errorf("TryLockFile() on live lock error = %v, want %v", err, ErrLocked)
+	}
+	if err := l.Unlock(); err != nil || FileExists(path) {
+		t.Errorf("Unlock() = %v, lock file exists = %v", err, FileExists(path))
+	}
+
+	// The PID is above the Linux pid_max, so no such process exists.
+	path = filepath.Join(dir, "dead.lock")
+	writeLockOwner(t, path, LockOwner{PID: 1 << 30, Hostname: hostname, Created: time.Now()})
+	l, err = TryLockFile(path, opts)
+	if err != nil {
+		t.Fatalf("TryLockFile() on dead owner error = %v", err)
+	}
+	l.Unlock()
+
+	path = filepath.Join(dir, "remote.lock")
+	writeLockOwner(t, path, LockOwner{PID: 1 << 30, Hostname: "other-" + hostname, Created: time.Now()})
+	if _, err := TryLockFile(path, opts); !errors.Is(err, ErrLocked) {
+		t.Errorf("TryLockFile() on remote owner error = %v, want %v", err, ErrLocked)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(path, old, old)
+	l, err = TryLockFile(path, &LockOptions{Lockfile: true, StaleAfter: time.Minute})
+	if err != nil {
+		t.Fatalf("TryLockFile() with StaleAfter error = %v", err)
+	}
+	l.Unlock()
+
+	if _, err := TryLockFile(path, &LockOptions{Lockfile: true, Shared: true}); err == nil {
+		t.Errorf("shared lock file succeeded, want an error")
+	}
+}
+
+func TestWithLock(t *testing.T) {
+	for _, opts := range []*LockOptions{nil, {Lockfile: true}} {
+		filename := filepath.Join(t.TempDir(), "counter")
+		if err := WriteFile2(filename, []byte("0")); err != nil {
+			t.Fatal(err)
+		}
+		if opts != nil {
+			opts.PollInterval = time.Millisecond
+		}
+
+		const workers, rounds = 8, 20
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < rounds; j++ {
+					err := WithLockContext(context.Background(), filename, opts, func() error {
+						data, err := os.ReadFile(filename)
+						if err != nil {
+							return err
+						}
+						n, _ := strconv.Atoi(string(data))
+						return WriteFile3(filename, []byte(strconv.Itoa(n+1)))
+					})
+					if err != nil {
+						t.Error(err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		data, _ := os.ReadFile(filename)
+		if string(data) != strconv.Itoa(workers*rounds) {
+			t.Errorf("counter = %s, want %d", data, workers*rounds)
+		}
+	}
+
+	filename := filepath.Join(t.TempDir(), "parts")
+	if err := WriteFile2Locked(filename, []byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFilePartsLocked(filename, 6, []byte("there")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filename); string(data) != "hello there" {
+		t.Errorf("content = %q, want %q", data, "hello there")
+	}
+}
@@ -0,0 +1,337 @@
+package iutils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ManifestEntry describes one file of a Manifest. Path is slash separated
+// and relative to the manifest root. Size is -1 when the manifest was read
+// from a sha256sum style file, which does not record sizes.
+type ManifestEntry struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Sum  string `json:"sum"`
+}
+
+// Manifest lists the digests of every file below a directory.
+type Manifest struct {
+	Algorithm HashAlgorithm   `json:"algorithm"`
+	Entries   []ManifestEntry `json:"entries"`
+}
+
+// ManifestOptions configures BuildManifest and VerifyManifest.
+type ManifestOptions struct {
+	// Algorithm is the digest to compute, SHA-256 if zero.
+	Algorithm HashAlgorithm
+	// Workers is the number of files hashed concurrently, NumCPU if zero.
+	Workers int
+	// Filter, if set, selects the files to include. path is the slash
+	// separated path relative to the root.
+	Filter func(path string, d fs.DirEntry) bool
+}
+
+// ManifestReport is the result of VerifyManifest. All paths are relative
+// to the root and sorted.
+type ManifestReport struct {
+	Missing []string `json:"missing"`
+	Changed []string `json:"changed"`
+	Extra   []string `json:"extra"`
+}
+
+// OK reports whether the tree matched the manifest exactly.
+func (r *ManifestReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Changed) == 0 && len(r.Extra) == 0
+}
+
+// BuildManifest walks root and hashes every regular file with a bounded
+// pool of workers.
+func BuildManifest(ctx context.Context, root string, opts *ManifestOptions) (*Manifest, error) {
+	opts = manifestDefaults(opts)
+
+	paths, err := listManifestFiles(root, opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ManifestEntry, len(paths))
+	err = hashManifestFiles(ctx, root, paths, opts, func(i int, hashes *FileHashes, err error) error {
+		if err != nil {
+			return err
+		}
+		entries[i] = ManifestEntry{Path: paths[i], Size: hashes.Size, Sum: hashes.Hex(opts.Algorithm)}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manifest{Algorithm: opts.Algorithm, Entries: entries}, nil
+}
+
+// VerifyManifest re-hashes the files listed in m below root and reports the
+// files that are missing, whose content changed, and that exist on disk but
+// are not listed in m. Only opts.Workers and opts.Filter are used; the
+// algorithm always comes from m.
+func VerifyManifest(ctx context.Context, root string, m *Manifest, opts *ManifestOptions) (*ManifestReport, error) {
+	opts = manifestDefaults(opts)
+	opts.Algorithm = m.Algorithm
+
+	onDisk, err := listManifestFiles(root, opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[string]bool, len(onDisk))
+	for _, path := range onDisk {
+		present[path] = true
+	}
+
+	report := &ManifestReport{}
+	listed := make(map[string]bool, len(m.Entries))
+	var toHash []string
+	var expected []ManifestEntry
+	for _, entry := range m.Entries {
+		listed[entry.Path] = true
+		if !present[entry.Path] {
+			report.Missing = append(report.Missing, entry.Path)
+			continue
+		}
+		toHash = append(toHash, entry.Path)
+		expected = append(expected, entry)
+	}
+	for _, path := range onDisk {
+		if !listed[path] {
+			report.Extra = append(report.Extra, path)
+		}
+	}
+
+	var mu sync.Mutex
+	err = hashManifestFiles(ctx, root, toHash, opts, func(i int, hashes *FileHashes, err error) error {
+		want := expected[i]
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed after the tree was listed.
+			mu.Lock()
+			report.Missing = append(report.Missing, want.Path)
+			mu.Unlock()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if (want.Size >= 0 && hashes.Size != want.Size) ||
+			!strings.EqualFold(hashes.Hex(opts.Algorithm), want.Sum) {
+			mu.Lock()
+			report.Changed = append(report.Changed, want.Path)
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(report.Missing)
+	sort.Strings(report.Changed)
+	sort.Strings(report.Extra)
+	return report, nil
+}
+
+// WriteSumFile writes m in the format of sha256sum and friends:
+// one "<hex digest>  <path>" line per file.
+func (m *Manifest) WriteSumFile(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, entry := range m.Entries {
+		if _, err := fmt.Fprintf(bw, "%s  %s\n", entry.Sum, entry.Path); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteManifest saves m to filename atomically. A ".json" extension selects
+// the JSON format, anything else the sha256sum compatible text format.
+func WriteManifest(filename string, m *Manifest) error {
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		return WriteJson(filename, m)
+	}
+
+	af, err := CreateAtomicFile(filename)
+	if err != nil {
+		return err
+	}
+	defer af.Close()
+
+	if err := m.WriteSumFile(af); err != nil {
+		return err
+	}
+	return af.Commit()
+}
+
+// ReadManifest loads a manifest written by WriteManifest or by sha*sum.
+// For text manifests the algorithm is derived from the digest length.
+func ReadManifest(filename string) (*Manifest, error) {
+	data, err := ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		m := &Manifest{}
+		if err := json.Unmarshal(trimmed, m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	return parseSumFile(data)
+}
+
+func parseSumFile(data []byte) (*Manifest, error) {
+	m := &Manifest{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// "<sum>  <path>" for text mode, "<sum> *<path>" for binary mode.
+		sum, path, ok := strings.Cut(line, " ")
+		if !ok || len(path) < 2 || (path[0] != ' ' && path[0] != '*') {
+			return nil, fmt.Errorf("manifest line %d: malformed entry", lineNo)
+		}
+		path = path[1:]
+
+		algo, err := hashAlgorithmForHexLen(len(sum))
+		if err != nil {
+			return nil, fmt.Errorf("manifest line %d: %w", lineNo, err)
+		}
+		if m.Algorithm == 0 {
+			m.Algorithm = algo
+		} else if m.Algorithm != algo {
+			return nil, fmt.Errorf("manifest line %d: mixed digest lengths", lineNo)
+		}
+
+		m.Entries = append(m.Entries, ManifestEntry{Path: filepath.ToSlash(path), Size: -1, Sum: sum})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if m.Algorithm == 0 {
+		m.Algorithm = HashSHA256
+	}
+	return m, nil
+}
+
+func hashAlgorithmForHexLen(n int) (HashAlgorithm, error) {
+	switch n {
+	case 32:
+		return HashMD5, nil
+	case 40:
+		return HashSHA1, nil
+	case 64:
+		return HashSHA256, nil
+	case 128:
+		return HashSHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported digest length %d", n)
+}
+
+func manifestDefaults(opts *ManifestOptions) *ManifestOptions {
+	o := ManifestOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Algorithm == 0 {
+		o.Algorithm = HashSHA256
+	}
+	if o.Workers <= 0 {
+		o.Workers = runtime.NumCPU()
+	}
+	return &o
+}
+
+// listManifestFiles returns the slash separated relative paths of all
+// regular files below root in lexical order.
+func listManifestFiles(root string, filter func(string, fs.DirEntry) bool) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if filter != nil && !filter(rel, d) {
+			return nil
+		}
+		paths = append(paths, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// hashManifestFiles hashes paths with opts.Workers goroutines and calls fn
+// with the index of each path. The first error returned by fn cancels the
+// remaining work.
+func hashManifestFiles(ctx context.Context, root string, paths []string, opts *ManifestOptions, fn func(i int, hashes *FileHashes, err error) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				hashes, err := HashFile(ctx, filepath.Join(root, filepath.FromSlash(paths[i])), opts.Algorithm)
+				if err := fn(i, hashes, err); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range paths {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
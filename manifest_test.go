@@ -0,0 +1,132 @@
+package iutils
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTestTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := WriteFile2(filepath.Join(root, filepath.FromSlash(name)), []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBuildManifest(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		"a.txt":     "abc",
+		"sub/b.txt": "hello",
+		"sub/c.log": "log",
+	})
+
+	m, err := BuildManifest(context.Background(), root, &ManifestOptions{
+		Workers: 2,
+		Filter: func(path string, d fs.DirEntry) bool {
+			return filepath.Ext(path) == ".txt"
+		},
+	})
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+
+	want := []ManifestEntry{
+		{Path: "a.txt", Size: 3, Sum: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{Path: "sub/b.txt", Size: 5, Sum: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+	}
+	if m.Algorithm != HashSHA256 || !reflect.DeepEqual(m.Entries, want) {
+		t.Errorf("BuildManifest() = %+v, want %+v", m.Entries, want)
+	}
+
+	var buf bytes.Buffer
+	if err := m.WriteSumFile(&buf); err != nil {
+		t.Fatal(err)
+	}
+	wantText := want[0].Sum + "  a.txt\n" + want[1].Sum + "  sub/b.txt\n"
+	if buf.String() != wantText {
+		t.Errorf("WriteSumFile() = %q, want %q", buf.String(), wantText)
+	}
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{"x": "1", "y/z": "2"})
+
+	m, err := BuildManifest(context.Background(), root, &ManifestOptions{Algorithm: HashSHA1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"manifest.json", "manifest.sha1"} {
+		filename := filepath.Join(t.TempDir(), name)
+		if err := WriteManifest(filename, m); err != nil {
+			t.Fatalf("WriteManifest(%s) error = %v", name, err)
+		}
+		got, err := ReadManifest(filename)
+		if err != nil {
+			t.Fatalf("ReadManifest(%s) error = %v", name, err)
+		}
+		if got.Algorithm != HashSHA1 || len(got.Entries) != 2 || got.Entries[1].Path != "y/z" {
+			t.Errorf("ReadManifest(%s) = %+v", name, got)
+		}
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		"keep.txt":   "same",
+		"change.txt": "before",
+		"gone.txt":   "bye",
+	})
+
+	m, err := BuildManifest(context.Background(), root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := VerifyManifest(context.Background(), root, m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("VerifyManifest() on unchanged tree = %+v", report)
+	}
+
+	writeTestTree(t, root, map[string]string{"change.txt": "after!", "new/extra.txt": "x"})
+	if err := os.Remove(filepath.Join(root, "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = VerifyManifest(context.Background(), root, m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ManifestReport{
+		Missing: []string{"gone.txt"},
+		Changed: []string{"change.txt"},
+		Extra:   []string{"new/extra.txt"},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("VerifyManifest() = %+v, want %+v", report, want)
+	}
+}
+
+func TestReadManifestMalformed(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "bad.sha256")
+	content := strings.Repeat("a", 64) + "  ok.txt\nnot-a-digest\n"
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadManifest(filename); err == nil {
+		t.Errorf("ReadManifest() expected error for malformed line")
+	}
+}
@@ -0,0 +1,520 @@
+package iutils
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Fault makes matching MemFS operations fail, for testing error paths.
+type Fault struct {
+	// Op is the operation to fail: "open", "read", "write", "sync",
+	// "mkdir", "remove" or "rename". Empty matches all of them.
+	Op string
+	// Path is a path.Match pattern for the file name. Empty matches all
+	// files.
+	Path string
+	// Err is the error returned, wrapped in an *fs.PathError, e.g.
+	// syscall.ENOSPC or syscall.EIO. With ShortWrite it defaults to
+	// io.ErrShortWrite.
+	Err error
+	// ShortWrite makes a write store the first half of its data before it
+	// fails.
+	ShortWrite bool
+	// Count is how many times the fault fires, unlimited if zero.
+	Count int
+}
+
+// MemFS is an in-memory WritableFS. It is safe for concurrent use. The
+// zero value is not usable; create one with NewMemFS.
+type MemFS struct {
+	mu       sync.Mutex
+	nodes    map[string]*memNode
+	used     int64
+	capacity int64
+	faults   []*Fault
+}
+
+type memNode struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+	// detached is set once the node is removed or replaced. Files still
+	// open on it keep working but no longer count against the capacity.
+	detached bool
+}
+
+// NewMemFS returns an empty MemFS.
+func NewMemFS() *MemFS {
+	return &MemFS{nodes: map[string]*memNode{
+		".": {mode: fs.ModeDir | 0755, modTime: time.Now()},
+	}}
+}
+
+// SetCapacity limits the total size of the files. Writes beyond it store
+// what fits and fail with syscall.ENOSPC. Zero is unlimited.
+func (m *MemFS) SetCapacity(bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.capacity = bytes
+}
+
+// InjectFault adds a fault. Faults are checked in the order they were
+// added.
+func (m *MemFS) InjectFault(f Fault) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.faults = append(m.faults, &f)
+}
+
+// ClearFaults removes all faults.
+func (m *MemFS) ClearFaults() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.faults = nil
+}
+
+// fault returns the fault for op on name, if any. m.mu must be held.
+func (m *MemFS) fault(op, name string) *Fault {
+	for i, f := range m.faults {
+		if f.Op != "" && f.Op != op {
+			continue
+		}
+		if f.Path != "" {
+			if ok, _ := path.Match(f.Path, name); !ok {
+				continue
+			}
+		}
+		if f.Count > 0 {
+			if f.Count--; f.Count == 0 {
+				m.faults = append(m.faults[:i:i], m.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// faultErr returns the error of a fault for op on name. m.mu must be held.
+func (m *MemFS) faultErr(op, name string) error {
+	f := m.fault(op, name)
+	if f == nil {
+		return nil
+	}
+	return faultError(f, op, name)
+}
+
+func faultError(f *Fault, op, name string) error {
+	err := f.Err
+	if err == nil {
+		err = io.ErrShortWrite
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func memPathError(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// dir returns the directory name, or an error if it is missing or a file.
+// m.mu must be held.
+func (m *MemFS) dir(op, name string) error {
+	n := m.nodes[name]
+	if n == nil {
+		return memPathError(op, name, fs.ErrNotExist)
+	}
+	if !n.mode.IsDir() {
+		return memPathError(op, name, syscall.ENOTDIR)
+	}
+	return nil
+}
+
+// Open opens name for reading.
+func (m *MemFS) Open(name string) (fs.File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens name with the os.O_* flags.
+func (m *MemFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, memPathError("open", name, fs.ErrInvalid)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.faultErr("open", name); err != nil {
+		return nil, err
+	}
+
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	n := m.nodes[name]
+	switch {
+	case n == nil && flag&os.O_CREATE == 0:
+		return nil, memPathError("open", name, fs.ErrNotExist)
+	case n == nil:
+		if err := m.dir("open", path.Dir(name)); err != nil {
+			return nil, err
+		}
+		n = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		m.nodes[name] = n
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, memPathError("open", name, fs.ErrExist)
+	case n.mode.IsDir() && writable:
+		return nil, memPathError("open", name, syscall.EISDIR)
+	}
+	if writable && flag&os.O_TRUNC != 0 {
+		m.used -= int64(len(n.data))
+		n.data, n.modTime = nil, time.Now()
+	}
+	return &memFile{fs: m, name: name, node: n, flag: flag}, nil
+}
+
+// Stat returns the FileInfo of name.
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, memPathError("stat", name, fs.ErrInvalid)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := m.nodes[name]
+	if n == nil {
+		return nil, memPathError("stat", name, fs.ErrNotExist)
+	}
+	return n.info(name), nil
+}
+
+// ReadDir returns the entries of the directory name, sorted by name.
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, memPathError("readdir", name, fs.ErrInvalid)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.dir("readdir", name); err != nil {
+		return nil, err
+	}
+	return m.readDir(name), nil
+}
+
+// readDir lists the directory name. m.mu must be held.
+func (m *MemFS) readDir(name string) []fs.DirEntry {
+	var entries []fs.DirEntry
+	for p, n := range m.nodes {
+		if p != "." && path.Dir(p) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(n.info(p)))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+// MkdirAll creates the directory name and its missing parents.
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return memPathError("mkdir", name, fs.ErrInvalid)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.faultErr("mkdir", name); err != nil {
+		return err
+	}
+
+	var missing []string
+	for p := name; ; p = path.Dir(p) {
+		if n := m.nodes[p]; n != nil {
+			if !n.mode.IsDir() {
+				return memPathError("mkdir", p, syscall.ENOTDIR)
+			}
+			break
+		}
+		missing = append(missing, p)
+	}
+	for _, p := range missing {
+		m.nodes[p] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	}
+	return nil
+}
+
+// Remove removes a file or an empty directory.
+func (m *MemFS) Remove(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return memPathError("remove", name, fs.ErrInvalid)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.faultErr("remove", name); err != nil {
+		return err
+	}
+	n := m.nodes[name]
+	if n == nil {
+		return memPathError("remove", name, fs.ErrNotExist)
+	}
+	if n.mode.IsDir() && len(m.readDir(name)) > 0 {
+		return memPathError("remove", name, syscall.ENOTEMPTY)
+	}
+	m.used -= int64(len(n.data))
+	n.detached = true
+	delete(m.nodes, name)
+	return nil
+}
+
+// Rename moves oldname to newname, replacing an existing file.
+func (m *MemFS) Rename(oldname, newname string) error {
+	if !fs.ValidPath(oldname) || !fs.ValidPath(newname) || oldname == "." || newname == "." {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.faultErr("rename", oldname); err != nil {
+		return err
+	}
+
+	n := m.nodes[oldname]
+	if n == nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if err := m.dir("rename", path.Dir(newname)); err != nil {
+		return err
+	}
+	if oldname == newname {
+		return nil
+	}
+	if n.mode.IsDir() && strings.HasPrefix(newname, oldname+"/") {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+	if old := m.nodes[newname]; old != nil {
+		if old.mode.IsDir() {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EEXIST}
+		}
+		m.used -= int64(len(old.data))
+		old.detached = true
+	}
+
+	delete(m.nodes, oldname)
+	m.nodes[newname] = n
+	if n.mode.IsDir() {
+		prefix := oldname + "/"
+		for p, child := range m.nodes {
+			if strings.HasPrefix(p, prefix) {
+				delete(m.nodes, p)
+				m.nodes[newname+"/"+p[len(prefix):]] = child
+			}
+		}
+	}
+	return nil
+}
+
+func (n *memNode) info(name string) fs.FileInfo {
+	return &memFileInfo{name: path.Base(name), size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *memFileInfo) Sys() any           { return nil }
+
+// memFile is an open file of a MemFS. Its content is shared with the
+// MemFS, so writes are visible to other open files at once.
+type memFile struct {
+	fs     *MemFS
+	name   string
+	node   *memNode
+	flag   int
+	offset int64
+	dirPos int
+	closed bool
+}
+
+func (f *memFile) check(op string, write bool) error {
+	if f.closed {
+		return memPathError(op, f.name, fs.ErrClosed)
+	}
+	writable := f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+	readable := f.flag&os.O_WRONLY == 0
+	if (write && !writable) || (!write && !readable) {
+		return memPathError(op, f.name, syscall.EBADF)
+	}
+	return nil
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return nil, memPathError("stat", f.name, fs.ErrClosed)
+	}
+	return f.node.info(f.name), nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if f.node.mode.IsDir() {
+		return 0, memPathError("read", f.name, syscall.EISDIR)
+	}
+	if err := f.fs.faultErr("read", f.name); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, memPathError("read", f.name, fs.ErrInvalid)
+	}
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.node.data))
+	}
+
+	var err error
+	want := p
+	if fault := f.fs.fault("write", f.name); fault != nil {
+		err = faultError(fault, "write", f.name)
+		if !fault.ShortWrite {
+			return 0, err
+		}
+		p = p[:len(p)/2]
+	}
+	if f.fs.capacity > 0 && !f.node.detached {
+		room := max(f.fs.capacity-f.fs.used, 0)
+		if grow := f.offset + int64(len(p)) - int64(len(f.node.data)); grow > room {
+			p = p[:max(int64(len(p))-(grow-room), 0)]
+			err = memPathError("write", f.name, syscall.ENOSPC)
+		}
+	}
+	if len(p) == 0 {
+		if err == nil && len(want) > 0 {
+			err = memPathError("write", f.name, io.ErrShortWrite)
+		}
+		return 0, err
+	}
+
+	if end := f.offset + int64(len(p)); end > int64(len(f.node.data)) {
+		if !f.node.detached {
+			f.fs.used += end - int64(len(f.node.data))
+		}
+		if end > int64(cap(f.node.data)) {
+			grown := make([]byte, end, max(end, 2*int64(cap(f.node.data))))
+			copy(grown, f.node.data)
+			f.node.data = grown
+		}
+		f.node.data = f.node.data[:end]
+	}
+	n := copy(f.node.data[f.offset:], p)
+	f.offset += int64(n)
+	f.node.modTime = time.Now()
+	if err == nil && n < len(want) {
+		err = memPathError("write", f.name, io.ErrShortWrite)
+	}
+	return n, err
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return 0, memPathError("seek", f.name, fs.ErrClosed)
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, memPathError("seek", f.name, fs.ErrInvalid)
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return memPathError("sync", f.name, fs.ErrClosed)
+	}
+	return f.fs.faultErr("sync", f.name)
+}
+
+// ReadDir lists a directory opened with Open, as fs.ReadDirFile.
+func (f *memFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return nil, memPathError("readdir", f.name, fs.ErrClosed)
+	}
+	if !f.node.mode.IsDir() {
+		return nil, memPathError("readdir", f.name, syscall.ENOTDIR)
+	}
+	entries := f.fs.readDir(f.name)
+	if f.dirPos > len(entries) {
+		f.dirPos = len(entries)
+	}
+	entries = entries[f.dirPos:]
+	if count > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		if count < len(entries) {
+			entries = entries[:count]
+		}
+	}
+	f.dirPos += len(entries)
+	return entries, nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return memPathError("close", f.name, fs.ErrClosed)
+	}
+	f.closed = true
+	return nil
+}
+
+var (
+	_ WritableFS     = (*MemFS)(nil)
+	_ fs.StatFS      = (*MemFS)(nil)
+	_ fs.ReadDirFS   = (*MemFS)(nil)
+	_ fs.ReadDirFile = (*memFile)(nil)
+)
@@ -0,0 +1,189 @@
+package iutils
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMemFSConformance(t *testing.T) {
+	m := NewMemFS()
+	for name, data := range map[string]string{"a.txt": "a", "dir/b.txt": "bb", "dir/sub/c": "ccc"} {
+		if err := WriteFile2FS(m, name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.MkdirAll("empty", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(m, "a.txt", "dir/b.txt", "dir/sub/c", "empty"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemFSOperations(t *testing.T) {
+	m := NewMemFS()
+	if err := WriteFile2FS(m, "d/f", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := m.OpenFile("d/f", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("+more"))
+	if _, err := f.Read(make([]byte, 1)); !errors.Is(err, syscall.EBADF) {
+		t.Errorf("Read() of a write-only file error = %v, want %v", err, syscall.EBADF)
+	}
+	f.Close()
+	if _, err := f.Write(nil); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("Write() after Close error = %v, want %v", err, fs.ErrClosed)
+	}
+	if data, _ := ReadFileFS(m, "d/f"); string(data) != "data+more" {
+		t.Errorf("content after append = %q", data)
+	}
+
+	if _, err := m.OpenFile("d/f", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("OpenFile(O_EXCL) error = %v, want %v", err, fs.ErrExist)
+	}
+	if err := m.MkdirAll("d/f/g", 0755); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("MkdirAll() through a file error = %v, want %v", err, syscall.ENOTDIR)
+	}
+	if err := m.Remove("d"); !errors.Is(err, syscall.ENOTEMPTY) {
+		t.Errorf("Remove() of a full directory error = %v, want %v", err, syscall.ENOTEMPTY)
+	}
+	if err := m.Rename("d", "e"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFileFS(m, "e/f"); err != nil || string(data) != "data+more" {
+		t.Errorf("ReadFileFS() after directory rename = %q, %v", data, err)
+	}
+	if err := m.Remove("e/f"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Remove("e"); err != nil {
+		t.Errorf("Remove() of an empty directory error = %v", err)
+	}
+}
+
+func TestMemFSFaults(t *testing.T) {
+	m := NewMemFS()
+
+	m.InjectFault(Fault{Op: "write", Path: "*.log", Err: syscall.EIO, Count: 1})
+	if err := WriteFileFS(m, "a.log", []byte("x")); !errors.Is(err, syscall.EIO) {
+		t.Errorf("WriteFileFS() with EIO fault error = %v, want %v", err, syscall.EIO)
+	}
+	if err := WriteFileFS(m, "a.log", []byte("x")); err != nil {
+		t.Errorf("WriteFileFS() after the fault expired error = %v", err)
+	}
+
+	m.InjectFault(Fault{Op: "write", ShortWrite: true})
+	f, err := m.OpenFile("short", os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := f.Write([]byte("12345678"))
+	if n != 4 || !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("Write() with short write fault = %d, %v, want 4, %v", n, err, io.ErrShortWrite)
+	}
+	f.Close()
+	if err := WriteFileFS(m, "b", []byte("1234")); !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("WriteFileFS() with short write fault error = %v", err)
+	}
+	m.ClearFaults()
+
+	// A failed sync or rename leaves the old content of an atomic write.
+	if err := WriteFile3FS(m, "atomic", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range []string{"sync", "rename"} {
+		m.InjectFault(Fault{Op: op, Err: syscall.EIO})
+		if err := WriteFile3FS(m, "atomic", []byte("new")); !errors.Is(err, syscall.EIO) {
+			t.Errorf("WriteFile3FS() with %s fault error = %v, want %v", op, err, syscall.EIO)
+		}
+		m.ClearFaults()
+		if data, _ := ReadFileFS(m, "atomic"); string(data) != "old" {
+			t.Errorf("content after failed %s = %q, want %q", op, data, "old")
+		}
+	}
+	if entries, _ := m.ReadDir("."); len(entries) != 4 {
+		t.Errorf("%d files, want no temporary files left", len(entries))
+	}
+
+	// a.log, short, the half of b and atomic use 10 bytes.
+	m.SetCapacity(10 + 2)
+	if err := WriteFileFS(m, "full", []byte("abcd")); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("WriteFileFS() beyond capacity error = %v, want %v", err, syscall.ENOSPC)
+	}
+	if data, _ := ReadFileFS(m, "full"); string(data) != "ab" {
+		t.Errorf("content after ENOSPC = %q, want %q", data, "ab")
+	}
+	if err := m.Remove("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileFS(m, "full", []byte("abcd")); err != nil {
+		t.Errorf("WriteFileFS() after freeing space error = %v", err)
+	}
+}
+
+func TestMemFSCapacityAccounting(t *testing.T) {
+	m := NewMemFS()
+	m.SetCapacity(10)
+	if err := WriteFileFS(m, "a", []byte("12345")); err != nil {
+		t.Fatal(err)
+	}
+	// Renaming a file onto itself changes nothing.
+	if err := m.Rename("a", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ReadFileFS(m, "a"); string(data) != "12345" {
+		t.Errorf("content after renaming onto itself = %q", data)
+	}
+	if err := WriteFileFS(m, "b", []byte("123456")); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("WriteFileFS() beyond capacity after self-rename error = %v, want %v", err, syscall.ENOSPC)
+	}
+	m.Remove("b")
+
+	// Writes through handles of removed or replaced files do not count.
+	removed, err := m.OpenFile("a", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removed.Close()
+	if err := m.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := removed.Write([]byte("67890")); err != nil {
+		t.Fatalf("Write() to a removed file error = %v", err)
+	}
+
+	if err := WriteFileFS(m, "c", []byte("12")); err != nil {
+		t.Fatal(err)
+	}
+	replaced, err := m.OpenFile("c", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replaced.Close()
+	if err := WriteFileFS(m, "d", []byte("34")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Rename("d", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replaced.Write([]byte("5678")); err != nil {
+		t.Fatalf("Write() to a replaced file error = %v", err)
+	}
+
+	// Only c, with 2 bytes, is left.
+	if err := WriteFileFS(m, "e", []byte("12345678")); err != nil {
+		t.Errorf("WriteFileFS() within capacity error = %v", err)
+	}
+	if err := WriteFileFS(m, "f", []byte("1")); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("WriteFileFS() beyond capacity error = %v, want %v", err, syscall.ENOSPC)
+	}
+}
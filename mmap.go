@@ -0,0 +1,192 @@
+package iutils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"sync"
+)
+
+// MmapOptions configures OpenMmap. A nil *MmapOptions maps the file
+// read-only and falls back to reading it where mmap is unavailable.
+type MmapOptions struct {
+	// Writable maps the file read-write. Changes made through Bytes are
+	// written to the file by Flush.
+	Writable bool
+	// NoFallback fails instead of reading the whole file into memory when
+	// it cannot be mapped.
+	NoFallback bool
+}
+
+// MmapFile is a file mapped into memory. ReadAt may be called concurrently
+// and after Close returns fs.ErrClosed; the slice returned by Bytes must
+// not be used after Close.
+type MmapFile struct {
+	file     *os.File
+	data     []byte
+	writable bool
+	mapped   bool
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// OpenMmap maps filename into memory. An empty file gives an empty mapping,
+// since a zero-length mmap is not possible. The size of the file is fixed
+// when it is opened; growing it needs a new mapping.
+func OpenMmap(filename string, opts *MmapOptions) (*MmapFile, error) {
+	return openMmap(filename, opts, true)
+}
+
+func openMmap(filename string, opts *MmapOptions, useMmap bool) (*MmapFile, error) {
+	if opts == nil {
+		opts = &MmapOptions{}
+	}
+	flag := os.O_RDONLY
+	if opts.Writable {
+		flag = os.O_RDWR
+	}
+	file, err := os.OpenFile(filename, flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	m := &MmapFile{file: file, data: []byte{}, writable: opts.Writable}
+	if err := m.load(useMmap, opts.NoFallback); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *MmapFile) load(useMmap, noFallback bool) error {
+	info, err := m.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > math.MaxInt {
+		return fmt.Errorf("iutils: %s: file of %d bytes is too large to map", m.file.Name(), info.Size())
+	}
+	size := int(info.Size())
+	if size == 0 {
+		return nil
+	}
+
+	err = errors.ErrUnsupported
+	if useMmap {
+		m.data, err = mmap(m.file, size, m.writable)
+		if err == nil {
+			m.mapped = true
+			return nil
+		}
+	}
+	if noFallback {
+		return &os.PathError{Op: "mmap", Path: m.file.Name(), Err: err}
+	}
+
+	// Files such as those of /proc cannot be mapped; read them instead.
+	m.data = make([]byte, size)
+	n, err := io.ReadFull(m.file, m.data)
+	if err == io.ErrUnexpectedEOF {
+		// The file shrank since Stat.
+		m.data, err = m.data[:n], nil
+	}
+	return err
+}
+
+// Bytes returns the content of the file. For a read-only mapping the
+// slice must not be modified.
+func (m *MmapFile) Bytes() []byte {
+	return m.data
+}
+
+// Len returns the size of the mapping.
+func (m *MmapFile) Len() int {
+	return len(m.data)
+}
+
+// Mapped reports whether the file is mapped, as opposed to read into
+// memory as a fallback.
+func (m *MmapFile) Mapped() bool {
+	return m.mapped
+}
+
+// Name returns the name of the file.
+func (m *MmapFile) Name() string {
+	return m.file.Name()
+}
+
+// ReadAt implements io.ReaderAt.
+func (m *MmapFile) ReadAt(p []byte, off int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return 0, fs.ErrClosed
+	}
+	if off < 0 {
+		return 0, fmt.Errorf("iutils: negative offset %d", off)
+	}
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Flush writes the changes of a writable mapping to stable storage. It
+// does nothing for read-only mappings.
+func (m *MmapFile) Flush() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return fs.ErrClosed
+	}
+	if !m.writable || len(m.data) == 0 {
+		return nil
+	}
+	if err := m.writeBack(); err != nil {
+		return err
+	}
+	return m.file.Sync()
+}
+
+// writeBack syncs the pages of a mapping, or writes a fallback copy back to
+// the file.
+func (m *MmapFile) writeBack() error {
+	if m.mapped {
+		if err := msync(m.data); err != nil {
+			return &os.PathError{Op: "msync", Path: m.file.Name(), Err: err}
+		}
+		return nil
+	}
+	_, err := m.file.WriteAt(m.data, 0)
+	return err
+}
+
+// Close releases the mapping. Changes of a writable mapping are kept in
+// the file but, without Flush, not necessarily on stable storage.
+func (m *MmapFile) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return fs.ErrClosed
+	}
+	m.closed = true
+
+	var err error
+	if m.mapped {
+		err = munmap(m.data)
+	} else if m.writable && len(m.data) > 0 {
+		err = m.writeBack()
+	}
+	m.data = nil
+	if closeErr := m.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
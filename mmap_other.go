@@ -0,0 +1,21 @@
+//go:build !(linux || darwin || freebsd)
+
+package iutils
+
+import (
+	"errors"
+	"os"
+)
+
+// mmap is not supported on this platform; OpenMmap reads the file instead.
+func mmap(file *os.File, size int, writable bool) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func munmap(data []byte) error {
+	return errors.ErrUnsupported
+}
+
+func msync(data []byte) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,122 @@
+package iutils
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestMmapRead(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "index")
+	if err := os.WriteFile(filename, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, useMmap := range []bool{true, false} {
+		m, err := openMmap(filename, nil, useMmap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantMapped := useMmap && (runtime.GOOS == "linux" || runtime.GOOS == "darwin" || runtime.GOOS == "freebsd")
+		if m.Mapped() != wantMapped {
+			t.Errorf("Mapped() = %v, want %v", m.Mapped(), wantMapped)
+		}
+		if string(m.Bytes()) != "0123456789" || m.Len() != 10 {
+			t.Errorf("Bytes() = %q", m.Bytes())
+		}
+
+		tests := []struct {
+			off     int64
+			n       int
+			want    string
+			wantErr error
+		}{
+			{0, 4, "0123", nil},
+			{6, 4, "6789", nil},
+			{8, 4, "89", io.EOF},
+			{10, 1, "", io.EOF},
+		}
+		for _, tt := range tests {
+			p := make([]byte, tt.n)
+			n, err := m.ReadAt(p, tt.off)
+			if string(p[:n]) != tt.want || err != tt.wantErr {
+				t.Errorf("ReadAt(%d bytes at %d) = %q, %v, want %q, %v", tt.n, tt.off, p[:n], err, tt.want, tt.wantErr)
+			}
+		}
+		if _, err := io.ReadAll(io.NewSectionReader(m, 0, 10)); err != nil {
+			t.Errorf("reading through a SectionReader error = %v", err)
+		}
+
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.ReadAt(make([]byte, 1), 0); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("ReadAt() after Close error = %v, want %v", err, fs.ErrClosed)
+		}
+	}
+}
+
+func TestMmapWrite(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "index")
+	for _, useMmap := range []bool{true, false} {
+		if err := os.WriteFile(filename, []byte("hello world"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		m, err := openMmap(filename, &MmapOptions{Writable: true}, useMmap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(m.Bytes(), "HELLO")
+		if err := m.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(filename); string(data) != "HELLO world" {
+			t.Errorf("mmap=%v: content after Flush = %q", useMmap, data)
+		}
+
+		copy(m.Bytes()[6:], "WORLD")
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(filename); string(data) != "HELLO WORLD" {
+			t.Errorf("mmap=%v: content after Close = %q", useMmap, data)
+		}
+	}
+}
+
+func TestMmapEmptyAndMissing(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "empty")
+	if err := os.WriteFile(filename, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := OpenMmap(filename, &MmapOptions{Writable: true, NoFallback: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Len() != 0 || m.Bytes() == nil {
+		t.Errorf("Bytes() of an empty file = %v", m.Bytes())
+	}
+	if n, err := m.ReadAt(make([]byte, 1), 0); n != 0 || err != io.EOF {
+		t.Errorf("ReadAt() of an empty file = %d, %v", n, err)
+	}
+	if err := m.Flush(); err != nil {
+		t.Errorf("Flush() of an empty file error = %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenMmap(filepath.Join(dir, "missing"), nil); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("OpenMmap() of a missing file error = %v, want %v", err, fs.ErrNotExist)
+	}
+	filename = filepath.Join(dir, "data")
+	os.WriteFile(filename, []byte("x"), 0644)
+	if _, err := openMmap(filename, &MmapOptions{NoFallback: true}, false); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("openMmap() without mmap and fallback error = %v, want %v", err, errors.ErrUnsupported)
+	}
+}
@@ -0,0 +1,373 @@
+package iutils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPathEscapes is returned for paths that lead outside a Root.
+var ErrPathEscapes = errors.New("iutils: path escapes root")
+
+// maxSymlinkHops bounds symlink resolution, like the kernel's ELOOP limit.
+const maxSymlinkHops = 40
+
+// Root confines file operations to a directory. Names passed to its
+// methods are relative to the root; absolute names, ".." components that
+// climb above the root and symlinks that point outside it are rejected
+// with ErrPathEscapes. Symlinks within the root are followed.
+//
+// Names are checked when an operation starts. A process that can modify
+// the tree concurrently can still swap a directory for a symlink in
+// between, so Root guards against untrusted names, not against untrusted
+// writers of the directory itself.
+type Root struct {
+	dir string // absolute, without symlinks
+}
+
+// OpenRoot returns a Root for the existing directory dir.
+func OpenRoot(dir string) (*Root, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	abs, err = filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "openroot", Path: dir, Err: errors.New("not a directory")}
+	}
+	return &Root{dir: abs}, nil
+}
+
+// SafeJoin joins name to the directory base like filepath.Join, but fails
+// with ErrPathEscapes if the result would lie outside base.
+func SafeJoin(base, name string) (string, error) {
+	r, err := OpenRoot(base)
+	if err != nil {
+		return "", err
+	}
+	return r.Path(name)
+}
+
+// Dir returns the absolute path of the root directory.
+func (r *Root) Dir() string {
+	return r.dir
+}
+
+// Path returns the absolute path of name, with the symlinks in it resolved.
+// Components that do not exist yet are kept as they are, so the result can
+// be used to create files.
+func (r *Root) Path(name string) (string, error) {
+	return r.resolve(name, true)
+}
+
+// Sub returns a Root for the directory name below r.
+func (r *Root) Sub(name string) (*Root, error) {
+	path, err := r.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "sub", Path: name, Err: errors.New("not a directory")}
+	}
+	return &Root{dir: path}, nil
+}
+
+// Rel returns the name of path, an absolute path inside the root, relative
+// to the root.
+func (r *Root) Rel(path string) (string, error) {
+	rel, err := filepath.Rel(r.dir, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", &fs.PathError{Op: "rel", Path: path, Err: ErrPathEscapes}
+	}
+	return rel, nil
+}
+
+// resolve walks name component by component below the root. With
+// followLast unset, a symlink in the last component is not followed.
+func (r *Root) resolve(name string, followLast bool) (string, error) {
+	escape := &fs.PathError{Op: "resolve", Path: name, Err: ErrPathEscapes}
+	if strings.IndexByte(name, 0) >= 0 {
+		return "", &fs.PathError{Op: "resolve", Path: name, Err: fs.ErrInvalid}
+	}
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if !filepath.IsLocal(clean) {
+		return "", escape
+	}
+
+	parts := splitPath(clean)
+	cur := r.dir
+	hops := 0
+	missing := false
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if missing {
+				// The kernel fails on ".." below a missing directory;
+				// cleaning it away lexically would skip the checks of
+				// the components that follow.
+				return "", &fs.PathError{Op: "resolve", Path: name, Err: fs.ErrNotExist}
+			}
+			// Only symlink targets bring ".." this far.
+			if cur == r.dir {
+				return "", escape
+			}
+			cur = filepath.Dir(cur)
+			continue
+		}
+
+		next := filepath.Join(cur, part)
+		if missing {
+			// Nothing exists below a missing component.
+			cur = next
+			continue
+		}
+		info, err := os.Lstat(next)
+		if errors.Is(err, fs.ErrNotExist) {
+			cur, missing = next, true
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 || (len(parts) == 0 && !followLast) {
+			cur = next
+			continue
+		}
+
+		if hops++; hops > maxSymlinkHops {
+			return "", &fs.PathError{Op: "resolve", Path: name, Err: errors.New("too many levels of symbolic links")}
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			// The target is checked component by component, without
+			// cleaning it first, because ".." after a symlink does not
+			// mean what it means lexically.
+			rest, ok := strings.CutPrefix(target, r.dir)
+			if !ok || (rest != "" && !os.IsPathSeparator(rest[0]) && !os.IsPathSeparator(r.dir[len(r.dir)-1])) {
+				return "", escape
+			}
+			cur, target = r.dir, rest
+		}
+		parts = append(splitPath(target), parts...)
+	}
+	return cur, nil
+}
+
+func splitPath(path string) []string {
+	return strings.FieldsFunc(path, func(c rune) bool { return c < 0x80 && os.IsPathSeparator(uint8(c)) })
+}
+
+// Open opens name for reading.
+func (r *Root) Open(name string) (*os.File, error) {
+	path, err := r.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// OpenFile is os.OpenFile within the root.
+func (r *Root) OpenFile(name string, flag int, perm fs.FileMode) (*os.File, error) {
+	path, err := r.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, flag, perm)
+}
+
+// Stat is os.Stat within the root.
+func (r *Root) Stat(name string) (fs.FileInfo, error) {
+	path, err := r.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(path)
+}
+
+// Lstat is os.Lstat within the root.
+func (r *Root) Lstat(name string) (fs.FileInfo, error) {
+	path, err := r.resolve(name, false)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(path)
+}
+
+// FileExists is FileExists within the root.
+func (r *Root) FileExists(name string) bool {
+	path, err := r.Path(name)
+	return err == nil && FileExists(path)
+}
+
+// DirExists is DirExists within the root.
+func (r *Root) DirExists(name string) bool {
+	path, err := r.Path(name)
+	return err == nil && DirExists(path)
+}
+
+// GetFileSize is GetFileSize within the root.
+func (r *Root) GetFileSize(name string) (int64, error) {
+	path, err := r.Path(name)
+	if err != nil {
+		return 0, err
+	}
+	return GetFileSize(path)
+}
+
+// ReadFile is ReadFile within the root.
+func (r *Root) ReadFile(name string) ([]byte, error) {
+	path, err := r.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return ReadFile(path)
+}
+
+// ReadFileParts is ReadFileParts within the root.
+func (r *Root) ReadFileParts(name string, fileoffset int64, length int64) ([]byte, error) {
+	path, err := r.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return ReadFileParts(path, fileoffset, length)
+}
+
+// WriteFile is WriteFile within the root.
+func (r *Root) WriteFile(name string, data []byte) error {
+	path, err := r.Path(name)
+	if err != nil {
+		return err
+	}
+	return WriteFile(path, data)
+}
+
+// WriteFile2 is WriteFile2 within the root.
+func (r *Root) WriteFile2(name string, data []byte) error {
+	path, err := r.Path(name)
+	if err != nil {
+		return err
+	}
+	return WriteFile2(path, data)
+}
+
+// WriteFile3 is WriteFile3 within the root.
+func (r *Root) WriteFile3(name string, data []byte) error {
+	path, err := r.Path(name)
+	if err != nil {
+		return err
+	}
+	return WriteFile3(path, data)
+}
+
+// WriteFileParts is WriteFileParts within the root.
+func (r *Root) WriteFileParts(name string, fileoffset int64, data []byte) error {
+	path, err := r.Path(name)
+	if err != nil {
+		return err
+	}
+	return WriteFileParts(path, fileoffset, data)
+}
+
+// WriteJson is WriteJson within the root.
+func (r *Root) WriteJson(name string, data interface{}) error {
+	path, err := r.Path(name)
+	if err != nil {
+		return err
+	}
+	return WriteJson(path, data)
+}
+
+// WriteScript is WriteScript within the root.
+func (r *Root) WriteScript(name string, data []byte) error {
+	path, err := r.Path(name)
+	if err != nil {
+		return err
+	}
+	return WriteScript(path, data)
+}
+
+// MkdirAll is os.MkdirAll within the root.
+func (r *Root) MkdirAll(name string, perm fs.FileMode) error {
+	path, err := r.Path(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(path, perm)
+}
+
+// Remove removes the file or empty directory name. A symlink is removed
+// itself, not its target.
+func (r *Root) Remove(name string) error {
+	path, err := r.resolve(name, false)
+	if err != nil {
+		return err
+	}
+	if path == r.dir {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Remove(path)
+}
+
+// RemoveAll removes name and everything below it. The root itself cannot
+// be removed.
+func (r *Root) RemoveAll(name string) error {
+	path, err := r.resolve(name, false)
+	if err != nil {
+		return err
+	}
+	if path == r.dir {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.RemoveAll(path)
+}
+
+// Find is Find within the root. The returned names are relative to the
+// root. Symlinks are not followed, whatever opts.FollowSymlinks says.
+func (r *Root) Find(dir string, opts *FindOptions) ([]string, error) {
+	path, err := r.Path(dir)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil && opts.FollowSymlinks {
+		copied := *opts
+		copied.FollowSymlinks = false
+		opts = &copied
+	}
+	files, err := Find(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i, file := range files {
+		if files[i], err = r.Rel(file); err != nil {
+			return nil, fmt.Errorf("find %s: %w", dir, err)
+		}
+	}
+	return files, nil
+}
+
+// FindFilesWithExt is FindFilesWithExt within the root. The returned names
+// are relative to the root.
+func (r *Root) FindFilesWithExt(dir, ext string) ([]string, error) {
+	return r.Find(dir, &FindOptions{Exts: []string{ext}})
+}
@@ -0,0 +1,155 @@
+package iutils
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRootPath(t *testing.T) {
+	base := t.TempDir()
+	outside := t.TempDir()
+	dir := filepath.Join(base, "data")
+	writeTestTree(t, dir, map[string]string{"sub/a.txt": "a"})
+	writeTestTree(t, outside, map[string]string{"secret": "s"})
+
+	links := map[string]string{
+		"in":        "sub",
+		"in-abs":    filepath.Join(dir, "sub"),
+		"out":       outside,
+		"up":        "..",
+		"sub/back":  "../sub/a.txt",
+		"sub/climb": "../../data/sub",
+		"loop":      "loop",
+		"sub/dotup": "../up/data",
+		"hidden":    "missing/../out",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	r, err := OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved := r.Dir()
+
+	tests := []struct {
+		name string
+		want string // relative to the root, "" for an error
+		err  error
+	}{
+		{name: "sub/a.txt", want: "sub/a.txt"},
+		{name: "./sub//a.txt", want: "sub/a.txt"},
+		{name: "sub/../sub/a.txt", want: "sub/a.txt"},
+		{name: ".", want: "."},
+		{name: "new/dir/file", want: "new/dir/file"},
+		{name: "in/a.txt", want: "sub/a.txt"},
+		{name: "in-abs/a.txt", want: "sub/a.txt"},
+		{name: "sub/back", want: "sub/a.txt"},
+		{name: "../data/sub", err: ErrPathEscapes},
+		{name: "/etc/passwd", err: ErrPathEscapes},
+		{name: "out/secret", err: ErrPathEscapes},
+		{name: "out", err: ErrPathEscapes},
+		{name: "up/data", err: ErrPathEscapes},
+		{name: "sub/climb", err: ErrPathEscapes},
+		// Lexically ../up/data is inside the root, but up leaves it.
+		{name: "sub/dotup", err: ErrPathEscapes},
+		// ".." below a missing directory fails instead of collapsing onto
+		// out, which is never checked.
+		{name: "hidden/secret", err: fs.ErrNotExist},
+		{name: "hidden", err: fs.ErrNotExist},
+		{name: "nul\x00", err: os.ErrInvalid},
+	}
+	for _, tt := range tests {
+		got, err := r.Path(tt.name)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Path(%q) = %q, %v, want error %v", tt.name, got, err, tt.err)
+			}
+			continue
+		}
+		if want := filepath.Join(resolved, filepath.FromSlash(tt.want)); err != nil || got != want {
+			t.Errorf("Path(%q) = %q, %v, want %q", tt.name, got, err, want)
+		}
+	}
+	if _, err := r.ReadFile("hidden/secret"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadFile() through a missing directory error = %v, want %v", err, fs.ErrNotExist)
+	}
+	if _, err := r.Path("loop/x"); err == nil {
+		t.Errorf("Path() through a symlink loop succeeded, want an error")
+	}
+
+	if got, err := SafeJoin(dir, "sub/a.txt"); err != nil || got != filepath.Join(resolved, "sub", "a.txt") {
+		t.Errorf("SafeJoin() = %q, %v", got, err)
+	}
+	if _, err := SafeJoin(dir, "../x"); !errors.Is(err, ErrPathEscapes) {
+		t.Errorf("SafeJoin() escaping error = %v, want %v", err, ErrPathEscapes)
+	}
+}
+
+func TestRootFileHelpers(t *testing.T) {
+	r, err := OpenRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.WriteFile2("logs/a.log", []byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WriteFileParts("logs/a.log", 6, []byte("there")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WriteFile3("logs/b.log", []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.MkdirAll("conf", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WriteJson("conf/c.json", map[string]int{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := r.ReadFile("logs/a.log"); err != nil || string(data) != "hello there" {
+		t.Errorf("ReadFile() = %q, %v", data, err)
+	}
+	if data, err := r.ReadFileParts("logs/a.log", 6, 3); err != nil || string(data) != "the" {
+		t.Errorf("ReadFileParts() = %q, %v", data, err)
+	}
+	if size, err := r.GetFileSize("logs/a.log"); err != nil || size != 11 {
+		t.Errorf("GetFileSize() = %d, %v", size, err)
+	}
+	if !r.FileExists("logs/b.log") || !r.DirExists("conf") || r.FileExists("../x") {
+		t.Errorf("FileExists/DirExists disagree with the tree")
+	}
+
+	files, err := r.FindFilesWithExt(".", ".log")
+	want := []string{filepath.Join("logs", "a.log"), filepath.Join("logs", "b.log")}
+	if err != nil || !reflect.DeepEqual(files, want) {
+		t.Errorf("FindFilesWithExt() = %v, %v, want %v", files, err, want)
+	}
+
+	sub, err := r.Sub("logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sub.ReadFile("../conf/c.json"); !errors.Is(err, ErrPathEscapes) {
+		t.Errorf("Sub().ReadFile() escaping error = %v, want %v", err, ErrPathEscapes)
+	}
+
+	for _, name := range []string{"../escape", "/abs"} {
+		if err := r.WriteFile2(name, nil); !errors.Is(err, ErrPathEscapes) {
+			t.Errorf("WriteFile2(%q) error = %v, want %v", name, err, ErrPathEscapes)
+		}
+	}
+	if err := r.RemoveAll("."); err == nil {
+		t.Errorf("RemoveAll(\".\") succeeded, want an error")
+	}
+	if err := r.RemoveAll("logs"); err != nil || r.DirExists("logs") {
+		t.Errorf("RemoveAll() = %v, logs exists = %v", err, r.DirExists("logs"))
+	}
+}
@@ -0,0 +1,385 @@
+package iutils
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRotatingWriterClosed is returned by writes to a closed RotatingWriter.
+var ErrRotatingWriterClosed = errors.New("iutils: rotating writer closed")
+
+// rotateTimeFormat names backups; it sorts in time order.
+const rotateTimeFormat = "20060102T150405.000"
+
+// RotateOptions configures OpenRotatingWriter. A nil *RotateOptions never
+// rotates on its own and keeps all backups.
+type RotateOptions struct {
+	// MaxSize rotates before a write would grow the file beyond this many
+	// bytes. A single larger write goes to a fresh file of its own.
+	MaxSize int64
+	// Interval rotates the first write after an interval boundary, e.g.
+	// every hour with time.Hour. Boundaries are multiples of Interval
+	// since the zero time, in UTC.
+	Interval time.Duration
+
+	// MaxBackups is the number of backups kept, all if zero.
+	MaxBackups int
+	// MaxAge removes backups rotated longer ago than this, none if zero.
+	MaxAge time.Duration
+	// Compress gzips backups in the background.
+	Compress bool
+
+	// Perm is the mode of new files, 0644 if zero.
+	Perm fs.FileMode
+	// MkdirAll creates missing parent directories.
+	MkdirAll bool
+}
+
+// RotatingWriter appends to a file and moves it aside as a backup named
+// after the rotation time, such as app-20240102T150405.000.log for
+// app.log. It is safe for concurrent use; each Write goes to a single file
+// in one piece.
+type RotatingWriter struct {
+	filename string
+	opts     RotateOptions
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	next   time.Time // next interval boundary
+	closed bool
+	// The name of the last backup; a counter is never reused within a
+	// millisecond, even after the backup was pruned.
+	lastStamp string
+	lastSeq   int
+
+	// Backups are compressed and pruned by a background goroutine, woken
+	// by mill after each rotation.
+	mill    chan struct{}
+	done    chan struct{}
+	millMu  sync.Mutex
+	millErr error
+}
+
+// OpenRotatingWriter opens filename for appending, creating it if needed.
+// An existing file is continued; it is rotated by the first write if it is
+// too large or was last written before the current interval.
+func OpenRotatingWriter(filename string, opts *RotateOptions) (*RotatingWriter, error) {
+	w := &RotatingWriter{
+		filename: filename,
+		mill:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	if opts != nil {
+		w.opts = *opts
+	}
+	if w.opts.Perm == 0 {
+		w.opts.Perm = 0644
+	}
+	if w.opts.MkdirAll {
+		if err := mkdirParent(filename, 0755); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	if info, err := w.file.Stat(); err == nil && info.Size() > 0 {
+		w.next = w.boundary(info.ModTime())
+	}
+
+	go w.millLoop()
+	// Apply the retention to backups left by earlier runs.
+	w.mill <- struct{}{}
+	return w, nil
+}
+
+func (w *RotatingWriter) open() error {
+	file, err := os.OpenFile(w.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, w.opts.Perm)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file, w.size = file, info.Size()
+	w.next = w.boundary(time.Now())
+	return nil
+}
+
+// boundary returns the first interval boundary after t.
+func (w *RotatingWriter) boundary(t time.Time) time.Time {
+	if w.opts.Interval <= 0 {
+		return time.Time{}
+	}
+	return t.UTC().Truncate(w.opts.Interval).Add(w.opts.Interval)
+}
+
+// Write appends p to the current file, rotating first if needed.
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrRotatingWriterClosed
+	}
+
+	due := !w.next.IsZero() && !time.Now().Before(w.next)
+	if w.opts.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.opts.MaxSize {
+		due = true
+	}
+	if due {
+		if err := w.rotateLocked(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate moves the current file aside and starts a new one.
+func (w *RotatingWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrRotatingWriterClosed
+	}
+	return w.rotateLocked()
+}
+
+func (w *RotatingWriter) rotateLocked() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	backup, err := w.backupName(time.Now())
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(w.filename, backup); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		// Keep writing to the old file rather than losing data.
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	select {
+	case w.mill <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// backupName returns an unused backup name for a rotation at t.
+func (w *RotatingWriter) backupName(t time.Time) (string, error) {
+	dir, prefix, ext := w.backupParts()
+	stamp := prefix + t.UTC().Format(rotateTimeFormat)
+	i := 0
+	if stamp == w.lastStamp {
+		i = w.lastSeq + 1
+	}
+	for ; ; i++ {
+		name := stamp
+		if i > 0 {
+			name += "-" + strconv.Itoa(i)
+		}
+		name = filepath.Join(dir, name+ext)
+		if _, err := os.Lstat(name); errors.Is(err, fs.ErrNotExist) {
+			if _, err := os.Lstat(name + ".gz"); errors.Is(err, fs.ErrNotExist) {
+				w.lastStamp, w.lastSeq = stamp, i
+				return name, nil
+			}
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// backupParts splits the file name into the parts around the backup time.
+func (w *RotatingWriter) backupParts() (dir, prefix, ext string) {
+	dir, base := filepath.Split(w.filename)
+	ext = filepath.Ext(base)
+	return dir, strings.TrimSuffix(base, ext) + "-", ext
+}
+
+type rotateBackup struct {
+	path string
+	time time.Time
+	seq  int // collision counter of backups rotated in the same millisecond
+}
+
+// Backups returns the backups of the file, newest first.
+func (w *RotatingWriter) Backups() ([]string, error) {
+	backups, err := w.backups()
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(backups))
+	for i, b := range backups {
+		paths[i] = b.path
+	}
+	return paths, nil
+}
+
+func (w *RotatingWriter) backups() ([]rotateBackup, error) {
+	dir, prefix, ext := w.backupParts()
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []rotateBackup
+	for _, entry := range entries {
+		name := entry.Name()
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok || entry.IsDir() || len(rest) < len(rotateTimeFormat) {
+			continue
+		}
+		t, err := time.Parse(rotateTimeFormat, rest[:len(rotateTimeFormat)])
+		if err != nil {
+			continue
+		}
+		seq := 0
+		suffix := strings.TrimSuffix(rest[len(rotateTimeFormat):], ".gz")
+		if suffix != ext {
+			// A collision counter, e.g. "-1.log", is all that may remain.
+			counter, ok := strings.CutSuffix(suffix, ext)
+			if !ok || !strings.HasPrefix(counter, "-") {
+				continue
+			}
+			if seq, err = strconv.Atoi(counter[1:]); err != nil || seq <= 0 {
+				continue
+			}
+		}
+		backups = append(backups, rotateBackup{path: filepath.Join(dir, name), time: t, seq: seq})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].time.Equal(backups[j].time) {
+			return backups[i].time.After(backups[j].time)
+		}
+		return backups[i].seq > backups[j].seq
+	})
+	return backups, nil
+}
+
+func (w *RotatingWriter) millLoop() {
+	defer close(w.done)
+	for range w.mill {
+		if err := w.millOnce(); err != nil {
+			w.millMu.Lock()
+			if w.millErr == nil {
+				w.millErr = err
+			}
+			w.millMu.Unlock()
+		}
+	}
+}
+
+// millOnce prunes old backups and compresses the remaining ones.
+func (w *RotatingWriter) millOnce() error {
+	backups, err := w.backups()
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	keep := backups[:0]
+	for i, b := range backups {
+		expired := w.opts.MaxAge > 0 && time.Since(b.time) > w.opts.MaxAge
+		if (w.opts.MaxBackups > 0 && i >= w.opts.MaxBackups) || expired {
+			if err := os.Remove(b.path); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		keep = append(keep, b)
+	}
+
+	if w.opts.Compress {
+		for _, b := range keep {
+			if strings.HasSuffix(b.path, ".gz") {
+				continue
+			}
+			if err := gzipBackup(b.path); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// gzipBackup replaces path with path.gz.
+func gzipBackup(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	cf, err := CreateCompressedFile(path+".gz", &AtomicOptions{Perm: info.Mode().Perm()})
+	if err != nil {
+		return err
+	}
+	defer cf.Close()
+	if _, err := io.Copy(cf, src); err != nil {
+		return err
+	}
+	if err := cf.Commit(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Sync flushes the current file to stable storage.
+func (w *RotatingWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrRotatingWriterClosed
+	}
+	return w.file.Sync()
+}
+
+// Close closes the current file and waits for background compression. It
+// returns the first error of the background work, if any.
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrRotatingWriterClosed
+	}
+	w.closed = true
+	err := w.file.Close()
+	close(w.mill)
+	w.mu.Unlock()
+
+	<-w.done
+	w.millMu.Lock()
+	defer w.millMu.Unlock()
+	if err == nil {
+		err = w.millErr
+	}
+	return err
+}
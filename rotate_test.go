@@ -0,0 +1,217 @@
+package iutils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readRotated returns the content of filename and its backups, oldest
+// first, decompressing gzipped backups.
+func readRotated(t *testing.T, w *RotatingWriter, filename string) []string {
+	t.Helper()
+	backups, err := w.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents []string
+	for i := len(backups) - 1; i >= 0; i-- {
+		data, err := ReadCompressedFile(backups[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, string(data))
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(contents, string(data))
+}
+
+func TestRotatingWriterSize(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "logs", "app.log")
+	w, err := OpenRotatingWriter(filename, &RotateOptions{MaxSize: 10, MkdirAll: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"aaaa\n", "bbbb\n", "cccc\n", "a line longer than the limit\n", "dd\n"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatalf("Write(%q) error = %v", s, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := w.Write([]byte("x")); !errors.Is(err, ErrRotatingWriterClosed) {
+		t.Errorf("Write() after Close error = %v, want %v", err, ErrRotatingWriterClosed)
+	}
+
+	got := readRotated(t, w, filename)
+	want := []string{"aaaa\nbbbb\n", "cccc\n", "a line longer than the limit\n", "dd\n"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("contents = %q, want %q", got, want)
+	}
+	backups, _ := w.Backups()
+	for _, b := range backups {
+		if !strings.HasPrefix(filepath.Base(b), "app-") || !strings.HasSuffix(b, ".log") {
+			t.Errorf("backup name %s, want app-<time>[-n].log", b)
+		}
+	}
+}
+
+func TestRotatingWriterRetention(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+
+	// A backup of an earlier run that is past MaxAge.
+	old := filepath.Join(dir, "app-"+time.Now().Add(-48*time.Hour).UTC().Format(rotateTimeFormat)+".log")
+	if err := os.WriteFile(old, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	unrelated := filepath.Join(dir, "app-notes.log")
+	if err := os.WriteFile(unrelated, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := OpenRotatingWriter(filename, &RotateOptions{MaxBackups: 2, MaxAge: 24 * time.Hour, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		fmt.Fprintf(w, "record %d\n", i)
+		if err := w.Rotate(); err != nil {
+			t.Fatalf("Rotate() error = %v", err)
+		}
+	}
+	fmt.Fprintf(w, "record 4\n")
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	got := readRotated(t, w, filename)
+	want := []string{"record 2\n", "record 3\n", "record 4\n"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("contents = %q, want %q", got, want)
+	}
+	backups, _ := w.Backups()
+	for _, b := range backups {
+		if !strings.HasSuffix(b, ".log.gz") {
+			t.Errorf("backup %s is not compressed", b)
+		}
+	}
+	if FileExists(old) {
+		t.Errorf("expired backup %s was kept", old)
+	}
+	if !FileExists(unrelated) {
+		t.Errorf("unrelated file %s was removed", unrelated)
+	}
+}
+
+func TestRotatingWriterInterval(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "dump")
+	if err := os.WriteFile(filename, []byte("yesterday\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-25 * time.Hour)
+	os.Chtimes(filename, past, past)
+
+	w, err := OpenRotatingWriter(filename, &RotateOptions{Interval: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The existing file belongs to an earlier interval.
+	w.Write([]byte("today\n"))
+	w.Write([]byte("again\n"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readRotated(t, w, filename)
+	want := []string{"yesterday\n", "today\nagain\n"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("contents = %q, want %q", got, want)
+	}
+}
+
+func TestRotatingWriterBackupName(t *testing.T) {
+	dir := t.TempDir()
+	w := &RotatingWriter{filename: filepath.Join(dir, "app.log")}
+	now := time.Now()
+	stamp := filepath.Join(dir, "app-"+now.UTC().Format(rotateTimeFormat))
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		name, err := w.backupName(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(name, nil, 0644)
+		names = append(names, name)
+	}
+	// Pruning the oldest backup must not free its name for the next one,
+	// which would then sort as the oldest.
+	os.Remove(names[0])
+	name, err := w.backupName(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{stamp + ".log", stamp + "-1.log", stamp + "-2.log", stamp + "-3.log"}
+	if got := append(names, name); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("backup names = %q, want %q", got, want)
+	}
+}
+
+func TestRotatingWriterConcurrent(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w, err := OpenRotatingWriter(filename, &RotateOptions{MaxSize: 256, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, lines = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				if _, err := fmt.Fprintf(w, "worker %d line %d\n", i, j); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var all []string
+	for _, content := range readRotated(t, w, filename) {
+		if len(content) > 256 {
+			t.Errorf("file of %d bytes exceeds MaxSize", len(content))
+		}
+		for _, line := range bytes.Split([]byte(content), []byte("\n")) {
+			if len(line) > 0 {
+				all = append(all, string(line))
+			}
+		}
+	}
+	if len(all) != workers*lines {
+		t.Fatalf("got %d lines, want %d", len(all), workers*lines)
+	}
+	sort.Strings(all)
+	for i := 1; i < len(all); i++ {
+		if all[i] == all[i-1] {
+			t.Errorf("duplicate line %q", all[i])
+		}
+	}
+}
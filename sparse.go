@@ -0,0 +1,271 @@
+package iutils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// ErrPartOutOfRange is returned by PartWriter for writes beyond the size
+// of the file.
+var ErrPartOutOfRange = errors.New("iutils: part out of range")
+
+// Preallocate reserves disk space for the first size bytes of file and
+// extends it to at least size, so that running out of space shows up
+// before the data is written. It uses fallocate where available and
+// otherwise writes zeros over the range beyond the current end of file.
+// A file already larger than size is not shrunk.
+func Preallocate(file *os.File, size int64) error {
+	if size < 0 {
+		return fmt.Errorf("iutils: negative size %d", size)
+	}
+	if size == 0 {
+		return nil
+	}
+	err := fallocate(file, size)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, errors.ErrUnsupported) {
+		return &os.PathError{Op: "fallocate", Path: file.Name(), Err: err}
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() >= size {
+		return nil
+	}
+	zeros := make([]byte, min(size-info.Size(), 1<<20))
+	for off := info.Size(); off < size; {
+		n, err := file.WriteAt(zeros[:min(size-off, int64(len(zeros)))], off)
+		if err != nil {
+			return err
+		}
+		off += int64(n)
+	}
+	return nil
+}
+
+// PreallocateFile creates filename if needed and preallocates it to size.
+func PreallocateFile(filename string, size int64) error {
+	if err := mkdirParent(filename, 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := Preallocate(file, size); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// CreateSparseFile creates filename with the given size and no data
+// allocated, on filesystems that support sparse files. An existing file
+// is truncated first.
+func CreateSparseFile(filename string, size int64) error {
+	if err := mkdirParent(filename, 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Truncate(size)
+}
+
+// Extent is a range of bytes in a file.
+type Extent struct {
+	Offset int64
+	Length int64
+}
+
+// End returns the offset just after the extent.
+func (e Extent) End() int64 {
+	return e.Offset + e.Length
+}
+
+// DataExtents returns the ranges of file that hold data, in order, using
+// SEEK_DATA and SEEK_HOLE. Where these are not supported the whole file is
+// reported as data. Filesystems track holes in blocks, so a range of
+// written zeros may be reported as data and extents are block aligned.
+func DataExtents(file *os.File) ([]Extent, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, nil
+	}
+	whole := []Extent{{Offset: 0, Length: size}}
+	if seekData < 0 {
+		return whole, nil
+	}
+
+	// Seeking moves the file offset, which other code may rely on.
+	pos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Seek(pos, io.SeekStart)
+
+	var extents []Extent
+	for off := int64(0); off < size; {
+		start, err := file.Seek(off, seekData)
+		if isNoMoreData(err) {
+			break
+		}
+		if err != nil {
+			if len(extents) == 0 && isSeekUnsupported(err) {
+				return whole, nil
+			}
+			return nil, err
+		}
+		end, err := file.Seek(start, seekHole)
+		if err != nil {
+			return nil, err
+		}
+		end = min(end, size)
+		extents = append(extents, Extent{Offset: start, Length: end - start})
+		off = end
+	}
+	return extents, nil
+}
+
+// Holes returns the ranges of file that are not allocated, the complement
+// of DataExtents.
+func Holes(file *os.File) ([]Extent, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := DataExtents(file)
+	if err != nil {
+		return nil, err
+	}
+	var holes []Extent
+	off := int64(0)
+	for _, e := range data {
+		if e.Offset > off {
+			holes = append(holes, Extent{Offset: off, Length: e.Offset - off})
+		}
+		off = e.End()
+	}
+	if off < info.Size() {
+		holes = append(holes, Extent{Offset: off, Length: info.Size() - off})
+	}
+	return holes, nil
+}
+
+// PartWriterOptions configures OpenPartWriter. A nil *PartWriterOptions
+// creates a sparse file with permission 0644.
+type PartWriterOptions struct {
+	// Preallocate reserves the space of the whole file up front instead of
+	// creating it sparse.
+	Preallocate bool
+	// Perm is the permission of a created file, 0644 if zero.
+	Perm os.FileMode
+	// MkdirAll creates missing parent directories.
+	MkdirAll bool
+}
+
+// PartWriter writes the parts of a file of known size at their offsets,
+// as in a segmented download. Its methods may be called concurrently:
+// writes use pwrite and never move a shared file offset.
+type PartWriter struct {
+	file    *os.File
+	size    int64
+	written atomic.Int64
+}
+
+// OpenPartWriter opens filename for writing parts of a file of the given
+// size. The file is set to that size right away, so the parts can be
+// written in any order.
+func OpenPartWriter(filename string, size int64, opts *PartWriterOptions) (*PartWriter, error) {
+	if opts == nil {
+		opts = &PartWriterOptions{}
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("iutils: negative size %d", size)
+	}
+	perm := opts.Perm
+	if perm == 0 {
+		perm = 0644
+	}
+	if opts.MkdirAll {
+		if err := mkdirParent(filename, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, perm)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Preallocate {
+		err = Preallocate(file, size)
+	}
+	if err == nil {
+		err = file.Truncate(size)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &PartWriter{file: file, size: size}, nil
+}
+
+// Name returns the name of the file.
+func (w *PartWriter) Name() string {
+	return w.file.Name()
+}
+
+// Size returns the size of the file.
+func (w *PartWriter) Size() int64 {
+	return w.size
+}
+
+// WriteAt writes p at offset off. It fails with ErrPartOutOfRange if the
+// part does not fit in the file.
+func (w *PartWriter) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > w.size {
+		return 0, fmt.Errorf("%w: %d bytes at offset %d of %d", ErrPartOutOfRange, len(p), off, w.size)
+	}
+	n, err := w.file.WriteAt(p, off)
+	w.written.Add(int64(n))
+	return n, err
+}
+
+// WritePart writes a whole part, like WriteFileParts.
+func (w *PartWriter) WritePart(off int64, data []byte) error {
+	_, err := w.WriteAt(data, off)
+	return err
+}
+
+// Written returns the number of bytes written so far. Parts written twice
+// are counted twice.
+func (w *PartWriter) Written() int64 {
+	return w.written.Load()
+}
+
+// Sync commits the file to stable storage.
+func (w *PartWriter) Sync() error {
+	return w.file.Sync()
+}
+
+// Close syncs and closes the file.
+func (w *PartWriter) Close() error {
+	err := w.file.Sync()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+package iutils
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Whence values of lseek for finding data and holes.
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// fallocate allocates the first size bytes of file, extending it if
+// needed.
+func fallocate(file *os.File, size int64) error {
+	err := syscall.Fallocate(int(file.Fd()), 0, 0, size)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return errors.ErrUnsupported
+	}
+	return err
+}
+
+// isNoMoreData reports whether a SEEK_DATA failed because no data follows
+// the offset.
+func isNoMoreData(err error) bool {
+	return errors.Is(err, syscall.ENXIO)
+}
+
+// isSeekUnsupported reports whether the filesystem does not support
+// SEEK_DATA.
+func isSeekUnsupported(err error) bool {
+	return errors.Is(err, syscall.EINVAL)
+}
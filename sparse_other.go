@@ -0,0 +1,27 @@
+//go:build !linux
+
+package iutils
+
+import (
+	"errors"
+	"os"
+)
+
+// SEEK_DATA and SEEK_HOLE are not used on this platform.
+const (
+	seekData = -1
+	seekHole = -1
+)
+
+// fallocate is not supported on this platform.
+func fallocate(file *os.File, size int64) error {
+	return errors.ErrUnsupported
+}
+
+func isNoMoreData(err error) bool {
+	return false
+}
+
+func isSeekUnsupported(err error) bool {
+	return false
+}
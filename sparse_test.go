@@ -0,0 +1,138 @@
+package iutils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func allocatedSize(t *testing.T, filename string) int64 {
+	t.Helper()
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocated, _, ok := fileAllocation(info)
+	if !ok {
+		t.Skip("allocation not reported on this platform")
+	}
+	return allocated
+}
+
+func TestPreallocateFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "sub", "big")
+	if err := PreallocateFile(filename, 4<<20); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := GetFileSize(filename); size != 4<<20 {
+		t.Errorf("size = %d, want %d", size, 4<<20)
+	}
+	if allocated := allocatedSize(t, filename); allocated < 4<<20 {
+		t.Errorf("allocated = %d, want at least %d", allocated, 4<<20)
+	}
+
+	// A larger file is not shrunk.
+	if err := PreallocateFile(filename, 1024); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := GetFileSize(filename); size != 4<<20 {
+		t.Errorf("size after smaller Preallocate = %d", size)
+	}
+}
+
+func TestSparseExtents(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "sparse")
+	if err := CreateSparseFile(filename, 8<<20); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := GetFileSize(filename); size != 8<<20 {
+		t.Fatalf("size = %d, want %d", size, 8<<20)
+	}
+	if allocatedSize(t, filename) >= 8<<20 {
+		t.Skip("filesystem does not support sparse files")
+	}
+	if err := WriteFileParts(filename, 2<<20, bytes.Repeat([]byte{1}, 4096)); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	file.Seek(123, io.SeekStart)
+
+	data, err := DataExtents(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "linux" {
+		if len(data) != 1 || data[0].Length != 8<<20 {
+			t.Errorf("DataExtents() = %v, want the whole file", data)
+		}
+		return
+	}
+	if len(data) != 1 || data[0].Offset > 2<<20 || data[0].End() < 2<<20+4096 || data[0].Length > 1<<20 {
+		t.Errorf("DataExtents() = %v, want one extent around offset %d", data, 2<<20)
+	}
+	holes, err := Holes(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holes) != 2 || holes[0].Offset != 0 || holes[0].End() != data[0].Offset || holes[1].End() != 8<<20 {
+		t.Errorf("Holes() = %v, want the complement of %v", holes, data)
+	}
+	if pos, _ := file.Seek(0, io.SeekCurrent); pos != 123 {
+		t.Errorf("file offset = %d after DataExtents, want 123", pos)
+	}
+}
+
+func TestPartWriter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "dir", "download")
+	const partSize, parts = 64 << 10, 16
+	if _, err := OpenPartWriter(filename, partSize*parts, nil); err == nil {
+		t.Errorf("OpenPartWriter() without MkdirAll succeeded")
+	}
+
+	for _, preallocate := range []bool{false, true} {
+		w, err := OpenPartWriter(filename, partSize*parts, &PartWriterOptions{Preallocate: preallocate, MkdirAll: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for i := parts - 1; i >= 0; i-- {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := w.WritePart(int64(i*partSize), bytes.Repeat([]byte{byte(i)}, partSize)); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		if w.Written() != partSize*parts {
+			t.Errorf("Written() = %d, want %d", w.Written(), partSize*parts)
+		}
+		if err := w.WritePart(partSize*parts-1, []byte("ab")); !errors.Is(err, ErrPartOutOfRange) {
+			t.Errorf("WritePart() past the end error = %v, want %v", err, ErrPartOutOfRange)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < parts; i++ {
+			if !bytes.Equal(data[i*partSize:(i+1)*partSize], bytes.Repeat([]byte{byte(i)}, partSize)) {
+				t.Errorf("preallocate=%v: part %d has wrong content", preallocate, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package iutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SyncCompare selects how SyncDir decides that a file has changed.
+type SyncCompare int
+
+const (
+	// CompareSizeModTime treats files with equal size and modification
+	// time as unchanged.
+	CompareSizeModTime SyncCompare = iota
+	// CompareChecksum compares the SHA-256 of files with equal size.
+	CompareChecksum
+)
+
+// SyncOp is the kind of a SyncAction.
+type SyncOp int
+
+const (
+	SyncMkdir SyncOp = iota
+	SyncCopy
+	SyncUpdate
+	SyncDelete
+)
+
+func (op SyncOp) String() string {
+	switch op {
+	case SyncMkdir:
+		return "mkdir"
+	case SyncCopy:
+		return "copy"
+	case SyncUpdate:
+		return "update"
+	case SyncDelete:
+		return "delete"
+	}
+	return fmt.Sprintf("SyncOp(%d)", int(op))
+}
+
+// SyncAction is one step of a synchronization. Path is slash separated and
+// relative to both trees.
+type SyncAction struct {
+	Op   SyncOp
+	Path string
+	Size int64
+}
+
+// SyncOptions configures SyncDir.
+type SyncOptions struct {
+	Compare SyncCompare
+	// Delete removes files and directories of dst that are not in src.
+	Delete bool
+	// DryRun only computes the actions without touching dst.
+	DryRun bool
+	// Filter, if set, selects the entries of both trees that take part in
+	// the synchronization. Directories it rejects are not descended into.
+	Filter func(path string, d fs.DirEntry) bool
+	// Progress, if set, is called after each action has been applied.
+	Progress func(action SyncAction, done, total int)
+}
+
+// SyncDir makes the tree dst match src. New and changed files are copied
+// atomically with their mode and modification time, so a later run with
+// CompareSizeModTime sees them as unchanged. Only directories and regular
+// files are synchronized; symlinks and other special files of src are
+// skipped, and those of dst are replaced where src has an entry, never
+// followed. It returns the planned actions; with DryRun nothing else
+// happens.
+func SyncDir(src, dst string, opts *SyncOptions) ([]SyncAction, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if !srcInfo.IsDir() {
+		return nil, &fs.PathError{Op: "sync", Path: src, Err: errors.New("not a directory")}
+	}
+	if inside, err := isSubPath(src, dst); err != nil {
+		return nil, err
+	} else if inside {
+		return nil, fmt.Errorf("sync %s: destination %s is inside the source", src, dst)
+	}
+
+	actions, err := planSync(src, dst, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return actions, nil
+	}
+
+	// Directories are kept writable while files are copied into them and
+	// get their modes at the end, so read-only trees can be synchronized.
+	modes := make(map[string]fs.FileMode)
+	defer func() {
+		for dir, perm := range modes {
+			os.Chmod(dir, perm)
+		}
+	}()
+	mkdir := func(dir string, perm fs.FileMode) error {
+		if err := os.MkdirAll(dir, perm|0700); err != nil {
+			return err
+		}
+		if perm&0700 != 0700 {
+			modes[dir] = perm
+		}
+		return nil
+	}
+	makeWritable := func(dir string) error {
+		if _, ok := modes[dir]; ok {
+			return nil
+		}
+		info, err := os.Lstat(dir)
+		if err != nil || !info.IsDir() || info.Mode().Perm()&0700 == 0700 {
+			return err
+		}
+		modes[dir] = info.Mode().Perm()
+		return os.Chmod(dir, info.Mode().Perm()|0700)
+	}
+
+	if err := mkdir(dst, srcInfo.Mode().Perm()); err != nil {
+		return nil, err
+	}
+	copyOpts := &CopyOptions{PreserveMode: true, PreserveTimes: true}
+	for i, action := range actions {
+		srcPath := filepath.Join(src, filepath.FromSlash(action.Path))
+		dstPath := filepath.Join(dst, filepath.FromSlash(action.Path))
+
+		switch action.Op {
+		case SyncMkdir:
+			var info fs.FileInfo
+			if info, err = os.Stat(srcPath); err == nil {
+				err = mkdir(dstPath, info.Mode().Perm())
+			}
+		case SyncCopy, SyncUpdate:
+			if err = makeWritable(filepath.Dir(dstPath)); err == nil {
+				err = CopyFile(srcPath, dstPath, copyOpts)
+			}
+		case SyncDelete:
+			if err = makeWritable(filepath.Dir(dstPath)); err == nil {
+				err = os.RemoveAll(dstPath)
+			}
+		}
+		if err != nil {
+			return actions, fmt.Errorf("sync %s %s: %w", action.Op, action.Path, err)
+		}
+		if opts.Progress != nil {
+			opts.Progress(action, i+1, len(actions))
+		}
+	}
+	return actions, nil
+}
+
+type syncEntry struct {
+	info fs.FileInfo
+}
+
+// scanSyncTree returns the directories and regular files below root keyed by
+// their slash separated relative path. A missing root is an empty tree.
+// With special set, symlinks and other special files are returned too.
+func scanSyncTree(root string, filter func(string, fs.DirEntry) bool, special bool) (map[string]syncEntry, error) {
+	entries := make(map[string]syncEntry)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if filter != nil && !filter(rel, d) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !special && !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries[rel] = syncEntry{info: info}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func planSync(src, dst string, opts *SyncOptions) ([]SyncAction, error) {
+	srcEntries, err := scanSyncTree(src, opts.Filter, false)
+	if err != nil {
+		return nil, err
+	}
+	// Special files of dst are needed so that a symlink in place of an
+	// entry of src is removed rather than written through.
+	dstEntries, err := scanSyncTree(dst, opts.Filter, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts, mkdirs, copies, deletes []SyncAction
+
+	for rel, s := range srcEntries {
+		d, exists := dstEntries[rel]
+		if exists && s.info.Mode().Type() != d.info.Mode().Type() {
+			// A file replaced by a directory or the other way round, or a
+			// symlink or special file in the way.
+			conflicts = append(conflicts, SyncAction{Op: SyncDelete, Path: rel})
+			exists = false
+		}
+
+		switch {
+		case s.info.IsDir():
+			if !exists {
+				mkdirs = append(mkdirs, SyncAction{Op: SyncMkdir, Path: rel})
+			}
+		case !exists:
+			copies = append(copies, SyncAction{Op: SyncCopy, Path: rel, Size: s.info.Size()})
+		default:
+			changed, err := syncFileChanged(src, dst, rel, s.info, d.info, opts.Compare)
+			if err != nil {
+				return nil, err
+			}
+			if changed {
+				copies = append(copies, SyncAction{Op: SyncUpdate, Path: rel, Size: s.info.Size()})
+			}
+		}
+	}
+
+	if opts.Delete {
+		for rel := range dstEntries {
+			if _, ok := srcEntries[rel]; ok {
+				continue
+			}
+			// Removing a directory removes its content too.
+			if !hasSyncAncestor(srcEntries, rel) {
+				continue
+			}
+			action := SyncAction{Op: SyncDelete, Path: rel}
+			if info := dstEntries[rel].info; info.Mode().IsRegular() {
+				action.Size = info.Size()
+			}
+			deletes = append(deletes, action)
+		}
+	}
+
+	sortSyncActions(conflicts)
+	sortSyncActions(mkdirs)
+	sortSyncActions(copies)
+	sortSyncActions(deletes)
+
+	actions := append(conflicts, mkdirs...)
+	actions = append(actions, copies...)
+	return append(actions, deletes...), nil
+}
+
+// hasSyncAncestor reports whether the parent directory of rel exists in
+// src, i.e. rel is the top-most entry of its branch that has to go.
+func hasSyncAncestor(srcEntries map[string]syncEntry, rel string) bool {
+	parent := path.Dir(rel)
+	if parent == "." {
+		return true
+	}
+	entry, ok := srcEntries[parent]
+	return ok && entry.info.IsDir()
+}
+
+func syncFileChanged(src, dst, rel string, srcInfo, dstInfo fs.FileInfo, compare SyncCompare) (bool, error) {
+	if srcInfo.Size() != dstInfo.Size() {
+		return true, nil
+	}
+	if compare != CompareChecksum {
+		return !srcInfo.ModTime().Equal(dstInfo.ModTime()), nil
+	}
+
+	ctx := context.Background()
+	srcHash, err := HashFile(ctx, filepath.Join(src, filepath.FromSlash(rel)), HashSHA256)
+	if err != nil {
+		return false, err
+	}
+	dstHash, err := HashFile(ctx, filepath.Join(dst, filepath.FromSlash(rel)), HashSHA256)
+	if err != nil {
+		return false, err
+	}
+	return srcHash.Hex(HashSHA256) != dstHash.Hex(HashSHA256), nil
+}
+
+func sortSyncActions(actions []SyncAction) {
+	sort.Slice(actions, func(i, j int) bool {
+		return strings.Compare(actions[i].Path, actions[j].Path) < 0
+	})
+}
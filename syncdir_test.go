@@ -0,0 +1,217 @@
+package iutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSyncDirPlan(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+	dst := filepath.Join(tempDir, "dst")
+	writeTestTree(t, src, map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "b",
+		"conflict":  "now a file",
+	})
+	writeTestTree(t, dst, map[string]string{
+		"a.txt":           "A",
+		"old/x.txt":       "x",
+		"old/deep/y.txt":  "y",
+		"stale.txt":       "stale",
+		"conflict/in.txt": "was a dir",
+	})
+
+	// Same size as src/a.txt, but an older mtime.
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dst, "a.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &SyncOptions{Delete: true, DryRun: true}
+	plan, err := SyncDir(src, dst, opts)
+	if err != nil {
+		t.Fatalf("SyncDir() dry run error = %v", err)
+	}
+	want := []SyncAction{
+		{Op: SyncDelete, Path: "conflict"},
+		{Op: SyncMkdir, Path: "sub"},
+		{Op: SyncUpdate, Path: "a.txt", Size: 1},
+		{Op: SyncCopy, Path: "conflict", Size: 10},
+		{Op: SyncCopy, Path: "sub/b.txt", Size: 1},
+		{Op: SyncDelete, Path: "old"},
+		{Op: SyncDelete, Path: "stale.txt", Size: 5},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Fatalf("SyncDir() plan = %+v, want %+v", plan, want)
+	}
+	if FileExists(filepath.Join(dst, "sub", "b.txt")) {
+		t.Fatalf("SyncDir() dry run modified dst")
+	}
+
+	var progress []int
+	opts.DryRun = false
+	opts.Progress = func(action SyncAction, done, total int) {
+		progress = append(progress, done)
+	}
+	if _, err := SyncDir(src, dst, opts); err != nil {
+		t.Fatalf("SyncDir() error = %v", err)
+	}
+	if len(progress) != len(plan) || progress[len(progress)-1] != len(plan) {
+		t.Errorf("progress = %v, want %d calls", progress, len(plan))
+	}
+
+	m, err := BuildManifest(context.Background(), src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := VerifyManifest(context.Background(), dst, m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("dst differs from src after sync: %+v", report)
+	}
+
+	plan, err = SyncDir(src, dst, &SyncOptions{Delete: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 0 {
+		t.Errorf("second SyncDir() = %+v, want no actions", plan)
+	}
+}
+
+func TestSyncDirReadOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directory permissions are not enforced on Windows")
+	}
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+	dst := filepath.Join(tempDir, "dst")
+	writeTestTree(t, src, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	t.Cleanup(func() {
+		chmodDirs(src, 0755)
+		chmodDirs(dst, 0755)
+	})
+	if err := chmodDirs(src, 0555); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SyncDir(src, dst, nil); err != nil {
+		t.Fatalf("SyncDir() of a read-only tree error = %v", err)
+	}
+	for _, dir := range []string{dst, filepath.Join(dst, "sub")} {
+		if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0555 {
+			t.Errorf("mode of %s = %v, %v, want 0555", dir, info.Mode().Perm(), err)
+		}
+	}
+
+	// Updates go into the read-only copy too.
+	chmodDirs(src, 0755)
+	writeTestTree(t, src, map[string]string{"sub/b.txt": "bb"})
+	chmodDirs(src, 0555)
+	if _, err := SyncDir(src, dst, nil); err != nil {
+		t.Fatalf("SyncDir() update of a read-only tree error = %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dst, "sub", "b.txt")); string(content) != "bb" {
+		t.Errorf("sub/b.txt = %q after update", content)
+	}
+	if info, err := os.Stat(filepath.Join(dst, "sub")); err != nil || info.Mode().Perm() != 0555 {
+		t.Errorf("mode of sub after update = %v, %v, want 0555", info.Mode().Perm(), err)
+	}
+}
+
+func TestSyncDirSymlinks(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+	dst := filepath.Join(tempDir, "dst")
+	outside := filepath.Join(tempDir, "outside")
+	writeTestTree(t, src, map[string]string{"sub/f.txt": "f", "g.txt": "g"})
+	writeTestTree(t, outside, map[string]string{"g.txt": "outside"})
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range map[string]string{"sub": outside, "g.txt": filepath.Join(outside, "g.txt")} {
+		if err := os.Symlink(target, filepath.Join(dst, name)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	plan, err := SyncDir(src, dst, nil)
+	if err != nil {
+		t.Fatalf("SyncDir() error = %v", err)
+	}
+	want := []SyncAction{
+		{Op: SyncDelete, Path: "g.txt"},
+		{Op: SyncDelete, Path: "sub"},
+		{Op: SyncMkdir, Path: "sub"},
+		{Op: SyncCopy, Path: "g.txt", Size: 1},
+		{Op: SyncCopy, Path: "sub/f.txt", Size: 1},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("SyncDir() plan = %+v, want %+v", plan, want)
+	}
+	for _, name := range []string{"sub", "g.txt"} {
+		if info, err := os.Lstat(filepath.Join(dst, name)); err != nil || info.Mode()&os.ModeSymlink != 0 {
+			t.Errorf("dst/%s is still a symlink: %v", name, err)
+		}
+	}
+	if FileExists(filepath.Join(outside, "f.txt")) {
+		t.Errorf("SyncDir() wrote through the symlink")
+	}
+	if content, _ := os.ReadFile(filepath.Join(outside, "g.txt")); string(content) != "outside" {
+		t.Errorf("outside/g.txt = %q, want it untouched", content)
+	}
+}
+
+func TestSyncDirInsideSource(t *testing.T) {
+	src := t.TempDir()
+	writeTestTree(t, src, map[string]string{"a.txt": "a"})
+	if _, err := SyncDir(src, filepath.Join(src, "backup"), nil); err == nil {
+		t.Errorf("SyncDir() into its own source succeeded")
+	}
+	if FileExists(filepath.Join(src, "backup")) {
+		t.Errorf("SyncDir() created the destination inside the source")
+	}
+}
+
+func TestSyncDirChecksum(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+	dst := filepath.Join(tempDir, "dst")
+	writeTestTree(t, src, map[string]string{"same.txt": "same", "diff.txt": "abcd"})
+	writeTestTree(t, dst, map[string]string{"same.txt": "same", "diff.txt": "wxyz"})
+
+	// Identical mtimes would hide the change from CompareSizeModTime.
+	mtime := time.Now().Add(-time.Hour)
+	for _, root := range []string{src, dst} {
+		for _, name := range []string{"same.txt", "diff.txt"} {
+			if err := os.Chtimes(filepath.Join(root, name), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	plan, err := SyncDir(src, dst, &SyncOptions{DryRun: true})
+	if err != nil || len(plan) != 0 {
+		t.Errorf("SyncDir() size/mtime plan = %+v, %v; want none", plan, err)
+	}
+
+	plan, err = SyncDir(src, dst, &SyncOptions{Compare: CompareChecksum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []SyncAction{{Op: SyncUpdate, Path: "diff.txt", Size: 4}}; !reflect.DeepEqual(plan, want) {
+		t.Errorf("SyncDir() checksum plan = %+v, want %+v", plan, want)
+	}
+	content, _ := os.ReadFile(filepath.Join(dst, "diff.txt"))
+	if string(content) != "abcd" {
+		t.Errorf("diff.txt = %q after sync", content)
+	}
+}
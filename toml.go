@@ -0,0 +1,726 @@
+package iutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// This file implements the TOML subset used by Load and Save: tables,
+// arrays of tables, dotted keys, inline tables, arrays, strings, integers,
+// floats and booleans. Dates and times are kept as strings in RFC 3339
+// form, which time.Time decodes.
+
+type tomlParser struct {
+	s         string
+	i         int
+	line      int
+	lineStart int
+
+	root *orderedMap
+	cur  *orderedMap
+	// defined holds the tables opened by a [header]; tables created
+	// implicitly by a dotted name may still get their own header once.
+	defined map[*orderedMap]bool
+	// arrays holds the keys created by [[header]], per table.
+	arrays map[*orderedMap]map[string]bool
+}
+
+func parseTOML(data []byte) (interface{}, error) {
+	root := newOrderedMap()
+	p := &tomlParser{
+		s:       strings.TrimPrefix(string(data), "\ufeff"),
+		line:    1,
+		root:    root,
+		cur:     root,
+		defined: make(map[*orderedMap]bool),
+		arrays:  make(map[*orderedMap]map[string]bool),
+	}
+
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return root, nil
+		}
+
+		var err error
+		if p.s[p.i] == '[' {
+			err = p.parseHeader()
+		} else {
+			err = p.parseKeyValue(p.cur)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipBlank(false)
+		if !p.eof() && p.s[p.i] != '\n' && !strings.HasPrefix(p.s[p.i:], "\r\n") {
+			return nil, p.errorf("expected end of line, got %q", p.rest())
+		}
+	}
+}
+
+func (p *tomlParser) eof() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *tomlParser) rest() string {
+	rest := p.s[p.i:]
+	if n := strings.IndexByte(rest, '\n'); n >= 0 {
+		rest = rest[:n]
+	}
+	return strings.TrimRight(rest, "\r")
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return &DecodeError{Line: p.line, Column: p.i - p.lineStart + 1, Err: fmt.Errorf(format, args...)}
+}
+
+// next consumes one byte, keeping track of the line.
+func (p *tomlParser) next() byte {
+	c := p.s[p.i]
+	p.i++
+	if c == '\n' {
+		p.line++
+		p.lineStart = p.i
+	}
+	return c
+}
+
+// skipBlank skips spaces and comments, and line breaks if newlines is set.
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch c := p.s[p.i]; {
+		case c == ' ' || c == '\t':
+			p.next()
+		case c == '#':
+			for !p.eof() && p.s[p.i] != '\n' {
+				p.next()
+			}
+		case newlines && (c == '\n' || c == '\r'):
+			p.next()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) expect(s string) error {
+	if !strings.HasPrefix(p.s[p.i:], s) {
+		return p.errorf("expected %q", s)
+	}
+	for range s {
+		p.next()
+	}
+	return nil
+}
+
+func (p *tomlParser) parseHeader() error {
+	line, col := p.line, p.i-p.lineStart+1
+	array := strings.HasPrefix(p.s[p.i:], "[[")
+	closing := "]"
+	if array {
+		closing = "]]"
+		p.i += 2
+	} else {
+		p.i++
+	}
+
+	p.skipBlank(false)
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if err := p.expect(closing); err != nil {
+		return err
+	}
+
+	parent, err := p.walk(p.root, keys[:len(keys)-1], true, line, col)
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	existing, exists := parent.get(last)
+	parent.setPos(last, line, col)
+
+	if array {
+		if exists && !p.arrays[parent][last] {
+			return p.errorf("%q is not an array of tables", strings.Join(keys, "."))
+		}
+		table := newOrderedMap()
+		list, _ := existing.([]interface{})
+		parent.set(last, append(list, table))
+		if p.arrays[parent] == nil {
+			p.arrays[parent] = make(map[string]bool)
+		}
+		p.arrays[parent][last] = true
+		p.cur = table
+		return nil
+	}
+
+	if exists {
+		table, ok := existing.(*orderedMap)
+		if !ok || p.defined[table] {
+			return p.errorf("table %q is already defined", strings.Join(keys, "."))
+		}
+		p.defined[table] = true
+		p.cur = table
+		return nil
+	}
+	table := newOrderedMap()
+	parent.set(last, table)
+	p.defined[table] = true
+	p.cur = table
+	return nil
+}
+
+// walk follows keys from table, creating missing tables at the position
+// line and col. Arrays of tables are entered at their last element when
+// fromHeader is set.
+func (p *tomlParser) walk(table *orderedMap, keys []string, fromHeader bool, line, col int) (*orderedMap, error) {
+	for i, key := range keys {
+		v, ok := table.get(key)
+		if !ok {
+			sub := newOrderedMap()
+			table.set(key, sub)
+			table.setPos(key, line, col)
+			table = sub
+			continue
+		}
+		switch v := v.(type) {
+		case *orderedMap:
+			table = v
+			continue
+		case []interface{}:
+			if fromHeader && p.arrays[table][key] {
+				table = v[len(v)-1].(*orderedMap)
+				continue
+			}
+		}
+		return nil, p.errorf("%q is not a table", strings.Join(keys[:i+1], "."))
+	}
+	return table, nil
+}
+
+func (p *tomlParser) parseKeyValue(table *orderedMap) error {
+	p.skipBlank(false)
+	line, col := p.line, p.i-p.lineStart+1
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if p.eof() || p.s[p.i] == '\n' || p.s[p.i] == '\r' {
+		return p.errorf("missing value for %q", strings.Join(keys, "."))
+	}
+
+	parent, err := p.walk(table, keys[:len(keys)-1], false, line, col)
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, dup := parent.get(last); dup {
+		return p.errorf("duplicate key %q", strings.Join(keys, "."))
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	parent.set(last, value)
+	parent.setPos(last, line, col)
+	return nil
+}
+
+// parseKey parses a possibly dotted key of bare and quoted parts.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipBlank(false)
+		if p.eof() {
+			return nil, p.errorf("expected a key")
+		}
+
+		var key string
+		switch p.s[p.i] {
+		case '"':
+			s, err := p.parseBasicString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		case '\'':
+			s, err := p.parseLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			start := p.i
+			for !p.eof() && isTOMLBareKeyChar(p.s[p.i]) {
+				p.i++
+			}
+			if p.i == start {
+				return nil, p.errorf("expected a key, got %q", p.rest())
+			}
+			key = p.s[start:p.i]
+		}
+		keys = append(keys, key)
+
+		p.skipBlank(false)
+		if p.eof() || p.s[p.i] != '.' {
+			return keys, nil
+		}
+		p.i++
+	}
+}
+
+func isTOMLBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) parseValue() (interface{}, error) {
+	if p.eof() {
+		return nil, p.errorf("expected a value")
+	}
+
+	switch p.s[p.i] {
+	case '"':
+		if strings.HasPrefix(p.s[p.i:], `"""`) {
+			return p.parseMultilineString('"')
+		}
+		return p.parseBasicString()
+	case '\'':
+		if strings.HasPrefix(p.s[p.i:], `'''`) {
+			return p.parseMultilineString('\'')
+		}
+		return p.parseLiteralString()
+	case '[':
+		return p.parseArray()
+	case '{':
+		return p.parseInlineTable()
+	}
+	return p.parseScalar()
+}
+
+func (p *tomlParser) parseArray() (interface{}, error) {
+	p.next()
+	list := []interface{}{}
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.s[p.i] == ']' {
+			p.next()
+			return list, nil
+		}
+
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+
+		p.skipBlank(true)
+		if !p.eof() && p.s[p.i] == ',' {
+			p.next()
+		} else if p.eof() || p.s[p.i] != ']' {
+			return nil, p.errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (interface{}, error) {
+	p.next()
+	table := newOrderedMap()
+	p.skipBlank(false)
+	if !p.eof() && p.s[p.i] == '}' {
+		p.next()
+		return table, nil
+	}
+	for {
+		if err := p.parseKeyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if p.eof() {
+			return nil, p.errorf("unterminated inline table")
+		}
+		switch p.next() {
+		case ',':
+			p.skipBlank(false)
+		case '}':
+			return table, nil
+		default:
+			p.i--
+			return nil, p.errorf("expected ',' or '}' in inline table")
+		}
+	}
+}
+
+func (p *tomlParser) parseBasicString() (string, error) {
+	p.next()
+	var sb strings.Builder
+	for !p.eof() {
+		c := p.s[p.i]
+		switch {
+		case c == '"':
+			p.next()
+			return sb.String(), nil
+		case c == '\n':
+			return "", p.errorf("unterminated string")
+		case c == '\\':
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(p.next())
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *tomlParser) parseEscape(sb *strings.Builder) error {
+	p.next()
+	if p.eof() {
+		return p.errorf("unterminated string")
+	}
+	switch e := p.next(); e {
+	case 'b':
+		sb.WriteByte('\b')
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'r':
+		sb.WriteByte('\r')
+	case 'e':
+		sb.WriteByte(0x1b)
+	case '"', '\\':
+		sb.WriteByte(e)
+	case 'u', 'U':
+		n := 4
+		if e == 'U' {
+			n = 8
+		}
+		if p.i+n > len(p.s) {
+			return p.errorf("invalid escape \\%c", e)
+		}
+		r, err := strconv.ParseUint(p.s[p.i:p.i+n], 16, 32)
+		if err != nil {
+			return p.errorf("invalid escape \\%c%s", e, p.s[p.i:p.i+n])
+		}
+		sb.WriteRune(rune(r))
+		p.i += n
+	default:
+		p.i--
+		return p.errorf("invalid escape \\%c", e)
+	}
+	return nil
+}
+
+func (p *tomlParser) parseLiteralString() (string, error) {
+	p.next()
+	start := p.i
+	for !p.eof() {
+		switch p.s[p.i] {
+		case '\'':
+			s := p.s[start:p.i]
+			p.next()
+			return s, nil
+		case '\n':
+			return "", p.errorf("unterminated string")
+		}
+		p.next()
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// parseMultilineString parses a multi-line basic or literal string.
+func (p *tomlParser) parseMultilineString(q byte) (string, error) {
+	delim := strings.Repeat(string(q), 3)
+	p.i += 3
+	// A line break right after the opening delimiter is trimmed.
+	if strings.HasPrefix(p.s[p.i:], "\r\n") {
+		p.i++
+	}
+	if !p.eof() && p.s[p.i] == '\n' {
+		p.next()
+	}
+
+	var sb strings.Builder
+	for !p.eof() {
+		if strings.HasPrefix(p.s[p.i:], delim) {
+			// Up to two quotes may directly precede the closing delimiter.
+			n := 3
+			for n < 5 && p.i+n < len(p.s) && p.s[p.i+n] == q {
+				n++
+			}
+			sb.WriteString(strings.Repeat(string(q), n-3))
+			p.i += n
+			return sb.String(), nil
+		}
+
+		c := p.s[p.i]
+		if q == '"' && c == '\\' {
+			// A backslash at the end of a line trims the following
+			// whitespace and line breaks.
+			j := p.i + 1
+			for j < len(p.s) && (p.s[j] == ' ' || p.s[j] == '\t') {
+				j++
+			}
+			if j < len(p.s) && (p.s[j] == '\n' || p.s[j] == '\r') {
+				p.i = j
+				for !p.eof() && strings.IndexByte(" \t\r\n", p.s[p.i]) >= 0 {
+					p.next()
+				}
+				continue
+			}
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if c == '\r' && strings.HasPrefix(p.s[p.i:], "\r\n") {
+			p.i++
+			continue
+		}
+		sb.WriteByte(p.next())
+	}
+	return "", p.errorf("unterminated string")
+}
+
+var (
+	tomlIntRe      = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$`)
+	tomlFloatRe    = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][+-]?[0-9](_?[0-9])*)?$`)
+	tomlDateTimeRe = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}([Tt ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?)?([Zz]|[+-]\d{2}:\d{2})?|\d{2}:\d{2}(:\d{2}(\.\d+)?)?)$`)
+	tomlDateRe     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:`)
+)
+
+func (p *tomlParser) parseScalar() (interface{}, error) {
+	start := p.i
+	end := start
+	for end < len(p.s) && strings.IndexByte(" \t\r\n,]}#", p.s[end]) < 0 {
+		end++
+	}
+	// A space may separate the date and time of a datetime.
+	if tomlDateRe.MatchString(p.s[start:]) {
+		end = start + 11
+		for end < len(p.s) && strings.IndexByte(" \t\r\n,]}#", p.s[end]) < 0 {
+			end++
+		}
+	}
+	token := p.s[start:end]
+
+	var value interface{}
+	switch digits := strings.ReplaceAll(token, "_", ""); {
+	case token == "true":
+		value = true
+	case token == "false":
+		value = false
+	case strings.HasSuffix(token, "inf") || strings.HasSuffix(token, "nan"):
+		return nil, p.errorf("%s cannot be represented", token)
+	case len(token) > 2 && token[0] == '0' && strings.IndexByte("xob", token[1]) >= 0:
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[token[1]]
+		n, ok := exactInteger(digits[2:], base)
+		if !ok {
+			return nil, p.errorf("invalid integer %s", token)
+		}
+		value = n
+	case tomlIntRe.MatchString(token):
+		n, ok := exactInteger(digits, 10)
+		if !ok {
+			return nil, p.errorf("invalid integer %s", token)
+		}
+		value = n
+	case tomlFloatRe.MatchString(token):
+		value = json.Number(strings.TrimPrefix(digits, "+"))
+	case tomlDateTimeRe.MatchString(token):
+		value = strings.Replace(token, " ", "T", 1)
+	default:
+		return nil, p.errorf("invalid value %q", token)
+	}
+	p.i = end
+	return value, nil
+}
+
+// emitTOML encodes a table made of nil, bool, json.Number, string,
+// []interface{} and *orderedMap values. Nil values are left out because
+// TOML has no null.
+func emitTOML(v interface{}) ([]byte, error) {
+	root, ok := v.(*orderedMap)
+	if !ok {
+		return nil, errors.New("TOML needs a table at the top level")
+	}
+	var buf bytes.Buffer
+	if err := emitTOMLTable(&buf, root, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func emitTOMLTable(buf *bytes.Buffer, table *orderedMap, path []string) error {
+	// Plain keys must come before the sub-tables.
+	for _, key := range table.keys {
+		v := table.values[key]
+		if v == nil || isTOMLTable(v) || isTOMLArrayOfTables(v) {
+			continue
+		}
+		value, err := tomlValue(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(append(path, key), "."), err)
+		}
+		buf.WriteString(tomlKey(key))
+		buf.WriteString(" = ")
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+
+	for _, key := range table.keys {
+		sub := append(path[:len(path):len(path)], key)
+		switch v := table.values[key].(type) {
+		case *orderedMap:
+			writeTOMLHeader(buf, "[", sub, "]")
+			if err := emitTOMLTable(buf, v, sub); err != nil {
+				return err
+			}
+		case []interface{}:
+			if !isTOMLArrayOfTables(v) {
+				continue
+			}
+			for _, item := range v {
+				writeTOMLHeader(buf, "[[", sub, "]]")
+				if err := emitTOMLTable(buf, item.(*orderedMap), sub); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func writeTOMLHeader(buf *bytes.Buffer, open string, path []string, close string) {
+	if buf.Len() > 0 {
+		buf.WriteByte('\n')
+	}
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = tomlKey(key)
+	}
+	buf.WriteString(open)
+	buf.WriteString(strings.Join(keys, "."))
+	buf.WriteString(close)
+	buf.WriteByte('\n')
+}
+
+func isTOMLTable(v interface{}) bool {
+	_, ok := v.(*orderedMap)
+	return ok
+}
+
+func isTOMLArrayOfTables(v interface{}) bool {
+	list, ok := v.([]interface{})
+	if !ok || len(list) == 0 {
+		return false
+	}
+	for _, item := range list {
+		if !isTOMLTable(item) {
+			return false
+		}
+	}
+	return true
+}
+
+func tomlValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", errors.New("TOML cannot represent null")
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return v.String(), nil
+	case string:
+		return tomlQuote(v), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := tomlValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case *orderedMap:
+		var items []string
+		for _, key := range v.keys {
+			if v.values[key] == nil {
+				continue
+			}
+			s, err := tomlValue(v.values[key])
+			if err != nil {
+				return "", err
+			}
+			items = append(items, tomlKey(key)+" = "+s)
+		}
+		if len(items) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(items, ", ") + " }", nil
+	}
+	return "", fmt.Errorf("unsupported TOML value %T", v)
+}
+
+func tomlKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for i := 0; i < len(key); i++ {
+		if !isTOMLBareKeyChar(key[i]) {
+			return tomlQuote(key)
+		}
+	}
+	return key
+}
+
+func tomlQuote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,97 @@
+package iutils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"scalars", "a = 1\nb = -2.5e3\nc = true\nd = \"x\\ty\"\ne = 'C:\\path'\nf = 1_000\ng = 0xff\n",
+			`{"a":1,"b":-2.5e3,"c":true,"d":"x\ty","e":"C:\\path","f":1000,"g":255}`},
+		{"tables", "# config\ntitle = \"t\"\n\n[server]\nhost = \"h\" # comment\n\n[server.tls]\nenabled = false\n",
+			`{"title":"t","server":{"host":"h","tls":{"enabled":false}}}`},
+		{"dotted keys", "a.b.c = 1\n\"quoted key\".x = 2\n",
+			`{"a":{"b":{"c":1}},"quoted key":{"x":2}}`},
+		{"implicit table defined later", "[a.b]\nx = 1\n[a]\ny = 2\n",
+			`{"a":{"b":{"x":1},"y":2}}`},
+		{"arrays", "a = [1, 2, 3]\nb = [\n  \"x\", # first\n  \"y\",\n]\nc = [[1], []]\n",
+			`{"a":[1,2,3],"b":["x","y"],"c":[[1],[]]}`},
+		{"inline tables", "p = { x = 1, y = { z = \"w\" } }\ne = {}\n",
+			`{"p":{"x":1,"y":{"z":"w"}},"e":{}}`},
+		{"array of tables", "[[srv]]\nname = \"a\"\n[srv.opts]\nk = 1\n[[srv]]\nname = \"b\"\n",
+			`{"srv":[{"name":"a","opts":{"k":1}},{"name":"b"}]}`},
+		{"multiline strings", "a = \"\"\"\nline1\nline2\"\"\"\nb = '''\nraw\\n'''\nc = \"\"\"x \\\n    y\"\"\"\n",
+			`{"a":"line1\nline2","b":"raw\\n","c":"x y"}`},
+		{"datetimes", "a = 1979-05-27T07:32:00Z\nb = 1979-05-27 07:32:00-07:00\nc = 1979-05-27\n",
+			`{"a":"1979-05-27T07:32:00Z","b":"1979-05-27T07:32:00-07:00","c":"1979-05-27"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := parseTOML([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("parseTOML() error = %v", err)
+			}
+			got, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("parseTOML() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	for _, in := range []string{
+		"a = 1\na = 2\n",
+		"a = \n",
+		"a = \"unterminated\n",
+		"a = [1, 2\n",
+		"a = inf\n",
+		"a = 1\n[a]\n",
+		"[t]\n[t]\n",
+		"a = [1]\n[[a]]\n",
+		"a = 01\n",
+	} {
+		if _, err := parseTOML([]byte(in)); err == nil {
+			t.Errorf("parseTOML(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestEmitTOMLRoundTrip(t *testing.T) {
+	values := []string{
+		`{"a":1,"b":"x\"y\\z\n","c":[1,"two",{"k":true}],"d":{"e":{"f":1.5}},"g":[{"h":1},{"h":2,"i":{"j":[]}}],"odd key":{}}`,
+		`{"x":{}}`,
+	}
+
+	for _, in := range values {
+		generic, err := toOrderedGeneric(json.RawMessage(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := emitTOML(generic)
+		if err != nil {
+			t.Fatalf("emitTOML() error = %v", err)
+		}
+		parsed, err := parseTOML(out)
+		if err != nil {
+			t.Fatalf("parseTOML(%q) error = %v", out, err)
+		}
+		got, _ := json.Marshal(parsed)
+		if string(got) != in {
+			t.Errorf("round trip of %s through\n%s= %s", in, out, got)
+		}
+	}
+
+	if _, err := emitTOML([]interface{}{}); err == nil {
+		t.Errorf("emitTOML() of an array succeeded, want an error")
+	}
+}
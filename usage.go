@@ -0,0 +1,210 @@
+package iutils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrInsufficientSpace is returned by CheckFreeSpace when a write would
+// leave too little free space.
+var ErrInsufficientSpace = errors.New("iutils: insufficient free space")
+
+// UsageTotals sums the sizes of a set of files.
+type UsageTotals struct {
+	Files int64
+	// Size is the apparent size, the sum of the file lengths.
+	Size int64
+	// Allocated is the space taken on disk, which is smaller than Size for
+	// sparse or compressed files and larger for small files. It equals
+	// Size on platforms that do not report allocation.
+	Allocated int64
+}
+
+func (t *UsageTotals) add(size, allocated int64) {
+	t.Files++
+	t.Size += size
+	t.Allocated += allocated
+}
+
+// FileUsage is the size of one file.
+type FileUsage struct {
+	Path      string
+	Size      int64
+	Allocated int64
+}
+
+// DiskUsage is the result of DirUsage.
+type DiskUsage struct {
+	// UsageTotals covers all files and symlinks. A file with several hard
+	// links in the tree is counted once.
+	UsageTotals
+	Dirs     int64
+	Symlinks int64
+	// ByExt breaks the totals down by lower-case file extension, "" for
+	// files without one.
+	ByExt map[string]*UsageTotals
+	// Largest are the TopN largest files by apparent size, largest first.
+	Largest []FileUsage
+}
+
+// DiskUsageOptions configures DirUsage. A nil *DiskUsageOptions does not
+// collect the largest files.
+type DiskUsageOptions struct {
+	// TopN is the number of largest files to report.
+	TopN int
+	// ExcludeDirs skips directories whose slash-separated path relative to
+	// the root matches one of these patterns, as in FindOptions.
+	ExcludeDirs []string
+}
+
+// DirUsage sums the sizes of the files below root, like du. Symlinks are
+// not followed. Entries that vanish during the walk are ignored.
+func DirUsage(root string, opts *DiskUsageOptions) (*DiskUsage, error) {
+	if opts == nil {
+		opts = &DiskUsageOptions{}
+	}
+	excludeDirs, err := compilePatterns(opts.ExcludeDirs, false)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &DiskUsage{ByExt: make(map[string]*UsageTotals)}
+	seen := make(map[fileKey]bool)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path != root {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path != root && len(excludeDirs) > 0 {
+				if rel, err := filepath.Rel(root, path); err == nil && matchAnyPattern(excludeDirs, filepath.ToSlash(rel)) {
+					return filepath.SkipDir
+				}
+			}
+			usage.Dirs++
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		size := info.Size()
+		allocated, nlink, ok := fileAllocation(info)
+		if !ok {
+			allocated = size
+		}
+		if nlink > 1 {
+			if key, ok := fileIdentity(info); ok {
+				if seen[key] {
+					return nil
+				}
+				seen[key] = true
+			}
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			usage.Symlinks++
+		}
+		usage.add(size, allocated)
+		ext := strings.ToLower(filepath.Ext(path))
+		if usage.ByExt[ext] == nil {
+			usage.ByExt[ext] = &UsageTotals{}
+		}
+		usage.ByExt[ext].add(size, allocated)
+		usage.Largest = addLargest(usage.Largest, opts.TopN, FileUsage{Path: path, Size: size, Allocated: allocated})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// addLargest inserts f into largest, which holds at most n files sorted by
+// size, largest first.
+func addLargest(largest []FileUsage, n int, f FileUsage) []FileUsage {
+	if n <= 0 || (len(largest) == n && f.Size <= largest[n-1].Size) {
+		return largest
+	}
+	i := sort.Search(len(largest), func(i int) bool { return largest[i].Size < f.Size })
+	if len(largest) < n {
+		largest = append(largest, FileUsage{})
+	}
+	copy(largest[i+1:], largest[i:])
+	largest[i] = f
+	return largest
+}
+
+// DirSize returns the apparent size of the files below root.
+func DirSize(root string) (int64, error) {
+	usage, err := DirUsage(root, nil)
+	if err != nil {
+		return 0, err
+	}
+	return usage.Size, nil
+}
+
+// FSInfo describes the filesystem holding a path.
+type FSInfo struct {
+	// Total, Free and Available are in bytes. Available is the part of
+	// Free usable by unprivileged processes.
+	Total     uint64
+	Free      uint64
+	Available uint64
+	// Inodes and InodesFree count file slots, zero if the filesystem has
+	// no fixed number.
+	Inodes     uint64
+	InodesFree uint64
+}
+
+// UsedPercent returns the share of Total that is not available, in
+// percent.
+func (fi FSInfo) UsedPercent() float64 {
+	if fi.Total == 0 {
+		return 0
+	}
+	return 100 * float64(fi.Total-fi.Available) / float64(fi.Total)
+}
+
+// StatFS returns information about the filesystem holding path. A path
+// that does not exist yet is looked up through its nearest existing
+// parent, so the target of a write can be passed directly.
+func StatFS(path string) (FSInfo, error) {
+	for {
+		fi, err := statFS(path)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fi, err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return fi, err
+		}
+		path = parent
+	}
+}
+
+// CheckFreeSpace fails with ErrInsufficientSpace unless writing size bytes
+// to path leaves at least reserve bytes available. Call it before
+// WriteFile3, WriteFileParts and the like to refuse writes to a volume
+// that is nearly full.
+func CheckFreeSpace(path string, size, reserve int64) error {
+	fi, err := StatFS(path)
+	if err != nil {
+		return err
+	}
+	need := uint64(size) + uint64(reserve)
+	if fi.Available < need {
+		return fmt.Errorf("%s: %w: %d bytes available, %d needed", path, ErrInsufficientSpace, fi.Available, need)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd)
+
+package iutils
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// statFS is not supported on this platform.
+func statFS(path string) (FSInfo, error) {
+	return FSInfo{}, &fs.PathError{Op: "statfs", Path: path, Err: errors.ErrUnsupported}
+}
@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd
+
+package iutils
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+func statFS(path string) (FSInfo, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return FSInfo{}, &fs.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	bsize := uint64(st.Bsize)
+	return FSInfo{
+		Total:      uint64(st.Blocks) * bsize,
+		Free:       uint64(st.Bfree) * bsize,
+		Available:  uint64(st.Bavail) * bsize,
+		Inodes:     uint64(st.Files),
+		InodesFree: uint64(st.Ffree),
+	}, nil
+}
@@ -0,0 +1,102 @@
+package iutils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDirUsage(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		"a.txt":          "12345",
+		"b.TXT":          "123",
+		"sub/c.log":      "1234567890",
+		"sub/d":          "1",
+		"skip/big.bin":   "12345678901234567890",
+		"sub/deep/e.log": "12",
+	})
+	if err := os.Link(filepath.Join(root, "a.txt"), filepath.Join(root, "sub", "a-link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := DirUsage(root, &DiskUsageOptions{TopN: 2, ExcludeDirs: []string{"skip"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The hard link is counted once.
+	if usage.Files != 5 || usage.Size != 21 || usage.Dirs != 3 {
+		t.Errorf("DirUsage() = %d files, %d bytes, %d dirs, want 5, 21, 3", usage.Files, usage.Size, usage.Dirs)
+	}
+	if usage.Allocated <= 0 {
+		t.Errorf("Allocated = %d, want > 0", usage.Allocated)
+	}
+
+	wantExt := map[string][2]int64{".txt": {2, 8}, ".log": {2, 12}, "": {1, 1}}
+	if len(usage.ByExt) != len(wantExt) {
+		t.Errorf("ByExt has %d extensions, want %d", len(usage.ByExt), len(wantExt))
+	}
+	for ext, want := range wantExt {
+		got := usage.ByExt[ext]
+		if got == nil || got.Files != want[0] || got.Size != want[1] {
+			t.Errorf("ByExt[%q] = %+v, want %d files of %d bytes", ext, got, want[0], want[1])
+		}
+	}
+
+	if len(usage.Largest) != 2 || usage.Largest[0].Path != filepath.Join(root, "sub", "c.log") || usage.Largest[1].Size != 5 {
+		t.Errorf("Largest = %+v, want sub/c.log and a 5 byte file", usage.Largest)
+	}
+
+	size, err := DirSize(root)
+	if err != nil || size != 41 {
+		t.Errorf("DirSize() = %d, %v, want 41", size, err)
+	}
+	if _, err := DirSize(filepath.Join(root, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("DirSize() of missing dir error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestDirUsageSparse(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("allocation reporting is checked on Linux only")
+	}
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "sparse"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(filepath.Join(root, "sparse"), 64<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := DirUsage(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Size != 64<<20 || usage.Allocated >= usage.Size {
+		t.Errorf("sparse file: Size = %d, Allocated = %d, want allocation below size", usage.Size, usage.Allocated)
+	}
+}
+
+func TestStatFSAndCheckFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	fi, err := StatFS(filepath.Join(dir, "not", "yet", "written"))
+	if err != nil {
+		t.Fatalf("StatFS() error = %v", err)
+	}
+	if fi.Total == 0 || fi.Available > fi.Total || fi.Free > fi.Total {
+		t.Errorf("StatFS() = %+v", fi)
+	}
+	if p := fi.UsedPercent(); p < 0 || p > 100 {
+		t.Errorf("UsedPercent() = %v", p)
+	}
+
+	if err := CheckFreeSpace(filepath.Join(dir, "f"), 1, 0); err != nil {
+		t.Errorf("CheckFreeSpace() of 1 byte error = %v", err)
+	}
+	err = CheckFreeSpace(filepath.Join(dir, "f"), 1, int64(fi.Total))
+	if !errors.Is(err, ErrInsufficientSpace) {
+		t.Errorf("CheckFreeSpace() beyond the volume error = %v, want %v", err, ErrInsufficientSpace)
+	}
+}
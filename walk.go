@@ -0,0 +1,224 @@
+package iutils
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// WalkEntry is a file or directory found by WalkParallel.
+type WalkEntry struct {
+	Path  string
+	Entry fs.DirEntry
+}
+
+// WalkOptions configures WalkParallel.
+type WalkOptions struct {
+	// Workers is the number of directories read concurrently, NumCPU if
+	// zero.
+	Workers int
+	// SkipDir, if set, is called for every directory below the root; the
+	// directory is reported but not descended into when it returns true.
+	SkipDir func(path string, d fs.DirEntry) bool
+}
+
+// WalkParallel walks the tree rooted at root, reading directories
+// concurrently, and calls fn for the root and every entry below it. fn is
+// always called from the calling goroutine, but entries arrive in no
+// particular order.
+//
+// Errors reading a directory do not stop the walk; they are collected and
+// returned joined together once the walk completes. If fn returns an error
+// the walk stops and that error is returned, except for fs.SkipAll which
+// stops the walk and returns nil. Cancelling ctx also stops the walk.
+func WalkParallel(ctx context.Context, root string, opts *WalkOptions, fn func(WalkEntry) error) error {
+	if opts == nil {
+		opts = &WalkOptions{}
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	info, err := os.Lstat(root)
+	if err != nil {
+		return err
+	}
+	rootEntry := fs.FileInfoToDirEntry(info)
+	if err := fn(WalkEntry{Path: root, Entry: rootEntry}); err != nil {
+		if errors.Is(err, fs.SkipAll) {
+			return nil
+		}
+		return err
+	}
+	if !info.IsDir() {
+		return nil
+	}
+
+	walkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan WalkEntry, 256)
+	var errMu sync.Mutex
+	var dirErrs []error
+
+	// A fixed pool of workers takes directories from a queue, so a wide
+	// tree costs queued paths rather than goroutines.
+	var (
+		qmu     sync.Mutex
+		qcond   = sync.NewCond(&qmu)
+		queue   = []string{root}
+		pending = 1 // directories queued or being read
+		stopped bool
+	)
+	stop := context.AfterFunc(walkCtx, func() {
+		qmu.Lock()
+		stopped = true
+		qmu.Unlock()
+		qcond.Broadcast()
+	})
+	defer stop()
+
+	next := func() (string, bool) {
+		qmu.Lock()
+		defer qmu.Unlock()
+		for len(queue) == 0 && pending > 0 && !stopped {
+			qcond.Wait()
+		}
+		if len(queue) == 0 || stopped {
+			return "", false
+		}
+		dir := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		return dir, true
+	}
+	push := func(dir string) {
+		qmu.Lock()
+		queue = append(queue, dir)
+		pending++
+		qmu.Unlock()
+		qcond.Signal()
+	}
+	finish := func() {
+		qmu.Lock()
+		pending--
+		last := pending == 0
+		qmu.Unlock()
+		if last {
+			qcond.Broadcast()
+		}
+	}
+
+	readDir := func(dirPath string) bool {
+		defer finish()
+		entries, err := os.ReadDir(dirPath)
+		if err != nil {
+			errMu.Lock()
+			dirErrs = append(dirErrs, err)
+			errMu.Unlock()
+		}
+
+		for _, entry := range entries {
+			entryPath := filepath.Join(dirPath, entry.Name())
+			select {
+			case results <- WalkEntry{Path: entryPath, Entry: entry}:
+			case <-walkCtx.Done():
+				return false
+			}
+			if entry.IsDir() && (opts.SkipDir == nil || !opts.SkipDir(entryPath, entry)) {
+				push(entryPath)
+			}
+		}
+		return true
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				dir, ok := next()
+				if !ok || !readDir(dir) {
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var fnErr error
+	for entry := range results {
+		if fnErr != nil {
+			continue // Drain until every reader has noticed the cancel.
+		}
+		if err := fn(entry); err != nil {
+			fnErr = err
+			cancel()
+		}
+	}
+
+	if fnErr != nil {
+		if errors.Is(fnErr, fs.SkipAll) {
+			return nil
+		}
+		return fnErr
+	}
+	if err := ctx.Err(); err != nil {
+		dirErrs = append(dirErrs, err)
+	}
+	return errors.Join(dirErrs...)
+}
+
+// WalkEntries runs WalkParallel in the background and streams the entries
+// on the returned channel. The channel is closed when the walk ends; wait
+// then returns the walk error. Cancel ctx to stop early.
+func WalkEntries(ctx context.Context, root string, opts *WalkOptions) (entries <-chan WalkEntry, wait func() error) {
+	ch := make(chan WalkEntry)
+	done := make(chan struct{})
+	var walkErr error
+
+	go func() {
+		defer close(done)
+		defer close(ch)
+		walkErr = WalkParallel(ctx, root, opts, func(entry WalkEntry) error {
+			select {
+			case ch <- entry:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	return ch, func() error {
+		<-done
+		return walkErr
+	}
+}
+
+// WalkSeq returns an iterator over the entries found by WalkParallel. The
+// walk error, if any, is yielded last with a zero WalkEntry. Breaking out
+// of the loop stops the walk.
+func WalkSeq(ctx context.Context, root string, opts *WalkOptions) func(yield func(WalkEntry, error) bool) {
+	return func(yield func(WalkEntry, error) bool) {
+		stopped := false
+		err := WalkParallel(ctx, root, opts, func(entry WalkEntry) error {
+			if !yield(entry, nil) {
+				stopped = true
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil && !stopped {
+			yield(WalkEntry{}, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package iutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestWalkParallel(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{}
+	for _, dir := range []string{"a", "a/b", "c", "c/d/e", "skip"} {
+		for _, name := range []string{"1.txt", "2.txt"} {
+			files[dir+"/"+name] = dir
+		}
+	}
+	writeTestTree(t, root, files)
+
+	var got []string
+	err := WalkParallel(context.Background(), root, &WalkOptions{
+		Workers: 3,
+		SkipDir: func(path string, d fs.DirEntry) bool {
+			return d.Name() == "skip"
+		},
+	}, func(entry WalkEntry) error {
+		if entry.Entry.Type().IsRegular() {
+			rel, _ := filepath.Rel(root, entry.Path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkParallel() error = %v", err)
+	}
+
+	var want []string
+	for name := range files {
+		if filepath.Dir(name) != "skip" {
+			want = append(want, name)
+		}
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("WalkParallel() found %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("WalkParallel() found %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestWalkParallelWideTree(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 500; i++ {
+		if err := os.MkdirAll(filepath.Join(root, fmt.Sprintf("d%03d", i), "sub"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The number of goroutines is bounded by Workers, not by the number of
+	// directories waiting to be read.
+	const workers = 2
+	before := runtime.NumGoroutine()
+	most, count := 0, 0
+	err := WalkParallel(context.Background(), root, &WalkOptions{Workers: workers}, func(entry WalkEntry) error {
+		if count++; count == 2 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		most = max(most, runtime.NumGoroutine())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1001 {
+		t.Errorf("WalkParallel() found %d entries, want 1001", count)
+	}
+	if most > before+workers+2 {
+		t.Errorf("%d goroutines during the walk, %d before", most, before)
+	}
+}
+
+func TestWalkParallelStop(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{}
+	for _, name := range []string{"a", "b", "c", "d/e", "d/f", "g/h"} {
+		files[name] = name
+	}
+	writeTestTree(t, root, files)
+
+	count := 0
+	err := WalkParallel(context.Background(), root, nil, func(entry WalkEntry) error {
+		count++
+		if count == 3 {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil || count != 3 {
+		t.Errorf("WalkParallel() with SkipAll = %v after %d entries", err, count)
+	}
+
+	errStop := errors.New("stop")
+	err = WalkParallel(context.Background(), root, nil, func(entry WalkEntry) error {
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("WalkParallel() error = %v, want %v", err, errStop)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = WalkParallel(ctx, root, nil, func(entry WalkEntry) error { return nil })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("WalkParallel() with canceled ctx error = %v", err)
+	}
+}
+
+func TestWalkParallelCollectsErrors(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{"open/a": "", "locked/b": ""})
+	locked := filepath.Join(root, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	found := false
+	err := WalkParallel(context.Background(), root, nil, func(entry WalkEntry) error {
+		if filepath.Base(entry.Path) == "a" {
+			found = true
+		}
+		return nil
+	})
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("WalkParallel() error = %v, want permission error", err)
+	}
+	if !found {
+		t.Errorf("WalkParallel() stopped before visiting readable directories")
+	}
+}
+
+func TestWalkEntriesAndSeq(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{"x/1": "", "x/2": "", "y/3": ""})
+
+	entries, wait := WalkEntries(context.Background(), root, nil)
+	n := 0
+	for range entries {
+		n++
+	}
+	if err := wait(); err != nil {
+		t.Fatalf("WalkEntries() error = %v", err)
+	}
+	// root, x, y, x/1, x/2, y/3
+	if n != 6 {
+		t.Errorf("WalkEntries() produced %d entries, want 6", n)
+	}
+
+	n = 0
+	WalkSeq(context.Background(), root, nil)(func(entry WalkEntry, err error) bool {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+		return n < 2
+	})
+	if n != 2 {
+		t.Errorf("WalkSeq() yielded %d entries after break, want 2", n)
+	}
+
+	WalkSeq(context.Background(), filepath.Join(root, "missing"), nil)(func(entry WalkEntry, err error) bool {
+		if err == nil {
+			t.Errorf("WalkSeq() expected error for missing root")
+		}
+		return true
+	})
+}
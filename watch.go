@@ -0,0 +1,419 @@
+package iutils
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WatchOp is the kind of change reported by Watch.
+type WatchOp int
+
+const (
+	// WatchCreate reports a file that appeared, including the new name of
+	// a renamed file.
+	WatchCreate WatchOp = iota + 1
+	// WatchWrite reports a file whose content changed or that was replaced,
+	// for example by an atomic write.
+	WatchWrite
+	// WatchRemove reports a deleted file.
+	WatchRemove
+	// WatchRename reports the old name of a file that was moved away.
+	WatchRename
+)
+
+func (op WatchOp) String() string {
+	switch op {
+	case WatchCreate:
+		return "create"
+	case WatchWrite:
+		return "write"
+	case WatchRemove:
+		return "remove"
+	case WatchRename:
+		return "rename"
+	}
+	return fmt.Sprintf("WatchOp(%d)", int(op))
+}
+
+// WatchEvent is a coalesced change of one file.
+type WatchEvent struct {
+	Path string
+	Op   WatchOp
+}
+
+// WatchOptions configures Watch. A nil *WatchOptions watches the entries of
+// a directory, not its subdirectories, with the default timings.
+type WatchOptions struct {
+	// Recursive watches the whole tree below the root, including
+	// directories created later.
+	Recursive bool
+	// Exts, Patterns, IgnoreCase and ExcludeDirs select files as the
+	// fields of the same name in FindOptions do.
+	Exts        []string
+	Patterns    []string
+	IgnoreCase  bool
+	ExcludeDirs []string
+
+	// Debounce is how long a file must be quiet before its changes are
+	// reported as one event, 100ms if zero.
+	Debounce time.Duration
+
+	// Poll scans the tree periodically instead of using inotify. Polling is
+	// also used when inotify is not available.
+	Poll bool
+	// PollInterval is the scan interval of polling, 1s if zero.
+	PollInterval time.Duration
+	// Hash makes polling compare content hashes in addition to size and
+	// modification time, catching writes within the timestamp
+	// granularity. Every file is read on every scan.
+	Hash bool
+}
+
+// Watch reports changes of the file or directory root on the returned
+// channel until ctx is done. Only files are reported; directories are
+// followed internally. Bursts of changes to one file are coalesced: a file
+// created and removed again within the debounce time is not reported at
+// all, and a file replaced by rename is reported as written.
+//
+// The channel is closed when watching ends. wait then returns the error
+// that ended it, or nil when ctx was done.
+func Watch(ctx context.Context, root string, opts *WatchOptions) (events <-chan WatchEvent, wait func() error) {
+	ch := make(chan WatchEvent, 64)
+	done := make(chan struct{})
+	var watchErr error
+
+	go func() {
+		defer close(done)
+		defer close(ch)
+		w, err := newWatcher(root, opts, ch)
+		if err != nil {
+			watchErr = err
+			return
+		}
+		watchErr = w.run(ctx)
+	}()
+
+	return ch, func() error {
+		<-done
+		return watchErr
+	}
+}
+
+// watchState is what polling compares to detect a change.
+type watchState struct {
+	size  int64
+	mtime int64
+	hash  uint64
+}
+
+type pendingChange struct {
+	last    time.Time
+	written bool // a write event was seen
+	renamed bool // the last removal was a rename
+
+	// The state seen by the last scan, so that repeated scans of an
+	// unchanged file do not postpone its event.
+	scanned bool
+	state   watchState
+	exists  bool
+}
+
+// rawChange is an unprocessed notification of a backend.
+type rawChange struct {
+	path    string
+	dir     bool // path is a directory; its subtree is rescanned
+	gone    bool // path was removed or moved away
+	renamed bool
+}
+
+type watcher struct {
+	opts        WatchOptions
+	dir         string // directory being watched
+	target      string // watched file, if root is a file
+	exts        []string
+	patterns    []string
+	excludeDirs []string
+
+	known   map[string]watchState
+	pending map[string]*pendingChange
+	events  chan<- WatchEvent
+}
+
+func newWatcher(root string, opts *WatchOptions, events chan<- WatchEvent) (*watcher, error) {
+	root = filepath.Clean(root)
+	w := &watcher{
+		dir:     root,
+		known:   make(map[string]watchState),
+		pending: make(map[string]*pendingChange),
+		events:  events,
+	}
+	if opts != nil {
+		w.opts = *opts
+	}
+	if w.opts.Debounce <= 0 {
+		w.opts.Debounce = 100 * time.Millisecond
+	}
+	if w.opts.PollInterval <= 0 {
+		w.opts.PollInterval = time.Second
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		// Watch the parent so that replacing the file is noticed.
+		w.dir, w.target = filepath.Dir(root), root
+		w.opts.Recursive = false
+	}
+
+	for _, ext := range w.opts.Exts {
+		w.exts = append(w.exts, w.fold(ext))
+	}
+	if w.patterns, err = compilePatterns(w.opts.Patterns, w.opts.IgnoreCase); err != nil {
+		return nil, err
+	}
+	if w.excludeDirs, err = compilePatterns(w.opts.ExcludeDirs, false); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *watcher) run(ctx context.Context) error {
+	var raw <-chan rawChange
+	var pollC <-chan time.Time
+	if !w.opts.Poll {
+		ch := make(chan rawChange, 256)
+		stop, err := startInotify(w.dir, w.opts.Recursive, w.skipDir, ch)
+		if err == nil {
+			defer stop()
+			raw = ch
+		}
+	}
+	if raw == nil {
+		ticker := time.NewTicker(w.opts.PollInterval)
+		defer ticker.Stop()
+		pollC = ticker.C
+	}
+
+	// Scan after the backend started, so no change falls in between.
+	w.known = w.scan(w.dir)
+
+	tick := w.opts.Debounce / 2
+	if tick < time.Millisecond {
+		tick = time.Millisecond
+	}
+	flushTicker := time.NewTicker(tick)
+	defer flushTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case c := <-raw:
+			if c.dir {
+				w.rescan(c.path, c.renamed)
+			} else if w.match(c.path) {
+				w.note(c.path, !c.gone, c.renamed)
+			}
+		case <-pollC:
+			w.rescan(w.dir, false)
+		case <-flushTicker.C:
+			if !w.flush(ctx) {
+				return nil
+			}
+		}
+	}
+}
+
+func (w *watcher) fold(s string) string {
+	if w.opts.IgnoreCase {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+func (w *watcher) rel(path string) string {
+	rel, err := filepath.Rel(w.dir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// match reports whether events for path are wanted.
+func (w *watcher) match(path string) bool {
+	if w.target != "" {
+		return path == w.target
+	}
+	rel := w.rel(path)
+	if rel == "." || strings.HasPrefix(rel, "../") {
+		return false
+	}
+	if !w.opts.Recursive && strings.Contains(rel, "/") {
+		return false
+	}
+	if len(w.excludeDirs) > 0 {
+		for dir := filepath.ToSlash(filepath.Dir(rel)); dir != "."; dir = filepath.ToSlash(filepath.Dir(dir)) {
+			if matchAnyPattern(w.excludeDirs, dir) {
+				return false
+			}
+		}
+	}
+	if len(w.exts) > 0 && !containsString(w.exts, w.fold(filepath.Ext(path))) {
+		return false
+	}
+	if len(w.patterns) > 0 && !matchAnyPattern(w.patterns, w.fold(rel)) {
+		return false
+	}
+	return true
+}
+
+// skipDir reports whether the directory path is not watched.
+func (w *watcher) skipDir(path string) bool {
+	rel := w.rel(path)
+	return rel != "." && len(w.excludeDirs) > 0 && matchAnyPattern(w.excludeDirs, rel)
+}
+
+func (w *watcher) stat(path string) (watchState, bool) {
+	info, err := os.Lstat(path)
+	if err != nil || info.IsDir() {
+		return watchState{}, false
+	}
+	st := watchState{size: info.Size(), mtime: info.ModTime().UnixNano()}
+	if w.opts.Hash && info.Mode().IsRegular() {
+		if file, err := os.Open(path); err == nil {
+			h := NewXXH64()
+			if _, err := file.WriteTo(h); err == nil {
+				st.hash = h.Sum64()
+			}
+			file.Close()
+		}
+	}
+	return st, true
+}
+
+// scan returns the state of the matching files below dir.
+func (w *watcher) scan(dir string) map[string]watchState {
+	states := make(map[string]watchState)
+	if w.target != "" {
+		if st, ok := w.stat(w.target); ok {
+			states[w.target] = st
+		}
+		return states
+	}
+
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Entries may vanish while they are scanned.
+			return nil
+		}
+		if d.IsDir() {
+			if path != w.dir && (!w.opts.Recursive || w.skipDir(path)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if w.match(path) {
+			if st, ok := w.stat(path); ok {
+				states[path] = st
+			}
+		}
+		return nil
+	})
+	return states
+}
+
+// rescan compares the files below dir with the known ones.
+func (w *watcher) rescan(dir string, renamed bool) {
+	current := w.scan(dir)
+	prefix := dir + string(filepath.Separator)
+	for path := range w.known {
+		if _, ok := current[path]; !ok && (dir == w.dir || strings.HasPrefix(path, prefix)) {
+			w.noteScan(path, watchState{}, false, renamed)
+		}
+	}
+	for path, st := range current {
+		w.noteScan(path, st, true, false)
+	}
+}
+
+// noteScan notes path if its scanned state differs from the last one seen.
+func (w *watcher) noteScan(path string, st watchState, exists, renamed bool) {
+	last, existed := w.known[path]
+	if p := w.pending[path]; p != nil && p.scanned {
+		last, existed = p.state, p.exists
+	}
+	if exists == existed && st == last {
+		return
+	}
+	w.note(path, false, renamed)
+	p := w.pending[path]
+	p.scanned, p.state, p.exists = true, st, exists
+}
+
+// note records a change of path to be reported after the debounce time.
+func (w *watcher) note(path string, written, renamed bool) {
+	p := w.pending[path]
+	if p == nil {
+		p = &pendingChange{}
+		w.pending[path] = p
+	}
+	p.last = time.Now()
+	p.written = p.written || written
+	p.renamed = renamed
+}
+
+// flush reports the pending changes that have been quiet long enough. The
+// event is derived from the known and the current state of each file, so
+// any sequence of notifications collapses into a single event.
+func (w *watcher) flush(ctx context.Context) bool {
+	now := time.Now()
+	var ready []string
+	for path, p := range w.pending {
+		if now.Sub(p.last) >= w.opts.Debounce {
+			ready = append(ready, path)
+		}
+	}
+	sort.Strings(ready)
+
+	for _, path := range ready {
+		p := w.pending[path]
+		delete(w.pending, path)
+
+		st, exists := w.stat(path)
+		old, existed := w.known[path]
+		if exists {
+			w.known[path] = st
+		} else {
+			delete(w.known, path)
+		}
+
+		var op WatchOp
+		switch {
+		case !existed && exists:
+			op = WatchCreate
+		case existed && exists && (p.written || st != old):
+			op = WatchWrite
+		case existed && !exists && p.renamed:
+			op = WatchRename
+		case existed && !exists:
+			op = WatchRemove
+		default:
+			continue
+		}
+
+		select {
+		case w.events <- WatchEvent{Path: path, Op: op}:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
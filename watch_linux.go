@@ -0,0 +1,175 @@
+package iutils
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF
+
+// inotify delivers the changes below one directory.
+type inotify struct {
+	file      *os.File
+	fd        int
+	root      string
+	recursive bool
+	skipDir   func(string) bool
+	out       chan<- rawChange
+	done      chan struct{}
+
+	mu   sync.Mutex
+	dirs map[int]string
+}
+
+// startInotify watches dir, and its subdirectories if recursive is set,
+// sending changes to out until stop is called.
+func startInotify(dir string, recursive bool, skipDir func(string) bool, out chan<- rawChange) (stop func(), err error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	// A non-blocking descriptor lets the runtime poller wake up Read when
+	// the file is closed.
+	in := &inotify{
+		file:      os.NewFile(uintptr(fd), "inotify"),
+		fd:        fd,
+		root:      dir,
+		recursive: recursive,
+		skipDir:   skipDir,
+		out:       out,
+		done:      make(chan struct{}),
+		dirs:      make(map[int]string),
+	}
+	if err := in.addTree(dir); err != nil {
+		in.file.Close()
+		return nil, err
+	}
+
+	go in.read()
+	return func() {
+		close(in.done)
+		in.file.Close()
+	}, nil
+}
+
+// addTree watches dir and, when recursive, the directories below it.
+func (in *inotify) addTree(dir string) error {
+	if !in.recursive {
+		return in.add(dir)
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && in.skipDir(path) {
+			return filepath.SkipDir
+		}
+		return in.add(path)
+	})
+}
+
+func (in *inotify) add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(in.fd, dir, inotifyMask|syscall.IN_ONLYDIR)
+	if err != nil {
+		return &fs.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	in.mu.Lock()
+	in.dirs[wd] = dir
+	in.mu.Unlock()
+	return nil
+}
+
+// forget stops watching dir and the directories below it.
+func (in *inotify) forget(dir string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	prefix := dir + string(filepath.Separator)
+	for wd, path := range in.dirs {
+		if path == dir || strings.HasPrefix(path, prefix) {
+			syscall.InotifyRmWatch(in.fd, uint32(wd))
+			delete(in.dirs, wd)
+		}
+	}
+}
+
+func (in *inotify) send(c rawChange) bool {
+	select {
+	case in.out <- c:
+		return true
+	case <-in.done:
+		return false
+	}
+}
+
+func (in *inotify) read() {
+	var buf [64 * 1024]byte
+	for {
+		n, err := in.file.Read(buf[:])
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[nameStart:nameStart+int(ev.Len)]), "\x00")
+			offset = nameStart + int(ev.Len)
+
+			if !in.handle(int(ev.Wd), ev.Mask, name) {
+				return
+			}
+		}
+	}
+}
+
+func (in *inotify) handle(wd int, mask uint32, name string) bool {
+	in.mu.Lock()
+	dir, ok := in.dirs[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(in.dirs, wd)
+	}
+	in.mu.Unlock()
+
+	switch {
+	case mask&syscall.IN_Q_OVERFLOW != 0:
+		// Events were lost; compare the whole tree.
+		return in.send(rawChange{path: in.root, dir: true})
+	case !ok || name == "":
+		// Events of the directory itself are reported by its parent.
+		return true
+	}
+
+	path := filepath.Join(dir, name)
+	gone := mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0
+	renamed := mask&syscall.IN_MOVED_FROM != 0
+
+	if mask&syscall.IN_ISDIR == 0 {
+		return in.send(rawChange{path: path, gone: gone, renamed: renamed})
+	}
+	if !in.recursive {
+		return true
+	}
+	if gone {
+		in.forget(path)
+	} else if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 && !in.skipDir(path) {
+		// Watch the new directory before its content is scanned, so that
+		// files created in the meantime are not missed.
+		in.addTree(path)
+	} else {
+		return true
+	}
+	return in.send(rawChange{path: path, dir: true, renamed: renamed})
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package iutils
+
+import "errors"
+
+// startInotify is only available on Linux; Watch polls elsewhere.
+func startInotify(dir string, recursive bool, skipDir func(string) bool, out chan<- rawChange) (stop func(), err error) {
+	return nil, errors.ErrUnsupported
+}
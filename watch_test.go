@@ -0,0 +1,126 @@
+package iutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// expectWatchEvents reads len(want) events, in any order, and checks that
+// nothing else arrives shortly after.
+func expectWatchEvents(t *testing.T, events <-chan WatchEvent, want ...WatchEvent) {
+	t.Helper()
+	var got []WatchEvent
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(want) {
+		select {
+		case ev := <-events:
+			got = append(got, ev)
+		case <-timeout:
+			t.Fatalf("got events %v, want %v", got, want)
+		}
+	}
+	select {
+	case ev := <-events:
+		got = append(got, ev)
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	sortEvents := func(evs []WatchEvent) {
+		sort.Slice(evs, func(i, j int) bool { return evs[i].Path < evs[j].Path })
+	}
+	sortEvents(got)
+	sortEvents(want)
+	if len(got) != len(want) {
+		t.Fatalf("got events %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got events %v, want %v", got, want)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		name := "inotify"
+		if poll {
+			name = "poll"
+		}
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			ctx, cancel := context.WithCancel(context.Background())
+			events, wait := Watch(ctx, dir, &WatchOptions{
+				Recursive:    true,
+				Exts:         []string{".log"},
+				ExcludeDirs:  []string{"skip"},
+				Debounce:     30 * time.Millisecond,
+				Poll:         poll,
+				PollInterval: 10 * time.Millisecond,
+			})
+			// Give the backend time to start before the first change.
+			time.Sleep(50 * time.Millisecond)
+
+			a := filepath.Join(dir, "a.log")
+			WriteFile2(a, []byte("1"))
+			WriteFile2(filepath.Join(dir, "b.txt"), []byte("ignored"))
+			expectWatchEvents(t, events, WatchEvent{a, WatchCreate})
+
+			WriteFile3(a, []byte("22"))
+			expectWatchEvents(t, events, WatchEvent{a, WatchWrite})
+
+			c := filepath.Join(dir, "sub", "deep", "c.log")
+			WriteFile2(c, []byte("c"))
+			WriteFile2(filepath.Join(dir, "skip", "x.log"), []byte("x"))
+			expectWatchEvents(t, events, WatchEvent{c, WatchCreate})
+
+			d := filepath.Join(dir, "d.log")
+			os.Rename(a, d)
+			wantOld := WatchRename
+			if poll {
+				// Polling cannot tell a rename from a removal.
+				wantOld = WatchRemove
+			}
+			expectWatchEvents(t, events, WatchEvent{a, wantOld}, WatchEvent{d, WatchCreate})
+
+			tmp := filepath.Join(dir, "tmp.log")
+			WriteFile2(tmp, []byte("short-lived"))
+			os.Remove(tmp)
+			os.Remove(d)
+			expectWatchEvents(t, events, WatchEvent{d, WatchRemove})
+
+			os.RemoveAll(filepath.Join(dir, "sub"))
+			expectWatchEvents(t, events, WatchEvent{c, WatchRemove})
+
+			cancel()
+			for range events {
+			}
+			if err := wait(); err != nil {
+				t.Errorf("wait() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "config.json")
+	WriteFile2(target, []byte("{}"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, _ := Watch(ctx, target, &WatchOptions{Debounce: 30 * time.Millisecond, Hash: true})
+	time.Sleep(50 * time.Millisecond)
+
+	WriteFile2(filepath.Join(dir, "other.json"), []byte("{}"))
+	WriteJson(target, map[string]int{"a": 1})
+	expectWatchEvents(t, events, WatchEvent{target, WatchWrite})
+
+	_, wait := Watch(ctx, filepath.Join(dir, "missing"), nil)
+	if err := wait(); err == nil {
+		t.Errorf("Watch() of a missing path succeeded, want an error")
+	}
+}
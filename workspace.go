@@ -0,0 +1,321 @@
+package iutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded is returned by writes that would grow a TempWorkspace
+// beyond its MaxSize.
+var ErrQuotaExceeded = errors.New("iutils: workspace quota exceeded")
+
+// ErrWorkspaceClosed is returned by operations on a closed TempWorkspace.
+var ErrWorkspaceClosed = errors.New("iutils: workspace closed")
+
+// WorkspaceMarker is the file in every workspace that records its owner as
+// a LockOwner, for SweepTempWorkspaces.
+const WorkspaceMarker = ".iutils-workspace"
+
+const defaultWorkspacePrefix = "iutils-ws-"
+
+// WorkspaceOptions configures NewTempWorkspace. A nil *WorkspaceOptions
+// creates an unlimited workspace in os.TempDir().
+type WorkspaceOptions struct {
+	// Dir is the parent directory, os.TempDir() if empty.
+	Dir string
+	// Prefix starts the name of the workspace directory, "iutils-ws-" if
+	// empty. Sweeps only consider directories with their prefix.
+	Prefix string
+	// MaxSize limits the total size of the files written through the
+	// workspace. Zero is unlimited.
+	MaxSize int64
+}
+
+// TempWorkspace is a scratch directory that is removed on Close. Its
+// methods take paths relative to the workspace and refuse paths leaving
+// it. It is safe for concurrent use.
+type TempWorkspace struct {
+	dir     string
+	maxSize int64
+
+	mu     sync.Mutex
+	sizes  map[string]int64 // sizes of the files written through ws
+	used   int64
+	closed bool
+}
+
+// NewTempWorkspace creates a new workspace directory with a unique name.
+func NewTempWorkspace(opts *WorkspaceOptions) (*TempWorkspace, error) {
+	if opts == nil {
+		opts = &WorkspaceOptions{}
+	}
+	parent, prefix := opts.Dir, opts.Prefix
+	if parent == "" {
+		parent = os.TempDir()
+	}
+	if prefix == "" {
+		prefix = defaultWorkspacePrefix
+	}
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(parent, prefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	marker, err := json.Marshal(LockOwner{PID: os.Getpid(), Hostname: hostname, Created: time.Now()})
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, WorkspaceMarker), append(marker, '\n'), 0644)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	return &TempWorkspace{dir: dir, maxSize: opts.MaxSize, sizes: make(map[string]int64)}, nil
+}
+
+// Dir returns the workspace directory.
+func (ws *TempWorkspace) Dir() string {
+	return ws.dir
+}
+
+// Path returns the absolute path of name in the workspace.
+func (ws *TempWorkspace) Path(name string) (string, error) {
+	if !filepath.IsLocal(name) || filepath.Clean(name) == WorkspaceMarker {
+		return "", &fs.PathError{Op: "workspace", Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(ws.dir, name), nil
+}
+
+// Usage returns the total size of the files written through the workspace.
+func (ws *TempWorkspace) Usage() int64 {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.used
+}
+
+// reserve accounts for name growing to size bytes.
+func (ws *TempWorkspace) reserve(name string, size int64) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed {
+		return ErrWorkspaceClosed
+	}
+	used := ws.used - ws.sizes[name] + size
+	if ws.maxSize > 0 && used > ws.maxSize {
+		return fmt.Errorf("%s: %w (%d of %d bytes)", name, ErrQuotaExceeded, used, ws.maxSize)
+	}
+	ws.used = used
+	ws.sizes[name] = size
+	return nil
+}
+
+// release forgets the size of name.
+func (ws *TempWorkspace) release(name string) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.used -= ws.sizes[name]
+	delete(ws.sizes, name)
+}
+
+// WriteFile writes name like WriteFile2, creating parent directories.
+func (ws *TempWorkspace) WriteFile(name string, data []byte) error {
+	path, err := ws.Path(name)
+	if err != nil {
+		return err
+	}
+	name = filepath.Clean(name)
+	if err := ws.reserve(name, int64(len(data))); err != nil {
+		return err
+	}
+	if err := WriteFile2(path, data); err != nil {
+		ws.release(name)
+		return err
+	}
+	return nil
+}
+
+// ReadFile reads name like ReadFile.
+func (ws *TempWorkspace) ReadFile(name string) ([]byte, error) {
+	path, err := ws.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return ReadFile(path)
+}
+
+// Create creates or truncates name for writing, creating parent
+// directories. Writes beyond the quota fail with ErrQuotaExceeded.
+func (ws *TempWorkspace) Create(name string) (io.WriteCloser, error) {
+	path, err := ws.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	name = filepath.Clean(name)
+	if err := ws.reserve(name, 0); err != nil {
+		return nil, err
+	}
+	if err := mkdirParent(path, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &workspaceFile{ws: ws, name: name, file: file}, nil
+}
+
+type workspaceFile struct {
+	ws   *TempWorkspace
+	name string
+	file *os.File
+	size int64
+}
+
+func (f *workspaceFile) Write(p []byte) (int, error) {
+	if err := f.ws.reserve(f.name, f.size+int64(len(p))); err != nil {
+		return 0, err
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if n < len(p) {
+		f.ws.reserve(f.name, f.size)
+	}
+	return n, err
+}
+
+func (f *workspaceFile) Close() error {
+	return f.file.Close()
+}
+
+// Remove removes name and its content.
+func (ws *TempWorkspace) Remove(name string) error {
+	path, err := ws.Path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+
+	name = filepath.Clean(name)
+	prefix := name + string(filepath.Separator)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for file, size := range ws.sizes {
+		if file == name || strings.HasPrefix(file, prefix) {
+			ws.used -= size
+			delete(ws.sizes, file)
+		}
+	}
+	return nil
+}
+
+// Close removes the workspace and everything in it.
+func (ws *TempWorkspace) Close() error {
+	ws.mu.Lock()
+	if ws.closed {
+		ws.mu.Unlock()
+		return ErrWorkspaceClosed
+	}
+	ws.closed = true
+	ws.mu.Unlock()
+	return os.RemoveAll(ws.dir)
+}
+
+// SweepOptions configures SweepTempWorkspaces. A nil *SweepOptions sweeps
+// the default workspaces in os.TempDir() whose process is gone.
+type SweepOptions struct {
+	// Dir and Prefix select the workspaces as in WorkspaceOptions.
+	Dir    string
+	Prefix string
+	// MaxAge also removes workspaces older than this even when their
+	// process still runs or cannot be checked, e.g. because it ran on
+	// another host. Zero keeps them.
+	MaxAge time.Duration
+}
+
+// SweepTempWorkspaces removes workspaces left behind by processes that
+// crashed before calling Close, and returns the removed directories. A
+// workspace is stale when its marker names a dead process on this host,
+// or when it is older than MaxAge. Directories without a marker are only
+// removed by MaxAge, since the marker may not be written yet.
+func SweepTempWorkspaces(opts *SweepOptions) ([]string, error) {
+	if opts == nil {
+		opts = &SweepOptions{}
+	}
+	parent, prefix := opts.Dir, opts.Prefix
+	if parent == "" {
+		parent = os.TempDir()
+	}
+	if prefix == "" {
+		prefix = defaultWorkspacePrefix
+	}
+
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+
+	var removed []string
+	var errs []error
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		dir := filepath.Join(parent, entry.Name())
+		if !workspaceStale(dir, hostname, opts.MaxAge) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, dir)
+	}
+	return removed, errors.Join(errs...)
+}
+
+func workspaceStale(dir, hostname string, maxAge time.Duration) bool {
+	created := time.Time{}
+	owner, err := ReadLockOwner(filepath.Join(dir, WorkspaceMarker))
+	if err == nil && owner.PID > 0 {
+		if owner.Hostname == hostname && !processAlive(owner.PID) {
+			return true
+		}
+		created = owner.Created
+	} else if info, err := os.Stat(dir); err == nil {
+		created = info.ModTime()
+	} else {
+		return false
+	}
+	return maxAge > 0 && time.Since(created) > maxAge
+}
+
+// RunWorkspaceJanitor calls SweepTempWorkspaces every interval until ctx is
+// done. Failed sweeps are retried at the next interval.
+func RunWorkspaceJanitor(ctx context.Context, interval time.Duration, opts *SweepOptions) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		SweepTempWorkspaces(opts)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
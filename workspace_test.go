@@ -0,0 +1,119 @@
+package iutils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTempWorkspace(t *testing.T) {
+	parent := t.TempDir()
+	ws, err := NewTempWorkspace(&WorkspaceOptions{Dir: parent, Prefix: "job-", MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(ws.Dir()) != parent || !strings.HasPrefix(filepath.Base(ws.Dir()), "job-") {
+		t.Errorf("Dir() = %s, want job-* in %s", ws.Dir(), parent)
+	}
+	owner, err := ReadLockOwner(filepath.Join(ws.Dir(), WorkspaceMarker))
+	if err != nil || owner.PID != os.Getpid() {
+		t.Errorf("marker = %+v, %v", owner, err)
+	}
+
+	if err := ws.WriteFile("a/b.txt", []byte("hello")); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if data, err := ws.ReadFile("a/b.txt"); err != nil || string(data) != "hello" {
+		t.Errorf("ReadFile() = %q, %v", data, err)
+	}
+	if err := ws.WriteFile("c.txt", []byte("123456")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("WriteFile() over quota error = %v, want %v", err, ErrQuotaExceeded)
+	}
+	// Rewriting a file only counts its new size.
+	if err := ws.WriteFile("a/b.txt", []byte("hi")); err != nil {
+		t.Fatalf("WriteFile() rewrite error = %v", err)
+	}
+	if ws.Usage() != 2 {
+		t.Errorf("Usage() = %d, want 2", ws.Usage())
+	}
+
+	w, err := ws.Create("stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("12345678")); err != nil {
+		t.Errorf("Write() within quota error = %v", err)
+	}
+	if _, err := w.Write([]byte("9")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Write() over quota error = %v, want %v", err, ErrQuotaExceeded)
+	}
+	w.Close()
+
+	if err := ws.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if ws.Usage() != 8 {
+		t.Errorf("Usage() after Remove = %d, want 8", ws.Usage())
+	}
+
+	for _, name := range []string{"../x", "/etc/passwd", "", WorkspaceMarker} {
+		if err := ws.WriteFile(name, nil); err == nil {
+			t.Errorf("WriteFile(%q) succeeded, want an error", name)
+		}
+	}
+
+	if err := ws.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if DirExists(ws.Dir()) {
+		t.Errorf("workspace %s still exists after Close", ws.Dir())
+	}
+	if err := ws.WriteFile("x", nil); !errors.Is(err, ErrWorkspaceClosed) {
+		t.Errorf("WriteFile() after Close error = %v, want %v", err, ErrWorkspaceClosed)
+	}
+}
+
+func TestSweepTempWorkspaces(t *testing.T) {
+	parent := t.TempDir()
+	hostname, _ := os.Hostname()
+	opts := &WorkspaceOptions{Dir: parent}
+
+	live, err := NewTempWorkspace(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+
+	dead, err := NewTempWorkspace(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLockOwner(t, filepath.Join(dead.Dir(), WorkspaceMarker), LockOwner{PID: 1 << 30, Hostname: hostname, Created: time.Now()})
+
+	remote, err := NewTempWorkspace(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLockOwner(t, filepath.Join(remote.Dir(), WorkspaceMarker), LockOwner{PID: 1, Hostname: "other-" + hostname, Created: time.Now().Add(-2 * time.Hour)})
+
+	other := filepath.Join(parent, "unrelated")
+	if err := os.Mkdir(other, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := SweepTempWorkspaces(&SweepOptions{Dir: parent})
+	if err != nil || len(removed) != 1 || removed[0] != dead.Dir() {
+		t.Errorf("SweepTempWorkspaces() = %v, %v, want [%s]", removed, err, dead.Dir())
+	}
+
+	removed, err = SweepTempWorkspaces(&SweepOptions{Dir: parent, MaxAge: time.Hour})
+	if err != nil || len(removed) != 1 || removed[0] != remote.Dir() {
+		t.Errorf("SweepTempWorkspaces() with MaxAge = %v, %v, want [%s]", removed, err, remote.Dir())
+	}
+	if !DirExists(live.Dir()) || !DirExists(other) {
+		t.Errorf("live workspace or unrelated directory was removed")
+	}
+}
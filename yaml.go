@@ -0,0 +1,790 @@
+package iutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// This file implements the YAML subset used by Load and Save: block and
+// single line flow collections, plain and quoted scalars, literal and
+// folded block strings and comments. Anchors, aliases, tags and multiple
+// documents are rejected.
+
+type yamlLine struct {
+	no     int // 1-based line number
+	indent int
+	text   string // content without indentation and comment
+	tab    bool   // indentation contains a tab
+}
+
+type yamlParser struct {
+	raw []string
+	pos int
+	// cur caches the line at pos. Sequence items such as "- key: value"
+	// replace it with the part after the dash.
+	cur *yamlLine
+}
+
+func parseYAML(data []byte) (interface{}, error) {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	p := &yamlParser{raw: strings.Split(text, "\n")}
+
+	if l := p.peek(); l != nil && isYAMLMarker(l, "---") {
+		p.advance()
+	}
+
+	var root interface{}
+	if l := p.peek(); l != nil && !isYAMLMarker(l, "---") && !isYAMLMarker(l, "...") {
+		var err error
+		if root, err = p.parseNode(l.indent); err != nil {
+			return nil, err
+		}
+	}
+
+	if l := p.peek(); l != nil && isYAMLMarker(l, "...") {
+		p.advance()
+	}
+	if l := p.peek(); l != nil {
+		if isYAMLMarker(l, "---") {
+			return nil, p.errorf(l, 1, "multiple documents are not supported")
+		}
+		return nil, p.errorf(l, l.indent+1, "unexpected %q", l.text)
+	}
+	return root, nil
+}
+
+func (p *yamlParser) peek() *yamlLine {
+	if p.cur != nil {
+		return p.cur
+	}
+	for ; p.pos < len(p.raw); p.pos++ {
+		raw := p.raw[p.pos]
+		content := strings.TrimLeft(raw, " ")
+		text := stripYAMLComment(strings.TrimSpace(content))
+		if text == "" {
+			continue
+		}
+		p.cur = &yamlLine{
+			no:     p.pos + 1,
+			indent: len(raw) - len(content),
+			text:   text,
+			tab:    strings.HasPrefix(content, "\t"),
+		}
+		return p.cur
+	}
+	return nil
+}
+
+func (p *yamlParser) advance() {
+	p.cur = nil
+	p.pos++
+}
+
+func (p *yamlParser) errorf(l *yamlLine, col int, format string, args ...interface{}) error {
+	return &DecodeError{Line: l.no, Column: col, Err: fmt.Errorf(format, args...)}
+}
+
+func isYAMLMarker(l *yamlLine, marker string) bool {
+	return l.indent == 0 && (l.text == marker || strings.HasPrefix(l.text, marker+" "))
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseNode parses the block node starting at the next line, if that line
+// is indented by at least indent.
+func (p *yamlParser) parseNode(indent int) (interface{}, error) {
+	l := p.peek()
+	if l == nil || l.indent < indent || isYAMLMarker(l, "---") || isYAMLMarker(l, "...") {
+		return nil, nil
+	}
+	if l.tab {
+		return nil, p.errorf(l, l.indent+1, "tabs are not allowed in indentation")
+	}
+	if isYAMLSeqItem(l.text) {
+		return p.parseSeq(l.indent)
+	}
+	if _, _, ok := splitYAMLKey(l.text); ok {
+		return p.parseMap(l.indent)
+	}
+	p.advance()
+	return p.parseInline(l, l.text, l.indent, l.indent-1)
+}
+
+func (p *yamlParser) parseSeq(indent int) (interface{}, error) {
+	list := []interface{}{}
+	for {
+		l := p.peek()
+		if l == nil || l.indent < indent || isYAMLMarker(l, "---") || isYAMLMarker(l, "...") {
+			break
+		}
+		if l.tab {
+			return nil, p.errorf(l, l.indent+1, "tabs are not allowed in indentation")
+		}
+		if l.indent > indent {
+			return nil, p.errorf(l, l.indent+1, "unexpected indentation")
+		}
+		if !isYAMLSeqItem(l.text) {
+			// A key of the mapping that holds this sequence.
+			break
+		}
+
+		var item interface{}
+		var err error
+		rest := strings.TrimLeft(l.text[1:], " ")
+		offset := len(l.text) - len(rest)
+		_, _, isKey := splitYAMLKey(rest)
+		switch {
+		case rest == "":
+			p.advance()
+			item, err = p.parseNode(indent + 1)
+		case isKey || isYAMLSeqItem(rest):
+			// A nested block that starts on the line of the dash.
+			p.cur = &yamlLine{no: l.no, indent: indent + offset, text: rest}
+			item, err = p.parseNode(indent + offset)
+		default:
+			p.advance()
+			item, err = p.parseInline(l, rest, indent+offset, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+func (p *yamlParser) parseMap(indent int) (interface{}, error) {
+	m := newOrderedMap()
+	for {
+		l := p.peek()
+		if l == nil || l.indent < indent || isYAMLMarker(l, "---") || isYAMLMarker(l, "...") {
+			break
+		}
+		if l.tab {
+			return nil, p.errorf(l, l.indent+1, "tabs are not allowed in indentation")
+		}
+		if l.indent > indent {
+			return nil, p.errorf(l, l.indent+1, "unexpected indentation")
+		}
+		key, rest, ok := splitYAMLKey(l.text)
+		if !ok {
+			return nil, p.errorf(l, l.indent+1, "expected a mapping key, got %q", l.text)
+		}
+		if _, dup := m.get(key); dup {
+			return nil, p.errorf(l, l.indent+1, "duplicate key %q", key)
+		}
+		m.setPos(key, l.no, l.indent+1)
+		p.advance()
+
+		var value interface{}
+		var err error
+		if rest == "" {
+			// The value is the indented block below, or a sequence at the
+			// indentation of the key.
+			next := p.peek()
+			if next != nil && (next.indent > indent || next.indent == indent && isYAMLSeqItem(next.text)) {
+				value, err = p.parseNode(next.indent)
+			}
+		} else {
+			value, err = p.parseInline(l, rest, l.indent+len(l.text)-len(rest), indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.set(key, value)
+	}
+	return m, nil
+}
+
+// parseInline parses the value s that starts at the 0-based column col of
+// l. Block strings continue on the lines indented deeper than
+// parentIndent.
+func (p *yamlParser) parseInline(l *yamlLine, s string, col, parentIndent int) (interface{}, error) {
+	switch s[0] {
+	case '|', '>':
+		return p.parseBlockString(l, s, col, parentIndent)
+	case '[', '{':
+		f := &yamlFlow{p: p, line: l, s: s, col: col}
+		return f.parse()
+	case '&', '*', '!':
+		return nil, p.errorf(l, col+1, "anchors, aliases and tags are not supported")
+	case '"', '\'':
+		value, n, err := scanYAMLQuoted(s)
+		if err != nil {
+			return nil, p.errorf(l, col+1, "%v", err)
+		}
+		if n < len(s) {
+			return nil, p.errorf(l, col+n+1, "unexpected %q after quoted string", s[n:])
+		}
+		return value, nil
+	}
+
+	value, err := resolveYAMLScalar(s)
+	if err != nil {
+		return nil, p.errorf(l, col+1, "%v", err)
+	}
+	return value, nil
+}
+
+func (p *yamlParser) parseBlockString(l *yamlLine, header string, col, parentIndent int) (interface{}, error) {
+	literal := header[0] == '|'
+	var chomp byte
+	for i := 1; i < len(header); i++ {
+		switch c := header[i]; {
+		case (c == '-' || c == '+') && chomp == 0:
+			chomp = c
+		case c >= '1' && c <= '9':
+			return nil, p.errorf(l, col+i+1, "explicit indentation indicators are not supported")
+		default:
+			return nil, p.errorf(l, col+i+1, "invalid block string header %q", header)
+		}
+	}
+
+	var lines []string
+	blockIndent := -1
+	for ; p.pos < len(p.raw); p.pos++ {
+		raw := p.raw[p.pos]
+		if strings.TrimSpace(raw) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+		if blockIndent < 0 {
+			if indent <= parentIndent {
+				break
+			}
+			blockIndent = indent
+		}
+		if indent < blockIndent {
+			break
+		}
+		lines = append(lines, raw[blockIndent:])
+	}
+
+	end := len(lines)
+	for end > 0 && lines[end-1] == "" {
+		end--
+	}
+	body, trailing := lines[:end], len(lines)-end
+
+	var sb strings.Builder
+	for i, line := range body {
+		switch {
+		case i == 0:
+		case literal, line == "", strings.HasPrefix(line, " "), strings.HasPrefix(body[i-1], " "):
+			sb.WriteByte('\n')
+		case body[i-1] == "":
+			// The line break was written for the empty line.
+		default:
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(line)
+	}
+	switch chomp {
+	case '-':
+	case '+':
+		sb.WriteString(strings.Repeat("\n", trailing+1))
+	default:
+		if len(body) > 0 {
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String(), nil
+}
+
+// stripYAMLComment removes a trailing comment from a line. A '#' starts a
+// comment at the start of the line or after whitespace, outside of quotes.
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			// Quotes only start a scalar, as in "it's" they are text.
+			if i == 0 || strings.IndexByte(" \t[{,:-", s[i-1]) >= 0 {
+				quote = c
+			}
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return strings.TrimRight(s[:i], " \t")
+		}
+	}
+	return s
+}
+
+// splitYAMLKey splits a "key: value" line.
+func splitYAMLKey(text string) (key, rest string, ok bool) {
+	if text == "" || strings.IndexByte("[{#&*!|>", text[0]) >= 0 || isYAMLSeqItem(text) {
+		return "", "", false
+	}
+
+	if text[0] == '"' || text[0] == '\'' {
+		key, n, err := scanYAMLQuoted(text)
+		if err != nil {
+			return "", "", false
+		}
+		after := strings.TrimLeft(text[n:], " ")
+		if after == ":" || strings.HasPrefix(after, ": ") {
+			return key, strings.TrimSpace(after[1:]), true
+		}
+		return "", "", false
+	}
+
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			key = strings.TrimSpace(text[:i])
+			return key, strings.TrimSpace(text[i+1:]), key != ""
+		}
+	}
+	return "", "", false
+}
+
+// scanYAMLQuoted decodes the quoted scalar at the start of s and returns
+// the number of bytes it occupies.
+func scanYAMLQuoted(s string) (string, int, error) {
+	q := s[0]
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if q == '\'' {
+			if c == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					sb.WriteByte('\'')
+					i++
+					continue
+				}
+				return sb.String(), i + 1, nil
+			}
+			sb.WriteByte(c)
+			continue
+		}
+
+		switch c {
+		case '"':
+			return sb.String(), i + 1, nil
+		case '\\':
+			if i+1 >= len(s) {
+				return "", 0, errors.New("unterminated quoted string")
+			}
+			i++
+			switch e := s[i]; e {
+			case '0':
+				sb.WriteByte(0)
+			case 'a':
+				sb.WriteByte('\a')
+			case 'b':
+				sb.WriteByte('\b')
+			case 't', '\t':
+				sb.WriteByte('\t')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'v':
+				sb.WriteByte('\v')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'e':
+				sb.WriteByte(0x1b)
+			case ' ', '"', '/', '\\':
+				sb.WriteByte(e)
+			case 'N':
+				sb.WriteRune('\u0085')
+			case '_':
+				sb.WriteRune(' ')
+			case 'x', 'u', 'U':
+				n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+				if i+1+n > len(s) {
+					return "", 0, fmt.Errorf("invalid escape \\%c", e)
+				}
+				r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid escape \\%c%s", e, s[i+1:i+1+n])
+				}
+				sb.WriteRune(rune(r))
+				i += n
+			default:
+				return "", 0, fmt.Errorf("invalid escape \\%c", e)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated quoted string")
+}
+
+var (
+	yamlIntRe   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloatRe = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// resolveYAMLScalar returns the value of a plain scalar as nil, bool,
+// json.Number or string, following the YAML 1.2 core schema.
+func resolveYAMLScalar(s string) (interface{}, error) {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+
+	lower := strings.ToLower(strings.TrimLeft(s, "+-"))
+	switch {
+	case lower == ".inf" || lower == ".nan":
+		return nil, fmt.Errorf("%s cannot be represented", s)
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0o"):
+		base := 16
+		if s[1] == 'o' {
+			base = 8
+		}
+		if n, ok := exactInteger(s[2:], base); ok {
+			return n, nil
+		}
+	case yamlIntRe.MatchString(s):
+		n, _ := exactInteger(s, 10)
+		return n, nil
+	case yamlFloatRe.MatchString(s):
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", s)
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+	}
+	return s, nil
+}
+
+// yamlFlow parses a flow collection, which must fit on one line.
+type yamlFlow struct {
+	p    *yamlParser
+	line *yamlLine
+	s    string
+	i    int
+	col  int
+}
+
+func (f *yamlFlow) errorf(format string, args ...interface{}) error {
+	return f.p.errorf(f.line, f.col+f.i+1, format, args...)
+}
+
+func (f *yamlFlow) parse() (interface{}, error) {
+	v, err := f.value(false)
+	if err != nil {
+		return nil, err
+	}
+	f.skipSpaces()
+	if f.i < len(f.s) {
+		return nil, f.errorf("unexpected %q after flow collection", f.s[f.i:])
+	}
+	return v, nil
+}
+
+func (f *yamlFlow) skipSpaces() {
+	for f.i < len(f.s) && (f.s[f.i] == ' ' || f.s[f.i] == '\t') {
+		f.i++
+	}
+}
+
+func (f *yamlFlow) unterminated() error {
+	return f.errorf("unterminated flow collection, flow collections must fit on one line")
+}
+
+// value parses the next value. Keys are returned as strings without
+// resolving their type.
+func (f *yamlFlow) value(key bool) (interface{}, error) {
+	f.skipSpaces()
+	if f.i >= len(f.s) {
+		return nil, f.unterminated()
+	}
+
+	switch f.s[f.i] {
+	case '[':
+		f.i++
+		list := []interface{}{}
+		for {
+			f.skipSpaces()
+			if f.i >= len(f.s) {
+				return nil, f.unterminated()
+			}
+			if f.s[f.i] == ']' {
+				f.i++
+				return list, nil
+			}
+			v, err := f.value(false)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		f.i++
+		m := newOrderedMap()
+		for {
+			f.skipSpaces()
+			if f.i >= len(f.s) {
+				return nil, f.unterminated()
+			}
+			if f.s[f.i] == '}' {
+				f.i++
+				return m, nil
+			}
+			keyCol := f.col + f.i + 1
+			k, err := f.value(true)
+			if err != nil {
+				return nil, err
+			}
+			key := fmt.Sprint(k)
+			if _, dup := m.get(key); dup {
+				return nil, f.errorf("duplicate key %q", key)
+			}
+			m.setPos(key, f.line.no, keyCol)
+
+			var v interface{}
+			f.skipSpaces()
+			if f.i < len(f.s) && f.s[f.i] == ':' {
+				f.i++
+				f.skipSpaces()
+				if f.i < len(f.s) && f.s[f.i] != ',' && f.s[f.i] != '}' {
+					if v, err = f.value(false); err != nil {
+						return nil, err
+					}
+				}
+			}
+			m.set(key, v)
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	case '"', '\'':
+		v, n, err := scanYAMLQuoted(f.s[f.i:])
+		if err != nil {
+			return nil, f.errorf("%v", err)
+		}
+		f.i += n
+		return v, nil
+	case '&', '*', '!':
+		return nil, f.errorf("anchors, aliases and tags are not supported")
+	}
+
+	start := f.i
+	for ; f.i < len(f.s); f.i++ {
+		c := f.s[f.i]
+		if c == ',' || c == ']' || c == '}' {
+			break
+		}
+		if key && c == ':' && (f.i+1 == len(f.s) || strings.IndexByte(" ,]}", f.s[f.i+1]) >= 0) {
+			break
+		}
+	}
+	text := strings.TrimSpace(f.s[start:f.i])
+	if key {
+		return text, nil
+	}
+	v, err := resolveYAMLScalar(text)
+	if err != nil {
+		f.i = start
+		return nil, f.errorf("%v", err)
+	}
+	return v, nil
+}
+
+// separator consumes the ',' between items or stops before the closing
+// bracket.
+func (f *yamlFlow) separator(closing byte) error {
+	f.skipSpaces()
+	if f.i >= len(f.s) {
+		return f.unterminated()
+	}
+	switch f.s[f.i] {
+	case ',':
+		f.i++
+		return nil
+	case closing:
+		return nil
+	}
+	return f.errorf("expected ',' or '%c'", closing)
+}
+
+// emitYAML encodes a value made of nil, bool, json.Number, string,
+// []interface{} and *orderedMap.
+func emitYAML(v interface{}) []byte {
+	var buf bytes.Buffer
+	switch v := v.(type) {
+	case *orderedMap:
+		if len(v.keys) == 0 {
+			buf.WriteString("{}\n")
+		} else {
+			emitYAMLMap(&buf, v, 0)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString("[]\n")
+		} else {
+			emitYAMLSeq(&buf, v, 0)
+		}
+	default:
+		buf.WriteString(yamlScalar(v))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func emitYAMLMap(buf *bytes.Buffer, m *orderedMap, indent int) {
+	for _, key := range m.keys {
+		buf.WriteString(strings.Repeat(" ", indent))
+		buf.WriteString(yamlString(key))
+		buf.WriteByte(':')
+		emitYAMLValue(buf, m.values[key], indent)
+	}
+}
+
+func emitYAMLSeq(buf *bytes.Buffer, list []interface{}, indent int) {
+	for _, item := range list {
+		var sub bytes.Buffer
+		switch item := item.(type) {
+		case *orderedMap:
+			if len(item.keys) > 0 {
+				emitYAMLMap(&sub, item, indent+2)
+			}
+		case []interface{}:
+			if len(item) > 0 {
+				emitYAMLSeq(&sub, item, indent+2)
+			}
+		}
+
+		buf.WriteString(strings.Repeat(" ", indent))
+		if sub.Len() > 0 {
+			// Start the nested block on the line of the dash.
+			buf.WriteString("- ")
+			buf.Write(sub.Bytes()[indent+2:])
+			continue
+		}
+		buf.WriteByte('-')
+		emitYAMLValue(buf, item, indent)
+	}
+}
+
+// emitYAMLValue writes the value following "key:" or "-".
+func emitYAMLValue(buf *bytes.Buffer, v interface{}, indent int) {
+	switch v := v.(type) {
+	case *orderedMap:
+		if len(v.keys) == 0 {
+			buf.WriteString(" {}\n")
+			return
+		}
+		buf.WriteByte('\n')
+		emitYAMLMap(buf, v, indent+2)
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString(" []\n")
+			return
+		}
+		buf.WriteByte('\n')
+		emitYAMLSeq(buf, v, indent+2)
+	case string:
+		if isYAMLBlockString(v) {
+			emitYAMLBlockString(buf, v, indent+2)
+			return
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(yamlString(v))
+		buf.WriteByte('\n')
+	default:
+		buf.WriteByte(' ')
+		buf.WriteString(yamlScalar(v))
+		buf.WriteByte('\n')
+	}
+}
+
+// isYAMLBlockString reports whether s is multi-line text that survives a
+// literal block string unchanged.
+func isYAMLBlockString(s string) bool {
+	if !strings.Contains(s, "\n") || strings.HasPrefix(s, " ") || !utf8.ValidString(s) {
+		return false
+	}
+	for _, line := range strings.Split(s, "\n") {
+		if line != "" && strings.TrimSpace(line) == "" {
+			return false
+		}
+		for _, r := range line {
+			if r != '\t' && !unicode.IsPrint(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func emitYAMLBlockString(buf *bytes.Buffer, s string, indent int) {
+	body := strings.TrimSuffix(s, "\n")
+	switch {
+	case !strings.HasSuffix(s, "\n"):
+		buf.WriteString(" |-\n")
+	case strings.HasSuffix(body, "\n"):
+		buf.WriteString(" |+\n")
+	default:
+		buf.WriteString(" |\n")
+	}
+
+	// Trailing empty lines of a kept string are written as empty lines.
+	prefix := strings.Repeat(" ", indent)
+	for _, line := range strings.Split(body, "\n") {
+		if line != "" {
+			buf.WriteString(prefix)
+			buf.WriteString(line)
+		}
+		buf.WriteByte('\n')
+	}
+}
+
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case string:
+		return yamlString(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// yamlString returns s as a plain scalar when that reads back as the same
+// string and double quoted otherwise.
+func yamlString(s string) string {
+	if s == "" || strings.IndexByte("-?:,[]{}#&*!|>'\"%@`.~ ", s[0]) >= 0 ||
+		strings.HasSuffix(s, " ") || strings.HasSuffix(s, ":") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") || !utf8.ValidString(s) {
+		return strconv.Quote(s)
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	if v, err := resolveYAMLScalar(s); err != nil || v != s {
+		return strconv.Quote(s)
+	}
+	return s
+}
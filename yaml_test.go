@@ -0,0 +1,97 @@
+package iutils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "# nothing\n", `null`},
+		{"scalars", "a: 1\nb: -2.5\nc: true\nd: ~\ne: hello world\nf: '1'\ng: \"x\\ty\"\nh: 0x1f\n",
+			`{"a":1,"b":-2.5,"c":true,"d":null,"e":"hello world","f":"1","g":"x\ty","h":31}`},
+		{"comments", "---\na: x # note\nb: \"#not\" # note\nc: it's # note\n...\n",
+			`{"a":"x","b":"#not","c":"it's"}`},
+		{"nested", "server:\n  host: localhost\n  ports:\n    - 80\n    - 443\n",
+			`{"server":{"host":"localhost","ports":[80,443]}}`},
+		{"sequence at key indent", "tags:\n- a\n- b\nnext: 1\n",
+			`{"tags":["a","b"],"next":1}`},
+		{"sequence of mappings", "- name: a\n  port: 1\n- name: b\n  port: 2\n",
+			`[{"name":"a","port":1},{"name":"b","port":2}]`},
+		{"nested sequences", "- - a\n  - b\n-\n  - c\n",
+			`[["a","b"],["c"]]`},
+		{"flow", "a: [1, \"two\", {x: y, z: [3]}]\nb: {}\nc: []\n",
+			`{"a":[1,"two",{"x":"y","z":[3]}],"b":{},"c":[]}`},
+		{"literal", "text: |\n  one\n    two\n\n  three\nnext: x\n",
+			`{"text":"one\n  two\n\nthree\n","next":"x"}`},
+		{"literal strip keep", "a: |-\n  x\nb: |+\n  y\n\nc: 1\n",
+			`{"a":"x","b":"y\n\n","c":1}`},
+		{"folded", "text: >\n  one\n  two\n\n  three\n",
+			`{"text":"one two\nthree\n"}`},
+		{"quoted keys", "\"a: b\": 1\n'c': 2\n",
+			`{"a: b":1,"c":2}`},
+		{"url", "url: http://example.com/a#b\n",
+			`{"url":"http://example.com/a#b"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := parseYAML([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("parseYAML() error = %v", err)
+			}
+			got, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("parseYAML() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLUnsupported(t *testing.T) {
+	for _, in := range []string{
+		"a: &anchor 1\n",
+		"a: *alias\n",
+		"a: !!str 1\n",
+		"a: 1\n---\nb: 2\n",
+		"a:\n\t- 1\n",
+		"- a\nb: 1\n",
+		"a: .inf\n",
+	} {
+		if _, err := parseYAML([]byte(in)); err == nil {
+			t.Errorf("parseYAML(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestEmitYAMLRoundTrip(t *testing.T) {
+	values := []string{
+		`{"a":"","b":"-x","c":"true","d":"a: b","e":" lead","f":"null","g":"x\u0000y","h":"tab\tin"}`,
+		`{"list":[{"a":1,"b":[1,2]},[],{},[["x"]],null],"empty":{}}`,
+		`{"multi":"a\n\nb","strip":"a\nb","keep":"a\n\n","spaces":"a\n  \nb"}`,
+		`["x",{"y":"z"}]`,
+	}
+
+	for _, in := range values {
+		generic, err := toOrderedGeneric(json.RawMessage(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := emitYAML(generic)
+		parsed, err := parseYAML(out)
+		if err != nil {
+			t.Fatalf("parseYAML(%q) error = %v", out, err)
+		}
+		got, _ := json.Marshal(parsed)
+		if string(got) != in {
+			t.Errorf("round trip of %s through\n%s= %s", in, out, got)
+		}
+	}
+}